@@ -12,6 +12,11 @@ import (
 	"github.com/JpUnique/petrodata-leave-project/pkg/database"
 	"github.com/JpUnique/petrodata-leave-project/pkg/handlers"
 	"github.com/JpUnique/petrodata-leave-project/pkg/middleware"
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"github.com/JpUnique/petrodata-leave-project/pkg/outbox"
+	"github.com/JpUnique/petrodata-leave-project/pkg/service"
+	"github.com/JpUnique/petrodata-leave-project/pkg/signedlink"
+	"github.com/JpUnique/petrodata-leave-project/pkg/storage"
 	"github.com/joho/godotenv"
 	"github.com/rs/cors"
 )
@@ -29,10 +34,29 @@ func main() {
 	}
 	addr := ":" + port
 
+	// Approval links are signed; refuse to start with an empty key
+	if err := signedlink.CheckKey(); err != nil {
+		log.Fatalf("Approval links: %v", err)
+	}
+
 	// 3. Initialize Database
 	database.Connect()
+	storage.Init(database.DB)
+
+	// 4. Mail transport (MailerSend, SMTP or .eml files), the outbox worker, approval reminders and leave records
+	if err := service.InitMailer(); err != nil {
+		log.Fatalf("Mail transport: %v", err)
+	}
+	if err := service.LoadEmailTemplates(); err != nil {
+		log.Fatalf("Email templates: %v", err)
+	}
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	defer stopWorker()
+	outbox.Start(workerCtx, database.DB)
+	handlers.StartReminders(workerCtx, database.DB)
+	handlers.StartRecordWorker(workerCtx, database.DB)
 
-	// 4. Routing
+	// 5. Routing
 	mux := http.NewServeMux()
 
 	// Serve Static Files (CSS, JS, Images)
@@ -58,6 +82,8 @@ func main() {
 	// API Endpoints
 	mux.HandleFunc("/api/signup", handlers.Signup)
 	mux.HandleFunc("/api/login", handlers.Login)
+	mux.HandleFunc("/api/holidays", handlers.ListPublicHolidays)
+	mux.HandleFunc("/api/leave-types", handlers.ListLeaveTypes)
 	mux.HandleFunc("/api/leave/submit", middleware.Auth(handlers.SubmitLeaveRequest))
 	mux.HandleFunc("/api/leave/details", handlers.GetLeaveRequestByToken)
 	mux.HandleFunc("/api/leave/action", handlers.HandleLineManagerAction)
@@ -65,10 +91,44 @@ func main() {
 	mux.HandleFunc("/api/leave/hr-action", handlers.HandleHRManagerAction)
 	mux.HandleFunc("/api/leave/md-details", handlers.GetLeaveRequestByMDToken)
 	mux.HandleFunc("/api/leave/md-action", handlers.HandleMDAction)
+	mux.HandleFunc("/api/leave/stage-details", handlers.GetLeaveRequestByStageToken)
+	mux.HandleFunc("/api/leave/stage-action", handlers.HandleStageAction)
+	mux.HandleFunc("/api/leave/link-code", handlers.RequestLinkCode)
+	mux.HandleFunc("/api/leave/my-requests", middleware.Auth(handlers.GetMyLeaveRequests))
+	mux.HandleFunc("/api/leave/my-requests/pdf", middleware.Auth(handlers.DownloadMyLeavePDF))
+	mux.HandleFunc("/api/leave/cancel", middleware.Auth(handlers.CancelLeaveRequest))
+	mux.HandleFunc("/api/leave/amend", middleware.Auth(handlers.AmendLeaveRequest))
+	mux.HandleFunc("/api/leave/audit-trail", middleware.Auth(handlers.GetAuditTrail))
+	mux.HandleFunc("/api/delegations", middleware.Auth(handlers.Delegations))
+	mux.HandleFunc("/api/inbox", middleware.Auth(handlers.GetApproverInbox))
+	mux.HandleFunc("/api/inbox/actions", middleware.Auth(handlers.HandleInboxActions))
+	mux.HandleFunc("/api/inbox/code", middleware.Auth(handlers.RequestInboxCode))
+	mux.HandleFunc("/api/leave/cancellation-details", handlers.GetCancellationDetails)
+	mux.HandleFunc("/api/leave/cancellation-action", handlers.HandleCancellationAction)
+	mux.HandleFunc("/api/leave/filing-details", handlers.GetFilingDetails)
+	mux.HandleFunc("/api/leave/filing-action", handlers.HandleFilingAction)
+	mux.HandleFunc("/api/leave/md-review-details", handlers.GetMDReviewDetails)
+	mux.HandleFunc("/api/leave/md-review-action", handlers.HandleMDReviewAction)
 	mux.HandleFunc("/api/leave/final-details", handlers.GetFinalArchiveDetails)
 	mux.HandleFunc("/api/leave/download-pdf", handlers.DownloadAndArchiveLeavePDF)
-
-	// 5. Setup CORS
+	mux.HandleFunc("/api/leave/verify", handlers.VerifyLeaveDocument)
+
+	// Administration (HR; admins are always allowed)
+	mux.HandleFunc("/api/admin/approval-chains", middleware.AuthRole(handlers.ApprovalChains, models.RoleHR))
+	mux.HandleFunc("/api/admin/leave-balances/rollover", middleware.AuthRole(handlers.RolloverLeaveBalances, models.RoleHR))
+	mux.HandleFunc("/api/admin/holidays", middleware.AuthRole(handlers.ManagePublicHolidays, models.RoleHR))
+	mux.HandleFunc("/api/admin/staffing-rules", middleware.AuthRole(handlers.StaffingRules, models.RoleHR))
+	mux.HandleFunc("/api/admin/leave-types", middleware.AuthRole(handlers.LeaveTypes, models.RoleHR))
+	mux.HandleFunc("/api/admin/staff-records", middleware.AuthRole(handlers.StaffRecords, models.RoleHR))
+	mux.HandleFunc("/api/admin/leave/supporting-document", middleware.AuthRole(handlers.DownloadSupportingDocument, models.RoleHR))
+	mux.HandleFunc("/api/admin/leave/reissue-link", middleware.AuthRole(handlers.ReissueApprovalLink, models.RoleHR))
+	mux.HandleFunc("/api/admin/archive", middleware.AuthRole(handlers.ListArchivedRecords, models.RoleHR))
+	mux.HandleFunc("/api/admin/archive/pdf", middleware.AuthRole(handlers.DownloadArchivedRecord, models.RoleHR))
+	mux.HandleFunc("/api/admin/outbox", middleware.AuthRole(handlers.ListOutbox, models.RoleHR))
+	mux.HandleFunc("/api/admin/outbox/resend", middleware.AuthRole(handlers.ResendOutboxEmail, models.RoleHR))
+	mux.HandleFunc("/api/admin/users", middleware.AuthRole(handlers.UserRoles))
+
+	// 6. Setup CORS
 	c := cors.New(cors.Options{
 		AllowedOrigins: []string{
 			"https://petrodata-portal.onrender.com",
@@ -80,10 +140,10 @@ func main() {
 		Debug:            false, // Set to false in production
 	})
 
-	// 6. Wrap handler with CORS
+	// 7. Wrap handler with CORS
 	handler := c.Handler(mux)
 
-	// 5. Server Setup
+	// 8. Server Setup
 	srv := &http.Server{
 		Addr:         addr,
 		Handler:      handler,
@@ -100,12 +160,13 @@ func main() {
 		}
 	}()
 
-	// 6. Graceful Shutdown
+	// 9. Graceful Shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
 
 	log.Println("Shutting down gracefully...")
+	stopWorker()
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -0,0 +1,178 @@
+// Package calendar computes leave working days, skipping weekends and Nigerian
+// public holidays. Fixed-date holidays and Easter are computed; movable
+// holidays such as Eid are maintained by HR in the public_holidays table.
+package calendar
+
+import (
+	"sort"
+	"time"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"gorm.io/gorm"
+)
+
+// DateLayout is the date format used by the leave form and API.
+const DateLayout = "2006-01-02"
+
+// Holiday is a non-working day on the calendar.
+type Holiday struct {
+	ID      uint   `json:"id,omitempty"` // Set for HR-managed movable holidays
+	Date    string `json:"date"`
+	Name    string `json:"name"`
+	Movable bool   `json:"movable"`
+}
+
+// Calendar holds the holidays for a range of years.
+type Calendar struct {
+	holidays map[string]Holiday
+}
+
+// Parse parses a date in DateLayout.
+func Parse(s string) (time.Time, error) {
+	return time.Parse(DateLayout, s)
+}
+
+// Load builds a calendar covering the given years from the fixed holiday
+// rules and the movable holidays stored in the database.
+func Load(db *gorm.DB, years ...int) (*Calendar, error) {
+	c := &Calendar{holidays: make(map[string]Holiday)}
+	if len(years) == 0 {
+		return c, nil
+	}
+
+	minYear, maxYear := years[0], years[0]
+	for _, y := range years {
+		minYear, maxYear = min(minYear, y), max(maxYear, y)
+	}
+	for y := minYear; y <= maxYear; y++ {
+		for _, h := range fixedHolidays(y) {
+			c.holidays[h.Date] = h
+		}
+	}
+
+	var movable []models.PublicHoliday
+	from := time.Date(minYear, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(maxYear+1, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := db.Where("date >= ? AND date < ?", from, to).Find(&movable).Error; err != nil {
+		return nil, err
+	}
+	for _, m := range movable {
+		d := m.Date.Format(DateLayout)
+		c.holidays[d] = Holiday{ID: m.ID, Date: d, Name: m.Name, Movable: true}
+	}
+
+	return c, nil
+}
+
+// LoadRange builds a calendar covering every year between start and end.
+func LoadRange(db *gorm.DB, start, end time.Time) (*Calendar, error) {
+	return Load(db, start.Year(), end.Year())
+}
+
+// Holidays returns the calendar's holidays in date order.
+func (c *Calendar) Holidays() []Holiday {
+	list := make([]Holiday, 0, len(c.holidays))
+	for _, h := range c.holidays {
+		list = append(list, h)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Date < list[j].Date })
+	return list
+}
+
+// IsWorkingDay reports whether d is neither a weekend nor a holiday.
+func (c *Calendar) IsWorkingDay(d time.Time) bool {
+	if isWeekend(d) {
+		return false
+	}
+	_, holiday := c.holidays[d.Format(DateLayout)]
+	return !holiday
+}
+
+// WorkingDays counts the working days from start up to, but not including, resumption.
+func (c *Calendar) WorkingDays(start, resumption time.Time) int {
+	count := 0
+	for d := start; d.Before(resumption); d = d.AddDate(0, 0, 1) {
+		if c.IsWorkingDay(d) {
+			count++
+		}
+	}
+	return count
+}
+
+// ResumptionDate returns the first working day after taking days working days from start.
+func (c *Calendar) ResumptionDate(start time.Time, days int) time.Time {
+	d := start
+	for taken := 0; taken < days; d = d.AddDate(0, 0, 1) {
+		if c.IsWorkingDay(d) {
+			taken++
+		}
+	}
+	for !c.IsWorkingDay(d) {
+		d = d.AddDate(0, 0, 1)
+	}
+	return d
+}
+
+func isWeekend(d time.Time) bool {
+	return d.Weekday() == time.Saturday || d.Weekday() == time.Sunday
+}
+
+// fixedHolidays returns the statutory holidays for year. A holiday falling on a
+// weekend (or on a day already taken by another holiday) is observed on the
+// next free weekday, as declared by the Federal Government.
+func fixedHolidays(year int) []Holiday {
+	date := func(month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	easter := easterSunday(year)
+
+	rules := []struct {
+		date time.Time
+		name string
+	}{
+		{date(time.January, 1), "New Year's Day"},
+		{easter.AddDate(0, 0, -2), "Good Friday"},
+		{easter.AddDate(0, 0, 1), "Easter Monday"},
+		{date(time.May, 1), "Workers' Day"},
+		{date(time.June, 12), "Democracy Day"},
+		{date(time.October, 1), "Independence Day"},
+		{date(time.December, 25), "Christmas Day"},
+		{date(time.December, 26), "Boxing Day"},
+	}
+
+	taken := make(map[string]bool)
+	var list []Holiday
+	for _, r := range rules {
+		d, name := r.date, r.name
+		for isWeekend(d) || taken[d.Format(DateLayout)] {
+			d = d.AddDate(0, 0, 1)
+		}
+		if !d.Equal(r.date) {
+			name += " (observed)"
+		}
+		key := d.Format(DateLayout)
+		taken[key] = true
+		list = append(list, Holiday{Date: key, Name: name})
+	}
+	return list
+}
+
+// easterSunday computes the date of Easter Sunday in the Gregorian calendar
+// (anonymous Gregorian algorithm).
+func easterSunday(year int) time.Time {
+	a := year % 19
+	b := year / 100
+	c := year % 100
+	d := b / 4
+	e := b % 4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i := c / 4
+	k := c % 4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,185 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+)
+
+// testCalendar builds a calendar of the fixed holidays of years plus the
+// given movable holidays, without a database.
+func testCalendar(years []int, movable ...Holiday) *Calendar {
+	c := &Calendar{holidays: make(map[string]Holiday)}
+	for _, y := range years {
+		for _, h := range fixedHolidays(y) {
+			c.holidays[h.Date] = h
+		}
+	}
+	for _, h := range movable {
+		h.Movable = true
+		c.holidays[h.Date] = h
+	}
+	return c
+}
+
+func mustParse(t *testing.T, s string) time.Time {
+	t.Helper()
+	d, err := Parse(s)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", s, err)
+	}
+	return d
+}
+
+func TestEasterSunday(t *testing.T) {
+	tests := []struct {
+		year int
+		want string
+	}{
+		{1818, "1818-03-22"}, // Earliest possible date
+		{1943, "1943-04-25"}, // Latest possible date
+		{2000, "2000-04-23"},
+		{2019, "2019-04-21"},
+		{2024, "2024-03-31"},
+		{2025, "2025-04-20"},
+		{2026, "2026-04-05"},
+		{2038, "2038-04-25"},
+	}
+	for _, tt := range tests {
+		if got := easterSunday(tt.year).Format(DateLayout); got != tt.want {
+			t.Errorf("easterSunday(%d) = %s, want %s", tt.year, got, tt.want)
+		}
+	}
+}
+
+func TestFixedHolidays(t *testing.T) {
+	tests := []struct {
+		year  int
+		want  map[string]string
+		notOn []string
+	}{
+		{
+			year: 2026,
+			want: map[string]string{
+				"2026-01-01": "New Year's Day",
+				"2026-04-03": "Good Friday",
+				"2026-04-06": "Easter Monday",
+				"2026-05-01": "Workers' Day",
+				"2026-06-12": "Democracy Day",
+				"2026-10-01": "Independence Day",
+				"2026-12-25": "Christmas Day",
+				"2026-12-28": "Boxing Day (observed)", // Saturday 26th
+			},
+			notOn: []string{"2026-12-26"},
+		},
+		{
+			// Christmas on Saturday and Boxing Day on Sunday: both move, one after the other
+			year: 2021,
+			want: map[string]string{
+				"2021-05-03": "Workers' Day (observed)",  // Saturday 1st
+				"2021-06-14": "Democracy Day (observed)", // Saturday 12th
+				"2021-12-27": "Christmas Day (observed)",
+				"2021-12-28": "Boxing Day (observed)",
+			},
+			notOn: []string{"2021-05-01", "2021-06-12", "2021-12-25", "2021-12-26"},
+		},
+		{
+			year: 2022,
+			want: map[string]string{
+				"2022-10-03": "Independence Day (observed)", // Saturday 1st
+				"2022-12-26": "Christmas Day (observed)",    // Sunday 25th
+				"2022-12-27": "Boxing Day (observed)",       // Monday 26th is taken
+			},
+		},
+	}
+	for _, tt := range tests {
+		got := make(map[string]string)
+		for _, h := range fixedHolidays(tt.year) {
+			if isWeekend(mustParse(t, h.Date)) {
+				t.Errorf("%d: %s is observed on a weekend (%s)", tt.year, h.Name, h.Date)
+			}
+			if _, dup := got[h.Date]; dup {
+				t.Errorf("%d: two holidays observed on %s", tt.year, h.Date)
+			}
+			got[h.Date] = h.Name
+		}
+		for date, name := range tt.want {
+			if got[date] != name {
+				t.Errorf("%d: holiday on %s = %q, want %q", tt.year, date, got[date], name)
+			}
+		}
+		for _, date := range tt.notOn {
+			if name, ok := got[date]; ok {
+				t.Errorf("%d: unexpected holiday %q on %s", tt.year, name, date)
+			}
+		}
+		if len(got) != 8 {
+			t.Errorf("%d: %d holidays, want 8", tt.year, len(got))
+		}
+	}
+}
+
+func TestWorkingDays(t *testing.T) {
+	cal := testCalendar([]int{2026, 2027}, Holiday{Date: "2026-03-20", Name: "Eid-el-Fitr"})
+	tests := []struct {
+		name       string
+		start, end string
+		want       int
+	}{
+		{"one week", "2026-02-02", "2026-02-09", 5},
+		{"resumption day is not counted", "2026-02-02", "2026-02-03", 1},
+		{"weekend only", "2026-02-07", "2026-02-09", 0},
+		{"Easter", "2026-03-30", "2026-04-13", 8},
+		{"movable holiday", "2026-03-16", "2026-03-23", 4},
+		{"across the new year", "2026-12-28", "2027-01-04", 3},
+		{"empty range", "2026-02-09", "2026-02-09", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cal.WorkingDays(mustParse(t, tt.start), mustParse(t, tt.end)); got != tt.want {
+				t.Errorf("WorkingDays(%s, %s) = %d, want %d", tt.start, tt.end, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResumptionDate(t *testing.T) {
+	cal := testCalendar([]int{2026, 2027})
+	tests := []struct {
+		name  string
+		start string
+		days  int
+		want  string
+	}{
+		{"mid week", "2026-02-02", 3, "2026-02-05"},
+		{"over a weekend", "2026-02-04", 3, "2026-02-09"},
+		{"over Easter", "2026-03-30", 8, "2026-04-13"},
+		{"ends before Christmas", "2026-12-21", 4, "2026-12-29"},
+		{"starts on a weekend", "2026-02-07", 1, "2026-02-10"},
+		{"across the new year", "2026-12-29", 3, "2027-01-04"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := mustParse(t, tt.start)
+			got := cal.ResumptionDate(start, tt.days)
+			if got.Format(DateLayout) != tt.want {
+				t.Errorf("ResumptionDate(%s, %d) = %s, want %s", tt.start, tt.days, got.Format(DateLayout), tt.want)
+			}
+			// The two calculations agree
+			if n := cal.WorkingDays(start, got); n != tt.days {
+				t.Errorf("WorkingDays(%s, %s) = %d, want %d", tt.start, tt.want, n, tt.days)
+			}
+		})
+	}
+}
+
+func TestHolidaysSorted(t *testing.T) {
+	list := testCalendar([]int{2026}, Holiday{Date: "2026-03-20", Name: "Eid-el-Fitr"}).Holidays()
+	if len(list) != 9 {
+		t.Fatalf("Holidays() returned %d, want 9", len(list))
+	}
+	for i := 1; i < len(list); i++ {
+		if list[i-1].Date >= list[i].Date {
+			t.Errorf("Holidays() out of order: %s before %s", list[i-1].Date, list[i].Date)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"github.com/JpUnique/petrodata-leave-project/pkg/utils"
 	"github.com/joho/godotenv"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -34,6 +35,8 @@ func Connect() {
 		log.Fatalf("Migration failed: %v", err)
 	}
 	SeedStaffRecords(db)
+	SeedLeaveTypes(db)
+	SeedAdmins(db)
 
 	DB = db
 	log.Println("connected to the database and migrated successfully")
@@ -55,12 +58,29 @@ func migrateWithIndexes(db *gorm.DB) error {
 		db.Exec("DROP INDEX IF EXISTS " + idx)
 	}
 
+	// Convert legacy text date columns before AutoMigrate sees the new DATE types
+	if err := migrateLeaveDateColumns(db); err != nil {
+		return fmt.Errorf("date column migration failed: %w", err)
+	}
+
 	// AutoMigrate tables (GORM will now create resource_token, director_token, etc.)
 	if err := db.AutoMigrate(
 		&models.User{},
 		&models.LeaveRequest{},
 		&models.ApprovalAction{},
 		&models.StaffRecord{}, // NEW: Ensure this is migrated
+		&models.ApprovalChain{},
+		&models.ApprovalChainStage{},
+		&models.LeaveRequestStage{},
+		&models.LeaveBalance{},
+		&models.PublicHoliday{},
+		&models.StaffingRule{},
+		&models.ApprovalLink{},
+		&models.LeaveDocument{},
+		&models.ArchivedFile{},
+		&models.OutboxEmail{},
+		&models.Delegation{},
+		&models.LeaveType{},
 	); err != nil {
 		return fmt.Errorf("automigrate failed: %w", err)
 	}
@@ -81,6 +101,9 @@ func migrateWithIndexes(db *gorm.DB) error {
 		db.Exec(sql)
 	}
 
+	// One archived record per request; concurrent archiving loses on this index
+	db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_leave_documents_archived ON leave_documents (leave_request_id) WHERE storage_key <> ''")
+
 	// Cleanup: Ensure empty strings from any logic gaps are treated as NULL
 	cleanupSQL := `
         UPDATE leave_requests SET resource_token = NULL WHERE resource_token = '';
@@ -89,6 +112,20 @@ func migrateWithIndexes(db *gorm.DB) error {
     `
 	db.Exec(cleanupSQL)
 
+	// Record links emailed before issue and expiry times were tracked
+	if err := backfillApprovalLinks(db); err != nil {
+		return fmt.Errorf("approval link backfill failed: %w", err)
+	}
+	if err := relabelCancellationLinks(db); err != nil {
+		return fmt.Errorf("cancellation link migration failed: %w", err)
+	}
+	if err := backfillStaffDetails(db); err != nil {
+		return fmt.Errorf("staff record backfill failed: %w", err)
+	}
+	if err := normalizeUserEmails(db); err != nil {
+		return fmt.Errorf("user email migration failed: %w", err)
+	}
+
 	return nil
 }
 
@@ -118,6 +155,7 @@ func SeedStaffRecords(db *gorm.DB) {
 	}
 
 	for _, staff := range staffList {
+		staff.DeriveFromStaffID()
 		// Use FirstOrCreate so we don't create duplicates on every server restart
 		err := db.Where(models.StaffRecord{Email: staff.Email}).FirstOrCreate(&staff).Error
 		if err != nil {
@@ -126,3 +164,47 @@ func SeedStaffRecords(db *gorm.DB) {
 	}
 	log.Println("HR Staff Records synchronized successfully.")
 }
+
+// SeedLeaveTypes fills an empty leave type catalogue with the types the leave
+// form offered before HR managed them, without further rules.
+func SeedLeaveTypes(db *gorm.DB) {
+	var count int64
+	if err := db.Model(&models.LeaveType{}).Count(&count).Error; err != nil {
+		log.Printf("Error checking leave types: %v", err)
+		return
+	}
+	if count > 0 {
+		return
+	}
+
+	types := []models.LeaveType{
+		{Name: models.AnnualLeaveType, Label: "Annual Leave", Paid: true, CountsAgainstAnnual: true, Active: true},
+		{Name: "Sick", Label: "Sick Leave", Paid: true, Active: true},
+		{Name: "Casual", Label: "Casual Leave", Paid: true, Active: true},
+	}
+	if err := db.Create(&types).Error; err != nil {
+		log.Printf("Error seeding leave types: %v", err)
+		return
+	}
+	log.Println("Leave type catalogue seeded.")
+}
+
+// SeedAdmins gives the admin role to registered users listed in ADMIN_EMAILS.
+// Only accounts whose email and staff number match an HR staff record are
+// promoted; signing up with a listed address does not make anyone an admin.
+// Listed users who register later are promoted at the next start.
+func SeedAdmins(db *gorm.DB) {
+	admins := utils.AdminEmails()
+	if len(admins) == 0 {
+		return
+	}
+	result := db.Model(&models.User{}).
+		Where("LOWER(email) IN ? AND role <> ?", admins, models.RoleAdmin).
+		Where("EXISTS (SELECT 1 FROM staff_records s WHERE LOWER(s.email) = LOWER(users.email) AND s.staff_id = users.staff_no)").
+		Update("role", models.RoleAdmin)
+	if result.Error != nil {
+		log.Printf("Error seeding admins: %v", result.Error)
+		return
+	}
+	log.Printf("Admin roles synchronized (%d promoted).", result.RowsAffected)
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// legacyDateLayouts are the formats seen in leave_requests before the date
+// columns were typed. The HTML date inputs post the first one.
+var legacyDateLayouts = []string{
+	"2006-01-02",
+	time.RFC3339,
+	"2006/01/02",
+	"02/01/2006",
+	"2/1/2006",
+	"02-01-2006",
+	"Jan 02, 2006",
+	"January 2, 2006",
+	"2 January 2006",
+}
+
+// leaveDateColumns are the leave_requests columns converted from text to DATE.
+var leaveDateColumns = []string{"start_date", "resumption_date", "date_employed"}
+
+// parseLegacyDate tries every known layout on a stored text date.
+func parseLegacyDate(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range legacyDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// migrateLeaveDateColumns converts the text date columns of leave_requests to
+// DATE before AutoMigrate runs. Each row is parsed in Go so that formats
+// Postgres cannot cast are still recovered. Rows that cannot be parsed are
+// logged and left NULL; the original text is kept in <column>_legacy.
+func migrateLeaveDateColumns(db *gorm.DB) error {
+	for _, column := range leaveDateColumns {
+		var dataType string
+		err := db.Raw(
+			"SELECT data_type FROM information_schema.columns WHERE table_name = 'leave_requests' AND column_name = ?",
+			column,
+		).Scan(&dataType).Error
+		if err != nil {
+			return fmt.Errorf("inspect %s: %w", column, err)
+		}
+		if dataType != "text" && dataType != "character varying" {
+			continue // Fresh database or already migrated
+		}
+
+		if err := convertDateColumn(db, column); err != nil {
+			return fmt.Errorf("convert %s: %w", column, err)
+		}
+	}
+	return nil
+}
+
+func convertDateColumn(db *gorm.DB, column string) error {
+	legacy := column + "_legacy"
+	log.Printf("Converting leave_requests.%s to DATE (original text kept in %s)", column, legacy)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(fmt.Sprintf("ALTER TABLE leave_requests RENAME COLUMN %s TO %s", column, legacy)).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(fmt.Sprintf("ALTER TABLE leave_requests ADD COLUMN %s date", column)).Error; err != nil {
+			return err
+		}
+
+		var rows []struct {
+			ID    uint
+			Value string
+		}
+		err := tx.Raw(fmt.Sprintf("SELECT id, %s AS value FROM leave_requests WHERE COALESCE(%s, '') <> ''", legacy, legacy)).
+			Scan(&rows).Error
+		if err != nil {
+			return err
+		}
+
+		converted, unparsable := 0, 0
+		for _, row := range rows {
+			t, ok := parseLegacyDate(row.Value)
+			if !ok {
+				unparsable++
+				log.Printf("[WARN] leave_requests id=%d: unparsable %s %q left NULL", row.ID, column, row.Value)
+				continue
+			}
+			if err := tx.Exec(fmt.Sprintf("UPDATE leave_requests SET %s = ? WHERE id = ?", column), t.Format("2006-01-02"), row.ID).Error; err != nil {
+				return err
+			}
+			converted++
+		}
+
+		log.Printf("leave_requests.%s: %d rows converted, %d unparsable", column, converted, unparsable)
+		return nil
+	})
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"github.com/JpUnique/petrodata-leave-project/pkg/utils"
+	"github.com/JpUnique/petrodata-leave-project/pkg/workflow"
+	"gorm.io/gorm"
+)
+
+// legacyLinkSources select the tokens emailed before approval links were
+// recorded, with the address each was sent to. live is true while the request
+// is still waiting on that link.
+var legacyLinkSources = []struct {
+	purpose string
+	query   string
+	args    []interface{}
+}{
+	{models.LinkManager, "SELECT request_token AS token, id AS request_id, manager_email AS email, status = ? AS live FROM leave_requests WHERE request_token IS NOT NULL",
+		[]interface{}{string(workflow.StatePending)}},
+	// Cancellation tokens share the column with HR review tokens, so they are recorded first
+	{models.LinkCancellation, "SELECT resource_token AS token, id AS request_id, hr_email AS email, TRUE AS live FROM leave_requests WHERE resource_token IS NOT NULL AND status = ?",
+		[]interface{}{string(workflow.StateCancellationRequested)}},
+	{models.LinkHR, "SELECT resource_token AS token, id AS request_id, hr_email AS email, status = ? AS live FROM leave_requests WHERE resource_token IS NOT NULL",
+		[]interface{}{string(workflow.StatePendingHRReview)}},
+	{models.LinkMD, "SELECT director_token AS token, id AS request_id, md_email AS email, status = ? AS live FROM leave_requests WHERE director_token IS NOT NULL",
+		[]interface{}{string(workflow.StatePendingMDApproval)}},
+	{models.LinkFinal, "SELECT final_token AS token, id AS request_id, hr_email AS email, status = ? AS live FROM leave_requests WHERE final_token IS NOT NULL",
+		[]interface{}{string(workflow.StateFullyApproved)}},
+	{models.LinkStage, `SELECT s.token AS token, s.leave_request_id AS request_id, s.approver_email AS email,
+			(s.decision = '' AND s.position = r.current_stage AND r.status = ?) AS live
+		FROM leave_request_stages s JOIN leave_requests r ON r.id = s.leave_request_id
+		WHERE s.token IS NOT NULL`,
+		[]interface{}{string(workflow.StatePendingStage)}},
+}
+
+// relabelCancellationLinks gives outstanding HR links of requests awaiting
+// cancellation confirmation the cancellation purpose they now have, so HR can
+// find them in the inbox and re-issue them. Emailed copies still carry the
+// old purpose and stop working.
+func relabelCancellationLinks(db *gorm.DB) error {
+	result := db.Model(&models.ApprovalLink{}).
+		Where("purpose = ? AND used_at IS NULL", models.LinkHR).
+		Where("leave_request_id IN (?)", db.Model(&models.LeaveRequest{}).Select("id").Where("status = ?", string(workflow.StateCancellationRequested))).
+		Update("purpose", models.LinkCancellation)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("approval_links: %d HR links relabelled as cancellation links", result.RowsAffected)
+	}
+	return nil
+}
+
+// backfillApprovalLinks records tokens issued before approval links existed.
+// They were emailed unsigned and are accepted as they are until they expire.
+// Links still awaited get a full lifetime from now; the rest are marked used
+// so a decided request cannot be decided again from an old email.
+func backfillApprovalLinks(db *gorm.DB) error {
+	now := time.Now()
+	expires := now.Add(utils.ApprovalLinkTTL())
+
+	for _, src := range legacyLinkSources {
+		var rows []struct {
+			Token     string
+			RequestID uint
+			Email     string
+			Live      bool
+		}
+		if err := db.Raw(src.query, src.args...).Scan(&rows).Error; err != nil {
+			return fmt.Errorf("read %s tokens: %w", src.purpose, err)
+		}
+
+		added := 0
+		for _, row := range rows {
+			link := models.ApprovalLink{
+				Token:          row.Token,
+				LeaveRequestID: row.RequestID,
+				Purpose:        src.purpose,
+				ApproverEmail:  utils.NormalizeEmail(row.Email),
+				Legacy:         true,
+				IssuedAt:       now,
+				ExpiresAt:      expires,
+			}
+			if !row.Live {
+				link.UsedAt = &now
+			}
+			result := db.Where(models.ApprovalLink{Token: row.Token}).FirstOrCreate(&link)
+			if result.Error != nil {
+				return fmt.Errorf("record %s token for request %d: %w", src.purpose, row.RequestID, result.Error)
+			}
+			added += int(result.RowsAffected)
+		}
+		if added > 0 {
+			log.Printf("approval_links: recorded %d legacy %s tokens", added, src.purpose)
+		}
+	}
+	return nil
+}
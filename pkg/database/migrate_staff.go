@@ -0,0 +1,36 @@
+package database
+
+import (
+	"log"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"gorm.io/gorm"
+)
+
+// backfillStaffDetails fills the gender and employment date of staff records
+// that lack them from their staff IDs. Values HR has set are kept.
+func backfillStaffDetails(db *gorm.DB) error {
+	var staff []models.StaffRecord
+	if err := db.Where("COALESCE(gender, '') = '' OR employed_on IS NULL").Find(&staff).Error; err != nil {
+		return err
+	}
+
+	updated := 0
+	for _, s := range staff {
+		gender, employedOn := s.Gender, s.EmployedOn
+		s.DeriveFromStaffID()
+		if s.Gender == gender && s.EmployedOn.Equal(employedOn.Time) {
+			continue
+		}
+		err := db.Model(&models.StaffRecord{}).Where("id = ?", s.ID).
+			Updates(map[string]interface{}{"gender": s.Gender, "employed_on": s.EmployedOn}).Error
+		if err != nil {
+			return err
+		}
+		updated++
+	}
+	if updated > 0 {
+		log.Printf("staff_records: filled gender or employment date of %d records from their staff IDs", updated)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// normalizeUserEmails stores every account email in the normalized form used
+// at signup and login, then makes emails unique regardless of case. Accounts
+// that differ only in case must be merged or removed by hand first, so
+// migration stops and names them.
+func normalizeUserEmails(db *gorm.DB) error {
+	var duplicates []string
+	err := db.Raw("SELECT LOWER(TRIM(email)) FROM users GROUP BY LOWER(TRIM(email)) HAVING COUNT(*) > 1").
+		Scan(&duplicates).Error
+	if err != nil {
+		return err
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("users: several accounts share the email %s in different case; keep one of each before starting", strings.Join(duplicates, ", "))
+	}
+
+	result := db.Exec("UPDATE users SET email = LOWER(TRIM(email)) WHERE email <> LOWER(TRIM(email))")
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("users: normalized the email of %d accounts", result.RowsAffected)
+	}
+
+	return db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users (LOWER(email))").Error
+}
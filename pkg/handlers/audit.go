@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/database"
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"github.com/JpUnique/petrodata-leave-project/pkg/utils"
+	"github.com/JpUnique/petrodata-leave-project/pkg/workflow"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// APPROVAL AUDIT TRAIL
+// ============================================================================
+
+// Audit trail stage names for steps that are not approver stages
+const (
+	auditStageStaff        = "Staff"
+	auditStageCancellation = "HR Cancellation Review"
+	auditStageFinal        = "Final Archive"
+	auditStageFiling       = "HR Filing"
+	auditStageMDReview     = "MD Review"
+)
+
+// clientIP returns the address of the client behind r. Behind trusted
+// proxies it is the X-Forwarded-For entry appended by the outermost one;
+// entries to its left come from the client and can be forged. Without a
+// proxy it is the connection's address.
+func clientIP(r *http.Request) string {
+	if hops := utils.TrustedProxyHops(); hops > 0 {
+		if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+			entries := strings.Split(strings.Join(fwd, ","), ",")
+			return strings.TrimSpace(entries[max(len(entries)-hops, 0)])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// auditEntry starts an audit trail row for an action taken through r.
+func auditEntry(r *http.Request, requestID uint, actor, stage, decision, reason string) models.ApprovalAction {
+	return models.ApprovalAction{
+		RequestID:  requestID,
+		Approver:   utils.NormalizeEmail(actor),
+		Stage:      stage,
+		Decision:   decision,
+		Reason:     reason,
+		ClientIP:   clientIP(r),
+		UserAgent:  r.UserAgent(),
+		ActionDate: time.Now(),
+	}
+}
+
+// linkAuditEntry starts an audit trail row for a decision made through link,
+// naming the principal when their delegate acted.
+func linkAuditEntry(r *http.Request, link models.ApprovalLink, stage, decision, reason string) models.ApprovalAction {
+	entry := auditEntry(r, link.LeaveRequestID, link.ApproverEmail, stage, decision, reason)
+	entry.OnBehalfOf = link.OnBehalfOf
+	return entry
+}
+
+// checkSignature checks a signature posted with a decision. Approvals must be
+// signed when required is set; rejections may be. The decision is refused
+// with a 400 when the signature is missing or not a usable PNG.
+func checkSignature(signature string, required bool) error {
+	if signature == "" {
+		if required {
+			return refuseDecision(http.StatusBadRequest, ErrMissingSignature)
+		}
+		return nil
+	}
+	if _, err := (models.ApprovalAction{Signature: signature}).SignatureImage(); err != nil {
+		return refuseDecision(http.StatusBadRequest, err.Error())
+	}
+	return nil
+}
+
+// auditStage names the step a link of purpose belongs to. stage is only used
+// for chain stage links.
+func auditStage(purpose string, stage models.LeaveRequestStage) string {
+	switch purpose {
+	case models.LinkManager:
+		return string(workflow.ActorLineManager)
+	case models.LinkHR:
+		return string(workflow.ActorHR)
+	case models.LinkMD:
+		return string(workflow.ActorMD)
+	case models.LinkFinal:
+		return auditStageFinal
+	case models.LinkCancellation:
+		return auditStageCancellation
+	}
+	return stage.Name
+}
+
+// loadAuditTrail returns the audit trail of a request, oldest first.
+func loadAuditTrail(db *gorm.DB, requestID uint) ([]models.ApprovalAction, error) {
+	var actions []models.ApprovalAction
+	err := db.Where("request_id = ?", requestID).Order("action_date ASC, id ASC").Find(&actions).Error
+	return actions, err
+}
+
+// GetAuditTrail returns every recorded action on a leave request.
+// The staff member who made the request may see it, as may HR, the MD and admins.
+//
+// Query params:
+// - id: Leave request ID (required)
+func GetAuditTrail(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodGet) {
+		return
+	}
+
+	userEmail, ok := r.Context().Value("userEmail").(string)
+	if !ok || userEmail == "" {
+		respondError(w, http.StatusUnauthorized, "Unauthorized: email not found in session")
+		return
+	}
+
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	if err != nil || id == 0 {
+		respondError(w, http.StatusBadRequest, "id must be a leave request ID")
+		return
+	}
+
+	var leaveReq models.LeaveRequest
+	if err := database.DB.Where("id = ?", uint(id)).First(&leaveReq).Error; err != nil {
+		respondError(w, http.StatusNotFound, ErrRequestNotFound)
+		return
+	}
+
+	role, _ := r.Context().Value("userRole").(string)
+	switch models.Role(role) {
+	case models.RoleHR, models.RoleMD, models.RoleAdmin:
+	default:
+		if utils.NormalizeEmail(leaveReq.StaffEmail) != utils.NormalizeEmail(userEmail) {
+			respondError(w, http.StatusNotFound, ErrRequestNotFound)
+			return
+		}
+	}
+
+	actions, err := loadAuditTrail(database.DB, leaveReq.ID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load audit trail for request %d: %v", leaveReq.ID, err)
+		respondError(w, http.StatusInternalServerError, "failed to load audit trail")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"reference": leaveReq.Reference(),
+		"status":    leaveReq.Status,
+		"actions":   actions,
+	})
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/database"
+	"github.com/JpUnique/petrodata-leave-project/pkg/ledger"
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"github.com/JpUnique/petrodata-leave-project/pkg/workflow"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// LEAVE BALANCE LEDGER
+// ============================================================================
+
+// balanceBucket returns where a request in state s holds its days in the ledger.
+func balanceBucket(s workflow.State) ledger.Bucket {
+	switch {
+	case s.IsPending(), s.IsReturned():
+		return ledger.Reserved
+	case s == workflow.StateFullyApproved, s == workflow.StateCancellationRequested:
+		return ledger.Used
+	}
+	return ledger.None
+}
+
+// balanceKey returns the ledger row a request is charged against.
+func balanceKey(leaveReq *models.LeaveRequest) ledger.Key {
+	leaveType := leaveReq.BalanceType
+	if leaveType == "" {
+		leaveType = leaveReq.LeaveType
+	}
+	return ledger.Key{
+		StaffEmail: leaveReq.StaffEmail,
+		Year:       leaveReq.BalanceYear,
+		LeaveType:  leaveType,
+	}
+}
+
+// settleBalance moves the request's days in the ledger to match a status change from -> leaveReq.Status.
+func settleBalance(tx *gorm.DB, leaveReq *models.LeaveRequest, from workflow.State) error {
+	was, now := balanceBucket(from), balanceBucket(workflow.State(leaveReq.Status))
+	return ledger.Move(tx, balanceKey(leaveReq), leaveReq.TotalDays, was, now)
+}
+
+// RolloverLeaveBalances recomputes carry-over into the given year from the
+// previous year's closing balances.
+//
+// Query params:
+// - year: Target year (defaults to the current year)
+func RolloverLeaveBalances(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodPost) {
+		return
+	}
+
+	year := time.Now().Year()
+	if v := r.URL.Query().Get("year"); v != "" {
+		y, err := strconv.Atoi(v)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "year must be a number")
+			return
+		}
+		year = y
+	}
+
+	count, err := ledger.Rollover(database.DB, year)
+	if err != nil {
+		log.Printf("[ERROR] Leave balance rollover into %d failed: %v", year, err)
+		respondError(w, http.StatusInternalServerError, "failed to roll over leave balances")
+		return
+	}
+
+	log.Printf("[INFO] Rolled over %d leave balances into %d (cap %d days)", count, year, ledger.CarryOverCap())
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"message":        "Leave balances rolled over",
+		"year":           year,
+		"balances":       count,
+		"carry_over_cap": ledger.CarryOverCap(),
+	})
+}
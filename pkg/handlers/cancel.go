@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/database"
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"github.com/JpUnique/petrodata-leave-project/pkg/outbox"
+	"github.com/JpUnique/petrodata-leave-project/pkg/service"
+	"github.com/JpUnique/petrodata-leave-project/pkg/utils"
+	"github.com/JpUnique/petrodata-leave-project/pkg/workflow"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// STAFF CANCELLATION
+// ============================================================================
+
+// CancelLeaveRequestBody represents a staff member withdrawing their own request.
+type CancelLeaveRequestBody struct {
+	ID     uint   `json:"id"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// CancellationActionRequest represents HR's decision on a cancellation of approved leave.
+type CancellationActionRequest struct {
+	Token  string `json:"token"`
+	Status string `json:"status"`           // "Approved" confirms the cancellation, "Rejected" keeps the leave
+	Reason string `json:"reason,omitempty"` // Required if rejected
+	Code   string `json:"code,omitempty"`   // Required when approvers must confirm their email
+}
+
+// pendingApproverEmail returns who currently holds an approval link for
+// leaveReq, or "" if nobody does.
+func pendingApproverEmail(db *gorm.DB, leaveReq models.LeaveRequest) (string, error) {
+	switch workflow.State(leaveReq.Status) {
+	case workflow.StatePending:
+		return leaveReq.ManagerEmail, nil
+	case workflow.StatePendingHRReview:
+		return leaveReq.HREmail, nil
+	case workflow.StatePendingMDApproval:
+		return leaveReq.MDEmail, nil
+	case workflow.StatePendingStage:
+		var stage models.LeaveRequestStage
+		err := db.Where("leave_request_id = ? AND position = ?", leaveReq.ID, leaveReq.CurrentStage).First(&stage).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		return stage.ApproverEmail, err
+	}
+	return "", nil
+}
+
+// CancelLeaveRequest lets the authenticated staff member withdraw one of their requests.
+//
+// Request body:
+// - id: Leave request ID (required)
+// - reason: Why the leave is being withdrawn (optional)
+//
+// A pending request is cancelled immediately: its approval links stop working,
+// the reserved days are released and the approver holding the link is told.
+// A Fully Approved request moves to "Cancellation Requested" and HR is asked
+// to confirm before the days are restored.
+func CancelLeaveRequest(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodPost) {
+		return
+	}
+
+	userEmail, ok := r.Context().Value("userEmail").(string)
+	if !ok || userEmail == "" {
+		respondError(w, http.StatusUnauthorized, "Unauthorized: email not found in session")
+		return
+	}
+	userEmail = utils.NormalizeEmail(userEmail)
+
+	var req CancelLeaveRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, ErrInvalidJSON)
+		return
+	}
+
+	var leaveReq models.LeaveRequest
+	if err := database.DB.Where("id = ? AND staff_email = ?", req.ID, userEmail).First(&leaveReq).Error; err != nil {
+		respondError(w, http.StatusNotFound, ErrRequestNotFound)
+		return
+	}
+
+	from := workflow.State(leaveReq.Status)
+	next, err := workflow.Transition(from, workflow.ActorStaff, workflow.DecisionWithdrawn)
+	if err != nil {
+		respondTransitionError(w, leaveReq.ID, err)
+		return
+	}
+
+	approverEmail, err := pendingApproverEmail(database.DB, leaveReq)
+	if err != nil {
+		log.Printf("[ERROR] Failed to find pending approver for request %d: %v", leaveReq.ID, err)
+		respondError(w, http.StatusInternalServerError, ErrSaveAction)
+		return
+	}
+
+	leaveReq.Status = string(next)
+	leaveReq.CancellationReason = req.Reason
+
+	var hrLink *models.ApprovalLink
+	if next == workflow.StateCancelled {
+		now := time.Now()
+		leaveReq.CancelledAt = &now
+		leaveReq.RequestToken = nil
+		leaveReq.HRToken = nil
+		leaveReq.MDToken = nil
+	} else {
+		if leaveReq.HREmail == "" {
+			respondError(w, http.StatusConflict, "no HR contact is recorded on this request")
+			return
+		}
+		hrToken := uuid.New().String()
+		leaveReq.HRToken = &hrToken
+		hrLink = newLink(leaveReq.ID, models.LinkCancellation, leaveReq.HREmail, hrToken)
+	}
+
+	entry := auditEntry(r, leaveReq.ID, userEmail, auditStageStaff, string(workflow.DecisionWithdrawn), req.Reason)
+	if next == workflow.StateCancellationRequested {
+		entry.ForwardedTo = leaveReq.HREmail
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := saveTransition(tx, &leaveReq, from); err != nil {
+			return err
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+		if next != workflow.StateCancelled {
+			if err := issueLink(tx, hrLink); err != nil {
+				return err
+			}
+			notify := service.CancellationRequestEmail(linkRecipient(hrLink), leaveReq, signedToken(hrLink))
+			return outbox.Enqueue(tx, leaveReq.ID, notify)
+		}
+		if err := revokeLinks(tx, leaveReq.ID); err != nil {
+			return err
+		}
+		// Undecided chain stages lose their links too
+		err := tx.Model(&models.LeaveRequestStage{}).
+			Where("leave_request_id = ? AND decision = ''", leaveReq.ID).
+			Update("token", nil).Error
+		if err != nil || approverEmail == "" {
+			return err
+		}
+		notify := service.WithdrawalNoticeEmail(approverEmail, leaveReq)
+		return outbox.Enqueue(tx, leaveReq.ID, notify)
+	})
+	if err != nil {
+		log.Printf("[ERROR] Failed to cancel request %d: %v", leaveReq.ID, err)
+		respondSaveError(w, err, ErrSaveAction)
+		return
+	}
+	outbox.Wake()
+
+	if next == workflow.StateCancellationRequested {
+		log.Printf("[INFO] Cancellation of approved request %d requested by %s", leaveReq.ID, userEmail)
+		respondJSON(w, http.StatusOK, map[string]string{
+			"message":   "Cancellation requested. HR will confirm before your balance is restored.",
+			"status":    leaveReq.Status,
+			"reference": leaveReq.Reference(),
+		})
+		return
+	}
+
+	log.Printf("[INFO] Request %d withdrawn by %s", leaveReq.ID, userEmail)
+
+	respondJSON(w, http.StatusOK, map[string]string{
+		"message":   "Leave request withdrawn.",
+		"status":    leaveReq.Status,
+		"reference": leaveReq.Reference(),
+	})
+}
+
+// GetCancellationDetails retrieves an approved leave awaiting HR's confirmation of its cancellation.
+//
+// Query params:
+// - token: The HR token issued with the cancellation request (required)
+func GetCancellationDetails(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodGet) {
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	if !validateToken(w, token) {
+		return
+	}
+
+	_, leaveReq, ok := requestByLink(w, token, models.LinkCancellation)
+	if !ok {
+		return
+	}
+	if workflow.State(leaveReq.Status) != workflow.StateCancellationRequested {
+		log.Printf("[ERROR] Invalid cancellation token: %s", token)
+		respondError(w, http.StatusNotFound, ErrTokenNotFound)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, buildLeaveDetails(database.DB, leaveReq))
+}
+
+// HandleCancellationAction records HR's decision on the cancellation of an approved leave.
+//
+// Request body:
+// - token: HR cancellation token (required)
+// - status: "Approved" to cancel the leave, "Rejected" to keep it (required)
+// - reason: Required if rejected
+//
+// Confirming restores the days to the staff member's balance.
+func HandleCancellationAction(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodPost) {
+		return
+	}
+
+	var req CancellationActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, ErrInvalidJSON)
+		return
+	}
+
+	link, leaveReq, ok := requestByLink(w, req.Token, models.LinkCancellation)
+	if !ok || !checkLinkCode(w, link, req.Code) {
+		return
+	}
+
+	outcome, err := decideCancellation(r, link, leaveReq, req)
+	respondDecision(w, outcome, err)
+}
+
+// decideCancellation records HR's decision on the cancellation of leaveReq,
+// made through link. It is shared by the approval link and the approver inbox.
+func decideCancellation(r *http.Request, link models.ApprovalLink, leaveReq models.LeaveRequest, req CancellationActionRequest) (decisionOutcome, error) {
+	if workflow.State(leaveReq.Status) != workflow.StateCancellationRequested {
+		log.Printf("[ERROR] Cancellation link for request %d used while it is %q", leaveReq.ID, leaveReq.Status)
+		return decisionOutcome{}, refuseDecision(http.StatusNotFound, ErrTokenNotFound)
+	}
+
+	status, err := parseDecision(req.Status, req.Reason)
+	if err != nil {
+		return decisionOutcome{}, err
+	}
+	var decision workflow.Decision
+	switch status {
+	case workflow.DecisionApproved:
+		decision = workflow.DecisionCancellationConfirmed
+	case workflow.DecisionRejected:
+		decision = workflow.DecisionCancellationDeclined
+	default:
+		return decisionOutcome{}, refuseDecision(http.StatusBadRequest, `status must be "Approved" or "Rejected"`)
+	}
+
+	from := workflow.State(leaveReq.Status)
+	next, err := workflow.Transition(from, workflow.ActorHR, decision)
+	if err != nil {
+		return decisionOutcome{}, transitionRefused(leaveReq.ID, err)
+	}
+
+	leaveReq.Status = string(next)
+	leaveReq.HRToken = nil
+	confirmed := decision == workflow.DecisionCancellationConfirmed
+	entry := linkAuditEntry(r, link, auditStageCancellation, string(decision), req.Reason)
+	if confirmed {
+		now := time.Now()
+		leaveReq.CancelledAt = &now
+	}
+
+	notify := service.CancellationOutcomeEmail(leaveReq, confirmed, req.Reason)
+	if err := saveDecision(database.DB, &leaveReq, from, link, nil, entry, notify); err != nil {
+		log.Printf("[ERROR] Failed to save cancellation decision for request %d: %v", leaveReq.ID, err)
+		return decisionOutcome{}, actionSaveError(err, ErrSaveAction)
+	}
+
+	message := "Cancellation confirmed. The leave balance has been restored."
+	if !confirmed {
+		message = "Cancellation declined. The leave remains approved."
+	}
+
+	log.Printf("[INFO] HR decision %q on cancellation of request %d", decision, leaveReq.ID)
+
+	return decisionOutcome{Message: message, Status: leaveReq.Status}, nil
+}
@@ -0,0 +1,434 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/database"
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"github.com/JpUnique/petrodata-leave-project/pkg/outbox"
+	"github.com/JpUnique/petrodata-leave-project/pkg/service"
+	"github.com/JpUnique/petrodata-leave-project/pkg/workflow"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// CONFIGURABLE APPROVAL CHAINS
+// ============================================================================
+
+// StageActionRequest represents an approver's decision on one stage of a configured chain.
+type StageActionRequest struct {
+	Token             string `json:"token"`
+	Status            string `json:"status"`                        // "Approved" or "Rejected"
+	NextApproverEmail string `json:"next_approver_email,omitempty"` // Required if the next stage has no fixed approver
+	Reason            string `json:"reason,omitempty"`              // Required if rejected
+	Code              string `json:"code,omitempty"`                // Required when approvers must confirm their email
+	Signature         string `json:"signature,omitempty"`           // Optional PNG data URL
+}
+
+// stageDetailsResponse is the leave request together with its chain stages.
+type stageDetailsResponse struct {
+	leaveDetailsResponse
+	Stage             models.LeaveRequestStage   `json:"stage"`
+	Stages            []models.LeaveRequestStage `json:"stages"`
+	NextStageName     string                     `json:"next_stage_name,omitempty"`
+	NeedsNextApprover bool                       `json:"needs_next_approver"`
+}
+
+// resolveApprovalChain returns the highest-priority active chain matching the
+// request, or nil if the built-in flow applies.
+func resolveApprovalChain(db *gorm.DB, department, leaveType string, totalDays int) (*models.ApprovalChain, error) {
+	var chain models.ApprovalChain
+	err := db.Preload("Stages", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	}).
+		Where("active = ?", true).
+		Where("department = '' OR department ILIKE ?", strings.TrimSpace(department)).
+		Where("leave_type = '' OR leave_type ILIKE ?", strings.TrimSpace(leaveType)).
+		Where("min_days <= ? AND (max_days = 0 OR max_days >= ?)", totalDays, totalDays).
+		Order("priority DESC, department DESC, leave_type DESC, id ASC").
+		First(&chain).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(chain.Stages) == 0 {
+		log.Printf("[WARN] Approval chain %d (%s) has no stages, using built-in flow", chain.ID, chain.Name)
+		return nil, nil
+	}
+	return &chain, nil
+}
+
+// createRequestStages copies the chain's stages onto leaveReq and issues the
+// first stage's token. The first stage falls back to the staff-supplied manager email.
+func createRequestStages(tx *gorm.DB, leaveReq *models.LeaveRequest, chain *models.ApprovalChain) (models.LeaveRequestStage, error) {
+	var first models.LeaveRequestStage
+	for i, cs := range chain.Stages {
+		stage := models.LeaveRequestStage{
+			LeaveRequestID: leaveReq.ID,
+			Position:       i + 1,
+			Name:           cs.Name,
+			ApproverEmail:  cs.ApproverEmail,
+		}
+		if i == 0 {
+			if stage.ApproverEmail == "" {
+				stage.ApproverEmail = leaveReq.ManagerEmail
+			}
+			token := uuid.New().String()
+			stage.Token = &token
+		}
+		if err := tx.Create(&stage).Error; err != nil {
+			return first, err
+		}
+		if i == 0 {
+			first = stage
+		}
+	}
+	return first, nil
+}
+
+// loadRequestStages returns the stages of a chain request in order.
+func loadRequestStages(db *gorm.DB, requestID uint) ([]models.LeaveRequestStage, error) {
+	var stages []models.LeaveRequestStage
+	err := db.Where("leave_request_id = ?", requestID).Order("position ASC").Find(&stages).Error
+	return stages, err
+}
+
+// GetLeaveRequestByStageToken retrieves a chain request using a stage token.
+// This is called by the generic approval page for any configured stage.
+//
+// Query params:
+// - token: The stage token (required)
+//
+// Returns: LeaveRequest with the current stage and the full stage list
+func GetLeaveRequestByStageToken(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodGet) {
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	if !validateToken(w, token) {
+		return
+	}
+
+	link, leaveReq, ok := requestByLink(w, token, models.LinkStage)
+	if !ok {
+		return
+	}
+
+	var stage models.LeaveRequestStage
+	if err := database.DB.Where("token = ?", link.Token).First(&stage).Error; err != nil {
+		log.Printf("[ERROR] Invalid stage token: %s", token)
+		respondError(w, http.StatusNotFound, ErrTokenNotFound)
+		return
+	}
+
+	stages, err := loadRequestStages(database.DB, leaveReq.ID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load stages for request %d: %v", leaveReq.ID, err)
+		respondError(w, http.StatusInternalServerError, ErrRequestNotFound)
+		return
+	}
+
+	resp := stageDetailsResponse{
+		leaveDetailsResponse: buildLeaveDetails(database.DB, leaveReq),
+		Stage:                stage,
+		Stages:               stages,
+	}
+	if stage.Position < len(stages) {
+		next := stages[stage.Position]
+		resp.NextStageName = next.Name
+		resp.NeedsNextApprover = next.ApproverEmail == ""
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// HandleStageAction processes a decision on the current stage of a configured chain.
+//
+// Request body:
+// - token: Stage token (required)
+// - status: "Approved" or "Rejected" (required)
+// - next_approver_email: Approver for the next stage (required if that stage has none configured)
+// - reason: Rejection reason (required if status is "Rejected")
+// - signature: Approver signature as a PNG data URL (optional)
+//
+// Approving the last stage fully approves the request and notifies the archive
+// recipient; rejecting at any stage ends the workflow and notifies the staff.
+func HandleStageAction(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodPost) {
+		return
+	}
+
+	var req StageActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("[ERROR] Failed to decode stage action request: %v", err)
+		respondError(w, http.StatusBadRequest, ErrInvalidJSON)
+		return
+	}
+
+	link, leaveReq, ok := requestByLink(w, req.Token, models.LinkStage)
+	if !ok || !checkLinkCode(w, link, req.Code) {
+		return
+	}
+
+	outcome, err := decideStage(r, link, leaveReq, req)
+	respondDecision(w, outcome, err)
+}
+
+// decideStage records a decision on the current chain stage of leaveReq, made
+// through link. It is shared by the stage link and the approver inbox.
+func decideStage(r *http.Request, link models.ApprovalLink, leaveReq models.LeaveRequest, req StageActionRequest) (decisionOutcome, error) {
+	decision, err := parseDecision(req.Status, req.Reason)
+	if err != nil {
+		return decisionOutcome{}, err
+	}
+	if err := checkSignature(req.Signature, false); err != nil {
+		return decisionOutcome{}, err
+	}
+
+	var stage models.LeaveRequestStage
+	if err := database.DB.Where("token = ?", link.Token).First(&stage).Error; err != nil {
+		log.Printf("[ERROR] Leave request not found for stage link %d", link.ID)
+		return decisionOutcome{}, refuseDecision(http.StatusNotFound, ErrRequestNotFound)
+	}
+
+	if stage.Position != leaveReq.CurrentStage || stage.Decision != "" {
+		return decisionOutcome{}, refuseDecision(http.StatusConflict, "this stage has already been decided")
+	}
+
+	stages, err := loadRequestStages(database.DB, leaveReq.ID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load stages for request %d: %v", leaveReq.ID, err)
+		return decisionOutcome{}, refuseDecision(http.StatusInternalServerError, ErrSaveAction)
+	}
+	last := stage.Position == len(stages)
+
+	from := workflow.State(leaveReq.Status)
+	next, err := workflow.TransitionStage(from, decision, last)
+	if err != nil {
+		return decisionOutcome{}, transitionRefused(leaveReq.ID, err)
+	}
+
+	// Work out who the next stage goes to before touching the database
+	var nextStage *models.LeaveRequestStage
+	var nextLink *models.ApprovalLink
+	if decision == workflow.DecisionApproved && !last {
+		nextStage = &stages[stage.Position]
+		if nextStage.ApproverEmail == "" {
+			if req.NextApproverEmail == "" {
+				return decisionOutcome{}, refuseDecision(http.StatusBadRequest, "next_approver_email is required for approval")
+			}
+			nextStage.ApproverEmail = req.NextApproverEmail
+		}
+		token := uuid.New().String()
+		nextStage.Token = &token
+		nextLink = newLink(leaveReq.ID, models.LinkStage, nextStage.ApproverEmail, token)
+	}
+
+	now := time.Now()
+	stage.Decision = string(decision)
+	stage.Reason = req.Reason
+	stage.DecidedAt = &now
+	stage.Token = nil
+
+	leaveReq.Status = string(next)
+	if nextStage != nil {
+		leaveReq.CurrentStage = nextStage.Position
+	}
+	if next == workflow.StateFullyApproved {
+		finalToken := uuid.New().String()
+		leaveReq.FinalHRToken = &finalToken
+		leaveReq.RecordPending = true
+		if leaveReq.HREmail == "" {
+			leaveReq.HREmail = stage.ApproverEmail
+		}
+		nextLink = newLink(leaveReq.ID, models.LinkFinal, leaveReq.HREmail, finalToken)
+	}
+
+	entry := linkAuditEntry(r, link, stage.Name, string(decision), req.Reason)
+	entry.Signature = req.Signature
+	if nextLink != nil {
+		entry.ForwardedTo = nextLink.ApproverEmail
+	}
+
+	var notify service.Message
+	switch {
+	case nextStage != nil:
+		notify = service.StageRequestEmail(linkRecipient(nextLink), leaveReq, nextStage.Name, signedToken(nextLink))
+	case next == workflow.StateFullyApproved:
+		notify = service.FinalArchiveEmail(linkRecipient(nextLink), leaveReq, signedToken(nextLink))
+	default:
+		notify = service.RejectionEmail(leaveReq, stage.Name, req.Reason)
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := consumeLink(tx, link); err != nil {
+			return err
+		}
+		if err := saveTransition(tx, &leaveReq, from); err != nil {
+			return err
+		}
+		if err := tx.Save(&stage).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+		if nextStage != nil {
+			if err := tx.Save(nextStage).Error; err != nil {
+				return err
+			}
+		}
+		if nextLink != nil {
+			if err := issueLink(tx, nextLink); err != nil {
+				return err
+			}
+		}
+		return outbox.Enqueue(tx, leaveReq.ID, notify)
+	})
+	if err != nil {
+		log.Printf("[ERROR] Failed to save %s decision: %v", stage.Name, err)
+		return decisionOutcome{}, actionSaveError(err, ErrSaveAction)
+	}
+	outbox.Wake()
+
+	switch {
+	case nextStage != nil:
+		log.Printf("[INFO] %s approved request for %s, forwarded to %s", stage.Name, leaveReq.StaffName, nextStage.Name)
+		return decisionOutcome{
+			Message: "Request approved and forwarded to " + nextStage.Name + ".",
+			Status:  leaveReq.Status,
+		}, nil
+
+	case next == workflow.StateFullyApproved:
+		wakeRecordWorker()
+		log.Printf("[INFO] %s approved request for %s, workflow complete", stage.Name, leaveReq.StaffName)
+		return decisionOutcome{
+			Message: "Leave request fully approved. HR has been notified.",
+			Status:  leaveReq.Status,
+		}, nil
+
+	default:
+		log.Printf("[INFO] %s rejected request for %s, staff notified", stage.Name, leaveReq.StaffName)
+		return decisionOutcome{
+			Message: "Request rejected. Staff has been notified.",
+			Status:  leaveReq.Status,
+		}, nil
+	}
+}
+
+// ============================================================================
+// APPROVAL CHAIN ADMINISTRATION
+// ============================================================================
+
+// ApprovalChains serves /api/admin/approval-chains: GET lists chains, POST saves one.
+func ApprovalChains(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		ListApprovalChains(w, r)
+		return
+	}
+	SaveApprovalChain(w, r)
+}
+
+// ListApprovalChains returns every configured approval chain with its stages.
+func ListApprovalChains(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodGet) {
+		return
+	}
+
+	var chains []models.ApprovalChain
+	err := database.DB.Preload("Stages", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	}).Order("priority DESC, id ASC").Find(&chains).Error
+	if err != nil {
+		log.Printf("[ERROR] Failed to list approval chains: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to list approval chains")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, chains)
+}
+
+// SaveApprovalChain creates a chain, or replaces an existing one when id is set
+// (404 if there is no such chain). Stage positions follow the order of the
+// stages array. A chain is active unless active is sent as false.
+func SaveApprovalChain(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodPost) {
+		return
+	}
+
+	var body struct {
+		models.ApprovalChain
+		Active *bool `json:"active"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondError(w, http.StatusBadRequest, ErrInvalidJSON)
+		return
+	}
+	chain := body.ApprovalChain
+	chain.Active = body.Active == nil || *body.Active
+
+	if strings.TrimSpace(chain.Name) == "" || len(chain.Stages) == 0 {
+		respondError(w, http.StatusBadRequest, "name and at least one stage are required")
+		return
+	}
+	if chain.MaxDays != 0 && chain.MaxDays < chain.MinDays {
+		respondError(w, http.StatusBadRequest, "max_days must be 0 or not less than min_days")
+		return
+	}
+	for i := range chain.Stages {
+		if strings.TrimSpace(chain.Stages[i].Name) == "" {
+			respondError(w, http.StatusBadRequest, "every stage needs a name")
+			return
+		}
+		chain.Stages[i].ID = 0
+		chain.Stages[i].Position = i + 1
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		stages := chain.Stages
+		chain.Stages = nil
+		if chain.ID == 0 {
+			chain.CreatedAt = time.Now()
+			if err := tx.Create(&chain).Error; err != nil {
+				return err
+			}
+		} else {
+			var existing models.ApprovalChain
+			if err := tx.Select("id").First(&existing, chain.ID).Error; err != nil {
+				return err
+			}
+			if err := tx.Select("*").Omit("created_at").Updates(&chain).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("chain_id = ?", chain.ID).Delete(&models.ApprovalChainStage{}).Error; err != nil {
+				return err
+			}
+		}
+		for i := range stages {
+			stages[i].ChainID = chain.ID
+		}
+		chain.Stages = stages
+		return tx.Create(&chain.Stages).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		respondError(w, http.StatusNotFound, "approval chain not found")
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to save approval chain %q: %v", chain.Name, err)
+		respondError(w, http.StatusInternalServerError, "failed to save approval chain")
+		return
+	}
+
+	log.Printf("[INFO] Approval chain %q saved with %d stages", chain.Name, len(chain.Stages))
+	respondJSON(w, http.StatusOK, chain)
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/database"
+	"github.com/JpUnique/petrodata-leave-project/pkg/ledger"
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"github.com/JpUnique/petrodata-leave-project/pkg/outbox"
+	"github.com/JpUnique/petrodata-leave-project/pkg/service"
+	"github.com/JpUnique/petrodata-leave-project/pkg/utils"
+	"github.com/JpUnique/petrodata-leave-project/pkg/workflow"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// RETURN FOR CORRECTION
+// ============================================================================
+
+// AmendLeaveRequestBody represents a staff member correcting a request that
+// was returned to them. Fields left empty keep their current value.
+type AmendLeaveRequestBody struct {
+	ID                    uint   `json:"id"`
+	Designation           string `json:"designation,omitempty"`
+	Department            string `json:"department,omitempty"`
+	DateEmployed          string `json:"date_employed,omitempty"`
+	PhoneNumber           string `json:"phone_number,omitempty"`
+	LeaveAllowanceRequest *bool  `json:"leave_allowance_request,omitempty"`
+	LeaveType             string `json:"leave_type,omitempty"`
+	StartDate             string `json:"start_date,omitempty"`
+	ResumptionDate        string `json:"resumption_date,omitempty"`
+	TotalDays             int    `json:"total_days,omitempty"`
+	ReliefStaff           string `json:"relief_staff,omitempty"`
+	ContactAddress        string `json:"contact_address,omitempty"`
+	SupportingDocument    string `json:"supporting_document,omitempty"` // Replaces the attached document
+	Note                  string `json:"note,omitempty"`                // What was changed, for the reviewer
+}
+
+// returnForCorrection saves a decision sending leaveReq back to the staff
+// member and tells them what returnedBy wants corrected.
+func returnForCorrection(leaveReq *models.LeaveRequest, from workflow.State, link models.ApprovalLink, entry models.ApprovalAction, returnedBy, comments string) (decisionOutcome, error) {
+	entry.ForwardedTo = leaveReq.StaffEmail
+
+	notify := service.ReturnedEmail(*leaveReq, returnedBy, comments)
+	if err := saveDecision(database.DB, leaveReq, from, link, nil, entry, notify); err != nil {
+		log.Printf("[ERROR] Failed to return request %d for correction: %v", leaveReq.ID, err)
+		return decisionOutcome{}, actionSaveError(err, ErrSaveAction)
+	}
+
+	log.Printf("[INFO] %s returned request for %s for correction", returnedBy, leaveReq.StaffName)
+
+	return decisionOutcome{
+		Message: "Request returned to the staff for correction.",
+		Status:  leaveReq.Status,
+	}, nil
+}
+
+// resubmissionLink reopens the step a returned request re-enters at (next):
+// the step's decision is cleared and a new link issued to its approver. It
+// returns the link and the approver's notification.
+func resubmissionLink(leaveReq *models.LeaveRequest, next workflow.State) (*models.ApprovalLink, service.Message) {
+	token := uuid.New().String()
+	switch next {
+	case workflow.StatePendingHRReview:
+		leaveReq.HRDecision = ""
+		leaveReq.HRToken = &token
+		link := newLink(leaveReq.ID, models.LinkHR, leaveReq.HREmail, token)
+		return link, service.HRRequestEmail(linkRecipient(link), *leaveReq, signedToken(link))
+	case workflow.StatePendingMDApproval:
+		leaveReq.MDDecision = ""
+		leaveReq.MDToken = &token
+		link := newLink(leaveReq.ID, models.LinkMD, leaveReq.MDEmail, token)
+		return link, service.MDRequestEmail(linkRecipient(link), *leaveReq, signedToken(link))
+	}
+	leaveReq.ManagerDecision = ""
+	leaveReq.RequestToken = &token
+	link := newLink(leaveReq.ID, models.LinkManager, leaveReq.ManagerEmail, token)
+	return link, service.ManagerRequestEmail(linkRecipient(link), *leaveReq, signedToken(link))
+}
+
+// AmendLeaveRequest lets the authenticated staff member correct a request an
+// approver returned to them and resubmit it. The request keeps its ID and
+// history and goes back to the step that returned it; approvals already given
+// at earlier steps stand.
+//
+// Request body:
+// - id: Leave request ID (required)
+// - designation, department, date_employed, phone_number, leave_allowance_request,
+// leave_type, start_date, resumption_date, total_days, relief_staff, contact_address (optional)
+// - supporting_document: PDF, PNG or JPEG data URL replacing the attached one (optional)
+// - note: What was changed, recorded in the audit trail (optional)
+//
+// Dates are validated, working days recounted and the leave type rules
+// applied as on submission, and the reserved days are moved to the amended
+// leave type, year and length. A start date left unchanged is checked as of
+// the original submission, so it is not refused for having passed.
+func AmendLeaveRequest(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodPost) {
+		return
+	}
+
+	userEmail, ok := r.Context().Value("userEmail").(string)
+	if !ok || userEmail == "" {
+		respondError(w, http.StatusUnauthorized, "Unauthorized: email not found in session")
+		return
+	}
+	userEmail = utils.NormalizeEmail(userEmail)
+
+	var req AmendLeaveRequestBody
+	if !decodeLeaveRequestBody(w, r, &req, ErrInvalidJSON) {
+		return
+	}
+
+	var leaveReq models.LeaveRequest
+	if err := database.DB.Where("id = ? AND staff_email = ?", req.ID, userEmail).First(&leaveReq).Error; err != nil {
+		respondError(w, http.StatusNotFound, ErrRequestNotFound)
+		return
+	}
+
+	from := workflow.State(leaveReq.Status)
+	next, err := workflow.Transition(from, workflow.ActorStaff, workflow.DecisionResubmitted)
+	if err != nil {
+		respondTransitionError(w, leaveReq.ID, err)
+		return
+	}
+
+	var staff models.StaffRecord
+	if err := database.DB.Where("email ILIKE ?", userEmail).First(&staff).Error; err != nil {
+		log.Printf("[WARN] Staff record not found for policy check: %s", userEmail)
+		respondError(w, http.StatusForbidden, "You are not valid for a Leave. Please contact HR.")
+		return
+	}
+
+	leaveType, err := findLeaveType(database.DB, orDefault(req.LeaveType, leaveReq.LeaveType))
+	if err != nil {
+		respondLeaveTypeError(w, err, ErrSaveAction)
+		return
+	}
+
+	// A start date kept from the original request is checked against the day
+	// it was submitted, so a request returned after it started can still be
+	// corrected without moving its dates
+	start := orDefault(req.StartDate, leaveReq.StartDate.String())
+	submitted := models.Today()
+	if start == leaveReq.StartDate.String() {
+		submitted = models.NewDate(leaveReq.CreatedAt)
+	}
+	dates, err := parseLeaveDates(
+		start,
+		orDefault(req.ResumptionDate, leaveReq.ResumptionDate.String()),
+		orDefault(req.DateEmployed, leaveReq.DateEmployed.String()),
+		submitted,
+	)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	totalDays, resumption, ok := countLeaveDays(w, dates, req.TotalDays)
+	if !ok {
+		return
+	}
+
+	var document []byte
+	var documentExt string
+	if req.SupportingDocument != "" {
+		if document, documentExt, err = decodeSupportingDocument(req.SupportingDocument); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	hasDocument := document != nil || leaveReq.SupportingDocumentKey != ""
+	if err := checkLeaveTypeRules(leaveType, staff, dates, totalDays, hasDocument); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	overlaps, err := findOverlaps(database.DB, userEmail, dates.Start, resumption, leaveReq.ID)
+	if err != nil {
+		log.Printf("[ERROR] Overlap check failed for %s: %v", userEmail, err)
+		respondError(w, http.StatusInternalServerError, ErrSaveAction)
+		return
+	}
+	if len(overlaps) > 0 {
+		respondError(w, http.StatusConflict, overlapMessage(overlaps))
+		return
+	}
+
+	if document != nil {
+		key, err := storeSupportingDocument(document, documentExt)
+		if err != nil {
+			log.Printf("[ERROR] Failed to store supporting document of request %d: %v", leaveReq.ID, err)
+			respondError(w, http.StatusInternalServerError, ErrSaveAction)
+			return
+		}
+		leaveReq.SupportingDocumentKey = key
+	}
+
+	reserved, reservedDays := balanceKey(&leaveReq), leaveReq.TotalDays
+
+	leaveReq.Designation = orDefault(req.Designation, leaveReq.Designation)
+	leaveReq.Department = orDefault(req.Department, leaveReq.Department)
+	leaveReq.PhoneNumber = orDefault(req.PhoneNumber, leaveReq.PhoneNumber)
+	leaveReq.LeaveType = leaveType.Name
+	leaveReq.BalanceType = leaveType.BalanceType()
+	leaveReq.ReliefStaff = orDefault(req.ReliefStaff, leaveReq.ReliefStaff)
+	leaveReq.ContactAddress = orDefault(req.ContactAddress, leaveReq.ContactAddress)
+	if req.LeaveAllowanceRequest != nil {
+		leaveReq.LeaveAllowanceRequest = *req.LeaveAllowanceRequest
+	}
+	leaveReq.DateEmployed = dates.Employed
+	leaveReq.StartDate = dates.Start
+	leaveReq.ResumptionDate = resumption
+	leaveReq.TotalDays = totalDays
+	leaveReq.BalanceYear = dates.Start.Year()
+	leaveReq.Status = string(next)
+
+	link, notify := resubmissionLink(&leaveReq, next)
+	entry := auditEntry(r, leaveReq.ID, userEmail, auditStageStaff, string(workflow.DecisionResubmitted), req.Note)
+	entry.ForwardedTo = link.Principal()
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Swap the reservation for one matching the amended request
+		if err := ledger.Move(tx, reserved, reservedDays, ledger.Reserved, ledger.None); err != nil {
+			return err
+		}
+		if err := ledger.Reserve(tx, balanceKey(&leaveReq), leaveReq.TotalDays); err != nil {
+			return err
+		}
+		if err := saveTransition(tx, &leaveReq, from); err != nil {
+			return err
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+		if err := issueLink(tx, link); err != nil {
+			return err
+		}
+		return outbox.Enqueue(tx, leaveReq.ID, notify)
+	})
+	var balanceErr *ledger.InsufficientBalanceError
+	if errors.As(err, &balanceErr) {
+		respondError(w, http.StatusBadRequest, balanceErr.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to resubmit request %d: %v", leaveReq.ID, err)
+		respondSaveError(w, err, ErrSaveAction)
+		return
+	}
+	outbox.Wake()
+
+	log.Printf("[INFO] Request %d amended by %s and resubmitted to %s", leaveReq.ID, userEmail, link.Principal())
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"message":    "Leave request amended and resubmitted to " + link.Principal() + ".",
+		"reference":  leaveReq.Reference(),
+		"status":     leaveReq.Status,
+		"total_days": leaveReq.TotalDays,
+		"resumption": leaveReq.ResumptionDate,
+	})
+}
+
+// orDefault returns s, or def if s is empty.
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/calendar"
+	"github.com/JpUnique/petrodata-leave-project/pkg/database"
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ============================================================================
+// TEAM COVERAGE
+// ============================================================================
+
+// coverageSummary tells an approver who else in the department is away during
+// the requested period.
+type coverageSummary struct {
+	Department         string         `json:"department"`
+	OthersOnLeave      []leaveSummary `json:"others_on_leave"`
+	ReliefStaffOnLeave bool           `json:"relief_staff_on_leave"`
+	ReliefStaffLeave   []leaveSummary `json:"relief_staff_leave,omitempty"`
+	Headcount          int            `json:"headcount,omitempty"`   // From the department's staffing rule
+	MinOnDuty          int            `json:"min_on_duty,omitempty"` // From the department's staffing rule
+	OnDuty             *int           `json:"on_duty,omitempty"`     // Staff left on duty on the busiest day if this leave is approved
+	BusiestDay         *models.Date   `json:"busiest_day,omitempty"` // Working day with the most others away
+	HardWarning        bool           `json:"hard_warning"`          // Approving would break the staffing rule
+	Warnings           []string       `json:"warnings"`
+}
+
+// buildCoverage summarizes department coverage for leaveReq's dates.
+func buildCoverage(db *gorm.DB, leaveReq models.LeaveRequest) (coverageSummary, error) {
+	cov := coverageSummary{
+		Department:    leaveReq.Department,
+		OthersOnLeave: []leaveSummary{},
+		Warnings:      []string{},
+	}
+
+	department := strings.TrimSpace(leaveReq.Department)
+	if department != "" {
+		var others []models.LeaveRequest
+		err := activeLeavesBetween(db, leaveReq.StartDate, leaveReq.ResumptionDate).
+			Where("department ILIKE ? AND staff_email <> ?", department, leaveReq.StaffEmail).
+			Order("start_date ASC").
+			Find(&others).Error
+		if err != nil {
+			return cov, err
+		}
+
+		away := make(map[string]bool)
+		for _, o := range others {
+			cov.OthersOnLeave = append(cov.OthersOnLeave, summarizeLeave(o))
+			away[o.StaffEmail] = true
+		}
+		if len(away) > 0 {
+			cov.Warnings = append(cov.Warnings, fmt.Sprintf("%d other staff in %s are on leave during this period", len(away), department))
+		}
+
+		var rule models.StaffingRule
+		err = db.Where("department ILIKE ?", department).First(&rule).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return cov, err
+		}
+		if err == nil && rule.Headcount > 0 {
+			cal, err := calendar.LoadRange(db, leaveReq.StartDate.Time, leaveReq.ResumptionDate.Time)
+			if err != nil {
+				return cov, err
+			}
+			peak, busiest := peakAway(cal, leaveReq.StartDate, leaveReq.ResumptionDate, others)
+			onDuty := rule.Headcount - peak - 1
+			cov.Headcount, cov.MinOnDuty, cov.OnDuty = rule.Headcount, rule.MinOnDuty, &onDuty
+			if peak > 0 {
+				cov.BusiestDay = &busiest
+			}
+			if onDuty < rule.MinOnDuty {
+				cov.HardWarning = true
+				cov.Warnings = append(cov.Warnings, fmt.Sprintf("Approving leaves %d of %d staff on duty in %s on %s, below the minimum of %d", max(onDuty, 0), rule.Headcount, department, busiest, rule.MinOnDuty))
+			}
+		}
+	}
+
+	relief := strings.TrimSpace(leaveReq.ReliefStaff)
+	if relief != "" {
+		var reliefLeaves []models.LeaveRequest
+		err := activeLeavesBetween(db, leaveReq.StartDate, leaveReq.ResumptionDate).
+			Where("staff_name ILIKE ? OR staff_email ILIKE ?", relief, relief).
+			Find(&reliefLeaves).Error
+		if err != nil {
+			return cov, err
+		}
+		for _, l := range reliefLeaves {
+			cov.ReliefStaffLeave = append(cov.ReliefStaffLeave, summarizeLeave(l))
+		}
+		if len(reliefLeaves) > 0 {
+			cov.ReliefStaffOnLeave = true
+			cov.Warnings = append(cov.Warnings, fmt.Sprintf("Relief staff %s is also on leave during this period", relief))
+		}
+	}
+
+	return cov, nil
+}
+
+// peakAway returns the largest number of distinct staff in others away on a
+// single working day from start up to resumption, and the first day it
+// occurs. Leaves that touch the period without overlapping each other do not
+// add up.
+func peakAway(cal *calendar.Calendar, start, resumption models.Date, others []models.LeaveRequest) (int, models.Date) {
+	peak, busiest := 0, start
+	for d := start.Time; d.Before(resumption.Time); d = d.AddDate(0, 0, 1) {
+		if !cal.IsWorkingDay(d) {
+			continue
+		}
+		away := make(map[string]bool)
+		for _, o := range others {
+			if !d.Before(o.StartDate.Time) && d.Before(o.ResumptionDate.Time) {
+				away[o.StaffEmail] = true
+			}
+		}
+		if len(away) > peak {
+			peak, busiest = len(away), models.NewDate(d)
+		}
+	}
+	return peak, busiest
+}
+
+// ============================================================================
+// STAFFING RULE ADMINISTRATION
+// ============================================================================
+
+// StaffingRules serves /api/admin/staffing-rules: GET lists the rules, POST
+// creates or replaces the rule for a department.
+func StaffingRules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var rules []models.StaffingRule
+		if err := database.DB.Order("department ASC").Find(&rules).Error; err != nil {
+			log.Printf("[ERROR] Failed to list staffing rules: %v", err)
+			respondError(w, http.StatusInternalServerError, "failed to list staffing rules")
+			return
+		}
+		respondJSON(w, http.StatusOK, rules)
+
+	case http.MethodPost:
+		var rule models.StaffingRule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			respondError(w, http.StatusBadRequest, ErrInvalidJSON)
+			return
+		}
+		rule.Department = strings.TrimSpace(rule.Department)
+		if rule.Department == "" || rule.Headcount <= 0 || rule.MinOnDuty < 0 || rule.MinOnDuty > rule.Headcount {
+			respondError(w, http.StatusBadRequest, "department, headcount > 0 and 0 <= min_on_duty <= headcount are required")
+			return
+		}
+		rule.ID = 0
+		rule.UpdatedAt = time.Now()
+
+		err := database.DB.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "department"}},
+			DoUpdates: clause.AssignmentColumns([]string{"headcount", "min_on_duty", "updated_at"}),
+		}).Create(&rule).Error
+		if err != nil {
+			log.Printf("[ERROR] Failed to save staffing rule for %s: %v", rule.Department, err)
+			respondError(w, http.StatusInternalServerError, "failed to save staffing rule")
+			return
+		}
+
+		log.Printf("[INFO] Staffing rule for %s: %d of %d on duty", rule.Department, rule.MinOnDuty, rule.Headcount)
+		respondJSON(w, http.StatusOK, rule)
+
+	default:
+		respondError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/database"
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"github.com/JpUnique/petrodata-leave-project/pkg/service"
+	"github.com/JpUnique/petrodata-leave-project/pkg/utils"
+)
+
+// ============================================================================
+// DELEGATION (OUT OF OFFICE)
+// ============================================================================
+
+// DelegationRequest represents an approver handing their approvals to a
+// delegate while they are away.
+type DelegationRequest struct {
+	DelegateEmail string      `json:"delegate_email"`
+	StartsOn      models.Date `json:"starts_on"`
+	EndsOn        models.Date `json:"ends_on"` // Inclusive
+}
+
+// activeDelegate returns who receives links addressed to email today, or ""
+// if email has no delegation in force. Delegations are not followed further:
+// a delegate's own delegation does not apply to links they receive this way.
+func activeDelegate(email string) string {
+	var delegation models.Delegation
+	today := models.Today()
+	err := database.DB.
+		Where("principal_email = ? AND starts_on <= ? AND ends_on >= ?", email, today, today).
+		Order("created_at DESC").
+		Limit(1).
+		Find(&delegation).Error
+	if err != nil {
+		log.Printf("[ERROR] Failed to look up delegation for %s: %v", email, err)
+		return ""
+	}
+	return delegation.DelegateEmail
+}
+
+// linkRecipient addresses an approval email to whoever link was issued to,
+// copying the principal when that is a delegate.
+func linkRecipient(link *models.ApprovalLink) service.Recipient {
+	return service.Recipient{Email: link.ApproverEmail, OnBehalfOf: link.OnBehalfOf}
+}
+
+// Delegations serves /api/delegations for the signed-in approver: GET lists
+// their delegations, POST registers one and DELETE (with ?id=) removes one.
+func Delegations(w http.ResponseWriter, r *http.Request) {
+	userEmail, ok := r.Context().Value("userEmail").(string)
+	if !ok || userEmail == "" {
+		respondError(w, http.StatusUnauthorized, "Unauthorized: email not found in session")
+		return
+	}
+	principal := utils.NormalizeEmail(userEmail)
+
+	switch r.Method {
+	case http.MethodGet:
+		var delegations []models.Delegation
+		err := database.DB.Where("principal_email = ? AND ends_on >= ?", principal, models.Today()).
+			Order("starts_on ASC").Find(&delegations).Error
+		if err != nil {
+			log.Printf("[ERROR] Failed to list delegations of %s: %v", principal, err)
+			respondError(w, http.StatusInternalServerError, "failed to list delegations")
+			return
+		}
+		respondJSON(w, http.StatusOK, delegations)
+	case http.MethodPost:
+		createDelegation(w, r, principal)
+	case http.MethodDelete:
+		deleteDelegation(w, r, principal)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+	}
+}
+
+// createDelegation registers a delegation for principal.
+//
+// Request body:
+// - delegate_email: Who approves in the principal's place (required)
+// - starts_on: First day of the delegation, YYYY-MM-DD (required)
+// - ends_on: Last day of the delegation, YYYY-MM-DD (required)
+func createDelegation(w http.ResponseWriter, r *http.Request, principal string) {
+	var req DelegationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, ErrInvalidJSON)
+		return
+	}
+
+	delegate := utils.NormalizeEmail(req.DelegateEmail)
+	switch {
+	case delegate == "" || req.StartsOn.IsZero() || req.EndsOn.IsZero():
+		respondError(w, http.StatusBadRequest, "delegate_email, starts_on and ends_on are required")
+		return
+	case delegate == principal:
+		respondError(w, http.StatusBadRequest, "you cannot delegate to yourself")
+		return
+	case req.EndsOn.Before(req.StartsOn.Time):
+		respondError(w, http.StatusBadRequest, "ends_on cannot be before starts_on")
+		return
+	case req.EndsOn.Before(models.Today().Time):
+		respondError(w, http.StatusBadRequest, "ends_on cannot be in the past")
+		return
+	}
+
+	delegation := models.Delegation{
+		PrincipalEmail: principal,
+		DelegateEmail:  delegate,
+		StartsOn:       req.StartsOn,
+		EndsOn:         req.EndsOn,
+		CreatedAt:      time.Now(),
+	}
+	if err := database.DB.Create(&delegation).Error; err != nil {
+		log.Printf("[ERROR] Failed to save delegation of %s: %v", principal, err)
+		respondError(w, http.StatusInternalServerError, "failed to save delegation")
+		return
+	}
+
+	log.Printf("[INFO] %s delegated approvals to %s from %s to %s", principal, delegate, req.StartsOn, req.EndsOn)
+	respondJSON(w, http.StatusCreated, delegation)
+}
+
+// deleteDelegation removes one of principal's delegations. Links already
+// issued to the delegate keep working.
+func deleteDelegation(w http.ResponseWriter, r *http.Request, principal string) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "id is required")
+		return
+	}
+
+	result := database.DB.Where("principal_email = ?", principal).Delete(&models.Delegation{}, id)
+	if result.Error != nil {
+		log.Printf("[ERROR] Failed to delete delegation %d: %v", id, result.Error)
+		respondError(w, http.StatusInternalServerError, "failed to delete delegation")
+		return
+	}
+	if result.RowsAffected == 0 {
+		respondError(w, http.StatusNotFound, "delegation not found")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Delegation removed"})
+}
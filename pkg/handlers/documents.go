@@ -0,0 +1,427 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/database"
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"github.com/JpUnique/petrodata-leave-project/pkg/outbox"
+	"github.com/JpUnique/petrodata-leave-project/pkg/service"
+	"github.com/JpUnique/petrodata-leave-project/pkg/storage"
+	"github.com/JpUnique/petrodata-leave-project/pkg/workflow"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// LEAVE RECORD DOCUMENTS
+// ============================================================================
+
+// ErrDocumentNotFound is returned when a document ID matches no issued PDF.
+const ErrDocumentNotFound = "no leave record was issued with this document ID"
+
+// leaveVerification is what the public verification endpoint reveals about
+// the record behind a PDF: enough for security to check it, no contact details.
+type leaveVerification struct {
+	DocumentID          string      `json:"document_id"`
+	StatusAtIssue       string      `json:"status_at_issue"`
+	SHA256              string      `json:"sha256"`
+	GeneratedAt         time.Time   `json:"generated_at"`
+	Reference           string      `json:"reference"`
+	StaffNo             string      `json:"staff_no"`
+	LeaveType           string      `json:"leave_type"`
+	StartDate           models.Date `json:"start_date"`
+	ResumptionDate      models.Date `json:"resumption_date"`
+	TotalDays           int         `json:"total_days"`
+	Status              string      `json:"status"` // Current, authoritative status
+	Valid               bool        `json:"valid"`  // Only a fully approved leave is valid
+	CancellationPending bool        `json:"cancellation_pending"`
+	Cancelled           bool        `json:"cancelled"`
+	CancelledAt         *time.Time  `json:"cancelled_at,omitempty"`
+	ReissueOf           string      `json:"reissue_of,omitempty"`  // Lost document this one re-issues
+	ReplacedBy          string      `json:"replaced_by,omitempty"` // Document re-issued after this one's file was lost
+}
+
+// archivedRecord is one entry of the HR archive listing.
+type archivedRecord struct {
+	models.LeaveDocument
+	Reference string `json:"reference"`
+	PDFURL    string `json:"pdf_url"`
+}
+
+// archiveKey is where the archived record doc is stored.
+func archiveKey(doc models.LeaveDocument) string {
+	reference := models.LeaveRequest{ID: doc.LeaveRequestID}.Reference()
+	return fmt.Sprintf("%d/%s-%s.pdf", doc.Year, reference, doc.DocumentID)
+}
+
+// newLeaveDocument returns a new document ID for the record of leave.
+func newLeaveDocument(leave models.LeaveRequest) models.LeaveDocument {
+	year := leave.BalanceYear
+	if year == 0 {
+		year = leave.StartDate.Year()
+	}
+	return models.LeaveDocument{
+		DocumentID:     uuid.New().String(),
+		LeaveRequestID: leave.ID,
+		StaffNo:        leave.StaffNo,
+		StaffName:      leave.StaffName,
+		Year:           year,
+		StatusAtIssue:  leave.Status,
+		GeneratedAt:    time.Now(),
+	}
+}
+
+// storeLeaveRecord generates the record PDF of leave for doc, stores it and
+// fills in doc's hash, size and storage key.
+func storeLeaveRecord(db *gorm.DB, leave models.LeaveRequest, doc *models.LeaveDocument) ([]byte, error) {
+	trail, err := loadAuditTrail(db, leave.ID)
+	if err != nil {
+		return nil, fmt.Errorf("load audit trail: %w", err)
+	}
+	pdfBytes, err := service.GenerateLeavePDF(leave, trail, *doc)
+	if err != nil {
+		return nil, fmt.Errorf("generate PDF: %w", err)
+	}
+
+	sum := sha256.Sum256(pdfBytes)
+	doc.SHA256 = hex.EncodeToString(sum[:])
+	doc.Size = len(pdfBytes)
+	doc.StorageKey = archiveKey(*doc)
+	if err := storage.Archive.Put(doc.StorageKey, pdfBytes); err != nil {
+		return nil, fmt.Errorf("store %s: %w", doc.StorageKey, err)
+	}
+	return pdfBytes, nil
+}
+
+// archiveLeaveRecord generates the final record PDF of leave under a new
+// document ID, stores it and records its hash. If a concurrent call archived
+// the request first, that record is returned instead.
+func archiveLeaveRecord(db *gorm.DB, leave models.LeaveRequest) ([]byte, models.LeaveDocument, error) {
+	doc := newLeaveDocument(leave)
+	pdfBytes, err := storeLeaveRecord(db, leave, &doc)
+	if err != nil {
+		return nil, doc, err
+	}
+
+	if err := db.Create(&doc).Error; err != nil {
+		if existing, findErr := findArchivedRecord(db, leave.ID); findErr == nil {
+			return readArchivedRecord(existing)
+		}
+		return nil, doc, fmt.Errorf("record document: %w", err)
+	}
+	return pdfBytes, doc, nil
+}
+
+// findArchivedRecord returns the archived record document of a request.
+func findArchivedRecord(db *gorm.DB, requestID uint) (models.LeaveDocument, error) {
+	var doc models.LeaveDocument
+	err := db.Where("leave_request_id = ? AND storage_key <> ''", requestID).First(&doc).Error
+	return doc, err
+}
+
+// readArchivedRecord loads the stored PDF of doc.
+func readArchivedRecord(doc models.LeaveDocument) ([]byte, models.LeaveDocument, error) {
+	pdfBytes, err := storage.Archive.Get(doc.StorageKey)
+	if err != nil {
+		return nil, doc, fmt.Errorf("read %s: %w", doc.StorageKey, err)
+	}
+	return pdfBytes, doc, nil
+}
+
+// reissueArchivedRecord replaces lost, a record whose stored file has been
+// lost, with a record generated again under a new document ID. The hash
+// issued for lost is never changed, since copies of it must keep verifying
+// against what was issued; lost is marked as replaced instead, and becomes
+// the request's archived record no longer. If a concurrent call re-issued
+// the record first, that record is returned instead.
+func reissueArchivedRecord(db *gorm.DB, leave models.LeaveRequest, lost models.LeaveDocument) ([]byte, models.LeaveDocument, error) {
+	log.Printf("[WARN] Archived record %s of request %d is missing from storage, re-issuing it", lost.DocumentID, leave.ID)
+
+	doc := newLeaveDocument(leave)
+	doc.ReissueOf = lost.DocumentID
+	doc.EmailedAt = lost.EmailedAt // Re-issuing does not send the record again
+	pdfBytes, err := storeLeaveRecord(db, leave, &doc)
+	if err != nil {
+		return nil, doc, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.LeaveDocument{}).
+			Where("id = ? AND storage_key <> ''", lost.ID).
+			Updates(map[string]interface{}{"storage_key": "", "replaced_by": doc.DocumentID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errConcurrentUpdate
+		}
+		return tx.Create(&doc).Error
+	})
+	if errors.Is(err, errConcurrentUpdate) {
+		if existing, findErr := findArchivedRecord(db, leave.ID); findErr == nil {
+			return readArchivedRecord(existing)
+		}
+	}
+	if err != nil {
+		return nil, doc, fmt.Errorf("record document: %w", err)
+	}
+	log.Printf("[INFO] Re-issued archived record %s of request %d as %s", lost.DocumentID, leave.ID, doc.DocumentID)
+	return pdfBytes, doc, nil
+}
+
+// leaveRecord returns the archived record of a fully approved leave. Requests
+// approved before records were archived are archived on first download, and a
+// record whose file is missing from storage is re-issued.
+func leaveRecord(db *gorm.DB, leave models.LeaveRequest) ([]byte, models.LeaveDocument, error) {
+	doc, err := findArchivedRecord(db, leave.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return archiveLeaveRecord(db, leave)
+	}
+	if err != nil {
+		return nil, doc, err
+	}
+	pdfBytes, doc, err := readArchivedRecord(doc)
+	if errors.Is(err, storage.ErrNotFound) {
+		return reissueArchivedRecord(db, leave, doc)
+	}
+	return pdfBytes, doc, err
+}
+
+// sendLeaveRecord queues the archived record for the staff member and HR,
+// unless it has already been sent. The send is claimed in the same transaction
+// so concurrent callers cannot queue it twice.
+func sendLeaveRecord(db *gorm.DB, leave models.LeaveRequest, doc models.LeaveDocument, pdfBytes []byte) error {
+	var msgs []service.Message
+	for _, email := range []string{leave.StaffEmail, leave.HREmail} {
+		if email != "" {
+			msgs = append(msgs, service.LeaveRecordEmail(email, leave, pdfBytes))
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.LeaveDocument{}).
+			Where("id = ? AND emailed_at IS NULL", doc.ID).
+			Update("emailed_at", time.Now())
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error // Already sent when no row was claimed
+		}
+		return outbox.Enqueue(tx, leave.ID, msgs...)
+	})
+	if err != nil {
+		return err
+	}
+	outbox.Wake()
+	return nil
+}
+
+// recordInterval is how often the record worker retries records it could not
+// finish, in case a wake-up was missed.
+const recordInterval = time.Minute
+
+// recordWake nudges the record worker after a final approval is committed.
+var recordWake = make(chan struct{}, 1)
+
+// wakeRecordWorker asks the record worker to look for pending records now.
+// Call it after committing a transaction that set RecordPending.
+func wakeRecordWorker() {
+	select {
+	case recordWake <- struct{}{}:
+	default:
+	}
+}
+
+// StartRecordWorker archives and emails the leave record of every fully
+// approved request marked RecordPending, until ctx is cancelled. The mark is
+// saved with the final approval, so a record interrupted by a restart or a
+// storage failure is picked up again.
+func StartRecordWorker(ctx context.Context, db *gorm.DB) {
+	go func() {
+		ticker := time.NewTicker(recordInterval)
+		defer ticker.Stop()
+		for {
+			finalizePendingRecords(db)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-recordWake:
+			}
+		}
+	}()
+}
+
+// finalizePendingRecords finalizes every request whose record is pending.
+func finalizePendingRecords(db *gorm.DB) {
+	var pending []models.LeaveRequest
+	err := db.Where("record_pending AND status = ?", string(workflow.StateFullyApproved)).Order("id ASC").Find(&pending).Error
+	if err != nil {
+		log.Printf("[ERROR] Failed to find pending leave records: %v", err)
+		return
+	}
+	for _, leave := range pending {
+		if err := finalizeLeaveRecord(db, leave); err != nil {
+			log.Printf("[ERROR] Failed to finalize leave record for request %d: %v", leave.ID, err)
+		}
+	}
+}
+
+// finalizeLeaveRecord archives and emails the record of a fully approved
+// request and clears its RecordPending mark.
+func finalizeLeaveRecord(db *gorm.DB, leave models.LeaveRequest) error {
+	pdfBytes, doc, err := leaveRecord(db, leave)
+	if err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	log.Printf("[INFO] Archived leave record %s for request %d", doc.DocumentID, leave.ID)
+	if err := sendLeaveRecord(db, leave, doc, pdfBytes); err != nil {
+		return fmt.Errorf("queue %s: %w", doc.DocumentID, err)
+	}
+	return db.Model(&models.LeaveRequest{}).Where("id = ?", leave.ID).Update("record_pending", false).Error
+}
+
+// writePDF sends pdfBytes as a file download.
+func writePDF(w http.ResponseWriter, fileName string, pdfBytes []byte) {
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName))
+	w.Write(pdfBytes)
+}
+
+// VerifyLeaveDocument is the public endpoint behind the QR code on leave
+// record PDFs. It returns the current status of the record a document was
+// issued for, so a printed or forwarded copy can be checked against it. Only
+// a fully approved leave is reported valid: one whose cancellation has been
+// requested is flagged as such while HR decides.
+//
+// Query params:
+// - doc: Document ID printed on the PDF (required)
+func VerifyLeaveDocument(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodGet) {
+		return
+	}
+
+	docID := r.URL.Query().Get("doc")
+	if _, err := uuid.Parse(docID); err != nil {
+		respondError(w, http.StatusNotFound, ErrDocumentNotFound)
+		return
+	}
+
+	var doc models.LeaveDocument
+	if err := database.DB.Where("document_id = ?", docID).First(&doc).Error; err != nil {
+		respondError(w, http.StatusNotFound, ErrDocumentNotFound)
+		return
+	}
+
+	var leave models.LeaveRequest
+	if err := database.DB.First(&leave, doc.LeaveRequestID).Error; err != nil {
+		log.Printf("[ERROR] Document %s refers to missing request %d: %v", doc.DocumentID, doc.LeaveRequestID, err)
+		respondError(w, http.StatusNotFound, ErrDocumentNotFound)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, leaveVerification{
+		DocumentID:          doc.DocumentID,
+		StatusAtIssue:       doc.StatusAtIssue,
+		SHA256:              doc.SHA256,
+		GeneratedAt:         doc.GeneratedAt,
+		Reference:           leave.Reference(),
+		StaffNo:             leave.StaffNo,
+		LeaveType:           leave.LeaveType,
+		StartDate:           leave.StartDate,
+		ResumptionDate:      leave.ResumptionDate,
+		TotalDays:           leave.TotalDays,
+		Status:              leave.Status,
+		Valid:               leave.Status == string(workflow.StateFullyApproved),
+		CancellationPending: leave.Status == string(workflow.StateCancellationRequested),
+		Cancelled:           leave.Status == string(workflow.StateCancelled),
+		CancelledAt:         leave.CancelledAt,
+		ReissueOf:           doc.ReissueOf,
+		ReplacedBy:          doc.ReplacedBy,
+	})
+}
+
+// ============================================================================
+// LEAVE RECORD ARCHIVE (HR)
+// ============================================================================
+
+// ListArchivedRecords lists archived leave records, newest first.
+//
+// Query params:
+// - staff_no: Only records of this staff number (optional)
+// - year: Only records of this leave year (optional)
+func ListArchivedRecords(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodGet) {
+		return
+	}
+
+	query := database.DB.Where("storage_key <> ''")
+	if staffNo := r.URL.Query().Get("staff_no"); staffNo != "" {
+		query = query.Where("staff_no = ?", staffNo)
+	}
+	if yearParam := r.URL.Query().Get("year"); yearParam != "" {
+		year, err := strconv.Atoi(yearParam)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "year must be a number")
+			return
+		}
+		query = query.Where("year = ?", year)
+	}
+
+	var docs []models.LeaveDocument
+	if err := query.Order("generated_at DESC").Find(&docs).Error; err != nil {
+		log.Printf("[ERROR] Failed to list archived records: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to list archived records")
+		return
+	}
+
+	resp := make([]archivedRecord, 0, len(docs))
+	for _, doc := range docs {
+		resp = append(resp, archivedRecord{
+			LeaveDocument: doc,
+			Reference:     models.LeaveRequest{ID: doc.LeaveRequestID}.Reference(),
+			PDFURL:        "/api/admin/archive/pdf?doc=" + doc.DocumentID,
+		})
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// DownloadArchivedRecord returns the stored PDF of an archived leave record.
+//
+// Query params:
+// - doc: Document ID (required)
+func DownloadArchivedRecord(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodGet) {
+		return
+	}
+
+	var doc models.LeaveDocument
+	err := database.DB.Where("document_id = ? AND storage_key <> ''", r.URL.Query().Get("doc")).First(&doc).Error
+	if err != nil {
+		respondError(w, http.StatusNotFound, ErrDocumentNotFound)
+		return
+	}
+
+	pdfBytes, _, err := readArchivedRecord(doc)
+	if errors.Is(err, storage.ErrNotFound) {
+		var leave models.LeaveRequest
+		if err = database.DB.First(&leave, doc.LeaveRequestID).Error; err == nil {
+			pdfBytes, doc, err = reissueArchivedRecord(database.DB, leave, doc)
+		}
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to read archived record %s: %v", doc.DocumentID, err)
+		respondError(w, http.StatusInternalServerError, "failed to read archived record")
+		return
+	}
+
+	reference := models.LeaveRequest{ID: doc.LeaveRequestID}.Reference()
+	writePDF(w, "Leave_Record_"+reference+".pdf", pdfBytes)
+}
@@ -4,19 +4,25 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"time"
 
+	"github.com/JpUnique/petrodata-leave-project/pkg/calendar"
 	"github.com/JpUnique/petrodata-leave-project/pkg/database"
+	"github.com/JpUnique/petrodata-leave-project/pkg/ledger"
 	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"github.com/JpUnique/petrodata-leave-project/pkg/outbox"
 	"github.com/JpUnique/petrodata-leave-project/pkg/service"
 	"github.com/JpUnique/petrodata-leave-project/pkg/utils"
+	"github.com/JpUnique/petrodata-leave-project/pkg/workflow"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 // ============================================================================
@@ -40,45 +46,37 @@ type LoginRequest struct {
 
 // ManagerActionRequest represents the line manager's approval/rejection decision.
 type ManagerActionRequest struct {
-	Token   string `json:"token"`
-	Status  string `json:"status"` // "Approved" or "Rejected"
-	HREmail string `json:"resource_email"`
-	Reason  string `json:"reason,omitempty"` // Required if rejected
+	Token     string `json:"token"`
+	Status    string `json:"status"` // "Approved", "Rejected" or "Returned for Correction"
+	HREmail   string `json:"resource_email"`
+	Reason    string `json:"reason,omitempty"`    // Required unless approved
+	Code      string `json:"code,omitempty"`      // Required when approvers must confirm their email
+	Signature string `json:"signature,omitempty"` // PNG data URL, required if approved
 }
 
 // HRActionRequest represents the HR manager's approval/rejection decision.
 type HRActionRequest struct {
-	Token   string `json:"token"`
-	Status  string `json:"status"` // "Approved" or "Rejected"
-	MDEmail string `json:"director_email"`
-	Reason  string `json:"reason,omitempty"` // Required if rejected
+	Token     string `json:"token"`
+	Status    string `json:"status"` // "Approved", "Rejected" or "Returned for Correction"
+	MDEmail   string `json:"director_email"`
+	Reason    string `json:"reason,omitempty"`    // Required unless approved
+	Code      string `json:"code,omitempty"`      // Required when approvers must confirm their email
+	Signature string `json:"signature,omitempty"` // PNG data URL, required if approved
 }
 
 // MDActionRequest represents the Managing Director's final approval/rejection decision.
 type MDActionRequest struct {
-	Token  string `json:"token"`
-	Status string `json:"status"`           // "Approved" or "Rejected"
-	Reason string `json:"reason,omitempty"` // Required if rejected
+	Token     string `json:"token"`
+	Status    string `json:"status"`              // "Approved", "Rejected" or "Returned for Correction"
+	Reason    string `json:"reason,omitempty"`    // Required unless approved
+	Code      string `json:"code,omitempty"`      // Required when approvers must confirm their email
+	Signature string `json:"signature,omitempty"` // PNG data URL, required if approved
 }
 
 // ============================================================================
-// STATUS AND ERROR CONSTANTS
+// ERROR CONSTANTS
 // ============================================================================
 
-// Leave request status constants
-const (
-	StatusPending           = "Pending"
-	StatusApproved          = "Approved"
-	StatusRejected          = "Rejected"
-	StatusPendingMDReview   = "Pending MD Review"
-	StatusPendingHRReview   = "Pending HR Review"
-	StatusPendingMDApproval = "Pending MD Final Approval"
-	StatusRejectedByManager = "Rejected by Manager - Pending HR Filing"
-	StatusRejectedByHR      = "Rejected by HR - Pending MD Review"
-	StatusRejectedByMD      = "Rejected by MD"
-	StatusFullyApproved     = "Fully Approved"
-)
-
 // HTTP error message constants
 const (
 	ErrMethodNotAllowed       = "method not allowed"
@@ -95,6 +93,14 @@ const (
 	ErrInvalidCredentials     = "invalid email or password"
 	ErrRequestNotFound        = "request not found"
 	ErrMissingRejectionReason = "rejection reason is required"
+	ErrMissingCorrection      = "please say what needs to be corrected"
+	ErrConcurrentUpdate       = "request was updated by another action, please reload and try again"
+	ErrLinkExpired            = "this link has expired, please ask HR to send a new one"
+	ErrLinkUsed               = "this link has already been used or replaced by a newer one"
+	ErrLinkCodeRequired       = "please confirm your email: request a code and enter it with your decision"
+	ErrLinkCodeWrong          = "the confirmation code is incorrect"
+	ErrLinkCodeAttempts       = "too many incorrect codes, please request a new one"
+	ErrMissingSignature       = "please sign before approving"
 )
 
 // ============================================================================
@@ -136,6 +142,105 @@ func validateHTTPMethod(w http.ResponseWriter, method, allowedMethod string) boo
 	return true
 }
 
+// decisionError is an approver's decision refused with the HTTP status it is
+// reported with. The decide functions return it so link handlers and the
+// inbox report a refusal the same way.
+type decisionError struct {
+	code    int
+	message string
+}
+
+func (e *decisionError) Error() string {
+	return e.message
+}
+
+// refuseDecision returns a decisionError reported as code with message.
+func refuseDecision(code int, message string) error {
+	return &decisionError{code: code, message: message}
+}
+
+// decisionOutcome is what a saved decision reports back to the approver.
+type decisionOutcome struct {
+	Message string `json:"message"`
+	Status  string `json:"status"` // Request status after the decision
+}
+
+// decisionErrorStatus returns the HTTP status and message err is reported with.
+func decisionErrorStatus(err error) (int, string) {
+	var refused *decisionError
+	if errors.As(err, &refused) {
+		return refused.code, refused.message
+	}
+	return http.StatusInternalServerError, ErrSaveAction
+}
+
+// respondDecision writes the outcome of a decision, or the error that refused it.
+func respondDecision(w http.ResponseWriter, outcome decisionOutcome, err error) {
+	if err != nil {
+		code, message := decisionErrorStatus(err)
+		respondError(w, code, message)
+		return
+	}
+	respondJSON(w, http.StatusOK, outcome)
+}
+
+// parseDecision converts the posted status into a workflow decision and checks
+// that rejections carry a reason and returns say what to correct.
+func parseDecision(status, reason string) (workflow.Decision, error) {
+	decision, err := workflow.ParseDecision(status)
+	if err != nil {
+		return "", refuseDecision(http.StatusBadRequest, err.Error())
+	}
+	if decision == workflow.DecisionRejected && reason == "" {
+		log.Printf("[WARN] Rejection attempted without reason")
+		return "", refuseDecision(http.StatusBadRequest, ErrMissingRejectionReason)
+	}
+	if decision == workflow.DecisionReturned && reason == "" {
+		return "", refuseDecision(http.StatusBadRequest, ErrMissingCorrection)
+	}
+	return decision, nil
+}
+
+// transitionRefused reports a move the workflow does not allow as a 409 Conflict.
+func transitionRefused(requestID uint, err error) error {
+	log.Printf("[WARN] Rejected workflow transition for request %d: %v", requestID, err)
+	return refuseDecision(http.StatusConflict, err.Error())
+}
+
+// respondTransitionError writes a 409 Conflict for a move the workflow does not allow.
+func respondTransitionError(w http.ResponseWriter, requestID uint, err error) {
+	respondDecision(w, decisionOutcome{}, transitionRefused(requestID, err))
+}
+
+// errConcurrentUpdate is returned by saveTransition when the stored status no
+// longer matches the status the transition was computed from.
+var errConcurrentUpdate = errors.New(ErrConcurrentUpdate)
+
+// saveTransition persists leaveReq only if its stored status is still from,
+// so two approvers acting on the same request cannot both succeed. The leave
+// balance ledger is settled for the new status in the same transaction.
+func saveTransition(db *gorm.DB, leaveReq *models.LeaveRequest, from workflow.State) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(leaveReq).Where("status = ?", string(from)).Select("*").Updates(leaveReq)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errConcurrentUpdate
+		}
+		return settleBalance(tx, leaveReq, from)
+	})
+}
+
+// respondSaveError maps a saveTransition failure to 409 or 500.
+func respondSaveError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, errConcurrentUpdate) {
+		respondError(w, http.StatusConflict, ErrConcurrentUpdate)
+		return
+	}
+	respondError(w, http.StatusInternalServerError, message)
+}
+
 // // toPtr converts string to *string
 // func toPtr(s string) *string {
 // 	return &s
@@ -159,10 +264,12 @@ func validateHTTPMethod(w http.ResponseWriter, method, allowedMethod string) boo
 //
 // Request body should contain:
 // - full_name: Staff member's full name
-// - email: Unique email address
+// - email: Unique email address, compared and stored in lower case
 // - password: Plain text password (will be hashed)
 // - phone_number: Contact phone number
 //
+// New accounts always get the staff role; see database.SeedAdmins.
+//
 // Returns: User ID and email on success, error message on failure
 func Signup(w http.ResponseWriter, r *http.Request) {
 	if !validateHTTPMethod(w, r.Method, http.MethodPost) {
@@ -176,9 +283,11 @@ func Signup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if user already exists
+	req.Email = utils.NormalizeEmail(req.Email)
+
+	// Check if user already exists, in any letter case
 	var existingUser models.User
-	if err := database.DB.Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
+	if err := database.DB.Where("LOWER(email) = ?", req.Email).First(&existingUser).Error; err == nil {
 		log.Printf("[WARN] Signup attempt with existing email: %s", req.Email)
 		respondError(w, http.StatusConflict, ErrUserExists)
 		return
@@ -199,6 +308,7 @@ func Signup(w http.ResponseWriter, r *http.Request) {
 		Password:    string(hashedPassword),
 		PhoneNumber: req.PhoneNumber,
 		StaffNo:     req.StaffNo,
+		Role:        models.RoleStaff,
 		CreatedAt:   time.Now(),
 	}
 
@@ -238,9 +348,11 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	req.Email = utils.NormalizeEmail(req.Email)
+
 	// Query database for user
 	var user models.User
-	if err := database.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
+	if err := database.DB.Where("LOWER(email) = ?", req.Email).First(&user).Error; err != nil {
 		log.Printf("[WARN] Login attempt with non-existent email: %s", req.Email)
 		respondError(w, http.StatusUnauthorized, ErrInvalidCredentials)
 		return
@@ -270,6 +382,7 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		"user":     user.FullName,
 		"email":    user.Email,
 		"staff_no": user.StaffNo,
+		"role":     user.Role,
 	})
 }
 
@@ -280,6 +393,7 @@ func generateJWT(user models.User) (string, error) {
 		"email":    user.Email,
 		"name":     user.FullName,
 		"staff_no": user.StaffNo,
+		"role":     string(user.Role),
 		"exp":      time.Now().Add(24 * time.Hour).Unix(),
 		"iat":      time.Now().Unix(),
 	}
@@ -308,9 +422,13 @@ func generateJWT(user models.User) (string, error) {
 // - staff_name, staff_email, staff_no, designation, department
 // - leave_type, start_date, resumption_date, total_days
 // - relief_staff, contact_address, manager_email
+// - supporting_document: PDF, PNG or JPEG data URL (required by some leave types)
+//
+// The leave type must be an active entry of the leave type catalogue, and the
+// request must meet its rules (eligibility, notice, length, document).
 //
 // Returns: Request token and initial status on success, error message on failure
-// Side effect: Sends email to manager asynchronously
+// Side effect: Queues the first approver notification in the outbox
 func SubmitLeaveRequest(w http.ResponseWriter, r *http.Request) {
 	if !validateHTTPMethod(w, r.Method, http.MethodPost) {
 		return
@@ -339,21 +457,20 @@ func SubmitLeaveRequest(w http.ResponseWriter, r *http.Request) {
 		ReliefStaff           string `json:"relief_staff"`
 		ContactAddress        string `json:"contact_address"`
 		ManagerEmail          string `json:"manager_email"`
+		SupportingDocument    string `json:"supporting_document"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
-		log.Printf("[ERROR] Failed to decode leave request body: %v", err)
-		respondError(w, http.StatusBadRequest, ErrMalformedRequest)
+	if !decodeLeaveRequestBody(w, r, &reqBody, ErrMalformedRequest) {
 		return
 	}
 	rawEmail, ok := r.Context().Value("userEmail").(string)
-    if !ok || rawEmail == "" {
-        respondError(w, http.StatusUnauthorized, "Unauthorized")
-        return
-    }
+	if !ok || rawEmail == "" {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
 	userEmail = utils.NormalizeEmail(rawEmail)
 
-	// 3. POLICY CHECK: Validate against HR Entitlement
+	// 3. POLICY CHECK: Staff must be on the HR entitlement list
 	var policy models.StaffRecord
 	if err := database.DB.Where("email ILIKE ?", userEmail).First(&policy).Error; err != nil {
 		log.Printf("[WARN] Staff record not found for policy check: %s", userEmail)
@@ -361,21 +478,76 @@ func SubmitLeaveRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if reqBody.TotalDays > policy.LeaveEntitlement {
-		msg := fmt.Sprintf("Policy Violation: Your leave entitlement is %d days, but you requested %d days.", policy.LeaveEntitlement, reqBody.TotalDays)
-		respondError(w, http.StatusBadRequest, msg) // This triggers the frontend SweetAlert
-		return
-	}
-
 	// Validate required fields
 	if reqBody.ManagerEmail == "" {
 		respondError(w, http.StatusBadRequest, "manager_email is required")
 		return
 	}
 
+	leaveType, err := findLeaveType(database.DB, reqBody.LeaveType)
+	if err != nil {
+		respondLeaveTypeError(w, err, ErrPersistRequest)
+		return
+	}
+
+	dates, err := parseLeaveDates(reqBody.StartDate, reqBody.ResumptionDate, reqBody.DateEmployed, models.Today())
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	startDate := dates.Start.Time
+
+	// Count working days on the server; the client figure is only cross-checked
+	totalDays, resumption, ok := countLeaveDays(w, dates, reqBody.TotalDays)
+	if !ok {
+		return
+	}
+
+	var document []byte
+	var documentExt string
+	if reqBody.SupportingDocument != "" {
+		if document, documentExt, err = decodeSupportingDocument(reqBody.SupportingDocument); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if err := checkLeaveTypeRules(leaveType, policy, dates, totalDays, document != nil); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Reject dates already covered by one of the staff member's active requests
+	overlaps, err := findOverlaps(database.DB, userEmail, dates.Start, resumption, 0)
+	if err != nil {
+		log.Printf("[ERROR] Overlap check failed for %s: %v", userEmail, err)
+		respondError(w, http.StatusInternalServerError, ErrPersistRequest)
+		return
+	}
+	if len(overlaps) > 0 {
+		respondError(w, http.StatusConflict, overlapMessage(overlaps))
+		return
+	}
+
+	var documentKey string
+	if document != nil {
+		if documentKey, err = storeSupportingDocument(document, documentExt); err != nil {
+			log.Printf("[ERROR] Failed to store supporting document for %s: %v", userEmail, err)
+			respondError(w, http.StatusInternalServerError, ErrPersistRequest)
+			return
+		}
+	}
+
 	// Helper to create *string from string
 	stringPtr := func(s string) *string { return &s }
 
+	// Pick a configured approval chain, if any applies to this request
+	chain, err := resolveApprovalChain(database.DB, reqBody.Department, leaveType.Name, totalDays)
+	if err != nil {
+		log.Printf("[ERROR] Failed to resolve approval chain: %v", err)
+		respondError(w, http.StatusInternalServerError, ErrPersistRequest)
+		return
+	}
+
 	// Generate tokens
 	reqToken := uuid.New().String()
 
@@ -386,17 +558,17 @@ func SubmitLeaveRequest(w http.ResponseWriter, r *http.Request) {
 		StaffNo:               userStaffNo, // From auth context
 		Designation:           reqBody.Designation,
 		Department:            reqBody.Department,
-		DateEmployed:          reqBody.DateEmployed, // SAVED TO DB
-		PhoneNumber:           reqBody.PhoneNumber,  // SAVED TO DB
+		DateEmployed:          dates.Employed,      // SAVED TO DB
+		PhoneNumber:           reqBody.PhoneNumber, // SAVED TO DB
 		LeaveAllowanceRequest: reqBody.LeaveAllowanceRequest,
-		LeaveType:             reqBody.LeaveType,
-		StartDate:             reqBody.StartDate,
-		ResumptionDate:        reqBody.ResumptionDate,
-		TotalDays:             reqBody.TotalDays,
+		LeaveType:             leaveType.Name,
+		StartDate:             dates.Start,
+		ResumptionDate:        resumption, // Next working day, computed on the server
+		TotalDays:             totalDays,  // Computed on the server
 		ReliefStaff:           reqBody.ReliefStaff,
 		ContactAddress:        reqBody.ContactAddress,
 		ManagerEmail:          reqBody.ManagerEmail,
-		Status:                StatusPending,
+		Status:                string(workflow.StatePending),
 		ManagerApproved:       false,
 		HRApproved:            false,
 		MDApproved:            false,
@@ -404,36 +576,142 @@ func SubmitLeaveRequest(w http.ResponseWriter, r *http.Request) {
 		HRToken:               nil,                 // ✓ NULL in DB
 		MDToken:               nil,                 // ✓ NULL in DB
 		FinalHRToken:          nil,                 // ✓ NULL in DB
+		BalanceYear:           startDate.Year(),
+		BalanceType:           leaveType.BalanceType(),
+		SupportingDocumentKey: documentKey,
 		CreatedAt:             time.Now(),
 	}
 
+	// Chain requests use per-stage tokens instead of the built-in token columns
+	if chain != nil {
+		leaveReq.Status = string(workflow.StatePendingStage)
+		leaveReq.ChainID = &chain.ID
+		leaveReq.CurrentStage = 1
+		leaveReq.RequestToken = nil
+		leaveReq.HREmail = chain.ArchiveEmail
+	}
+
 	log.Printf("[INFO] Attempting to save leave request for Staff: %s (Token: %s)", leaveReq.StaffName, reqToken)
 
-	// Persist request to database
-	if err := database.DB.Create(&leaveReq).Error; err != nil {
+	// Persist request (and chain stages) and reserve the days against the
+	// remaining balance, not the raw entitlement
+	var firstStage models.LeaveRequestStage
+	var link *models.ApprovalLink
+	var notify service.Message
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := ledger.Reserve(tx, balanceKey(&leaveReq), leaveReq.TotalDays); err != nil {
+			return err
+		}
+		if err := tx.Create(&leaveReq).Error; err != nil {
+			return err
+		}
+		if chain != nil {
+			var err error
+			if firstStage, err = createRequestStages(tx, &leaveReq, chain); err != nil {
+				return err
+			}
+			link = newLink(leaveReq.ID, models.LinkStage, firstStage.ApproverEmail, *firstStage.Token)
+			notify = service.StageRequestEmail(linkRecipient(link), leaveReq, firstStage.Name, signedToken(link))
+		} else {
+			link = newLink(leaveReq.ID, models.LinkManager, leaveReq.ManagerEmail, reqToken)
+			notify = service.ManagerRequestEmail(linkRecipient(link), leaveReq, signedToken(link))
+		}
+		if err := issueLink(tx, link); err != nil {
+			return err
+		}
+		// Queue the first approver's notification with the request
+		return outbox.Enqueue(tx, leaveReq.ID, notify)
+	})
+	var balanceErr *ledger.InsufficientBalanceError
+	if errors.As(err, &balanceErr) {
+		respondError(w, http.StatusBadRequest, balanceErr.Error()) // This triggers the frontend SweetAlert
+		return
+	}
+	if err != nil {
 		log.Printf("[ERROR] Failed to create leave record: %v", err)
 		respondError(w, http.StatusInternalServerError, ErrPersistRequest)
 		return
 	}
 
-	// Send manager notification email asynchronously
-	// Dereference *string for the email function
-	go func(emailAddr, name, token string) {
-		if err := service.SendToManager(emailAddr, name, token); err != nil {
-			log.Printf("[ERROR] Manager email failed for %s: %v", name, err)
-		} else {
-			log.Printf("[INFO] Email successfully dispatched to Manager: %s", emailAddr)
-		}
-	}(leaveReq.ManagerEmail, leaveReq.StaffName, reqToken)
+	outbox.Wake()
 
 	respondJSON(w, http.StatusAccepted, map[string]interface{}{
-		"message":       fmt.Sprintf("Leave request submitted successfully for %s", leaveReq.StaffName),
-		"request_token": reqToken, // ✓ Use string variable
-		"status":        leaveReq.Status,
-		"entitlement":   policy.LeaveEntitlement, // Optional: return this to UI
+		"message":      fmt.Sprintf("Leave request submitted successfully for %s", leaveReq.StaffName),
+		"reference":    leaveReq.Reference(), // The signed approval link goes to the approver only
+		"status":       leaveReq.Status,
+		"entitlement":  policy.LeaveEntitlement, // Optional: return this to UI
+		"balance_year": leaveReq.BalanceYear,
+		"total_days":   leaveReq.TotalDays,
+		"resumption":   leaveReq.ResumptionDate,
 	})
 }
 
+// leaveDates holds the validated dates of a leave application.
+type leaveDates struct {
+	Start      models.Date
+	Resumption models.Date
+	Employed   models.Date // Zero if not supplied
+	Submitted  models.Date // Day the start date was chosen; notice is counted from it
+}
+
+// parseLeaveDates validates the date fields of a leave application: each must be
+// YYYY-MM-DD, the start cannot be before submitted (the day it was chosen),
+// resumption must come after the start and the employment date cannot be in
+// the future.
+func parseLeaveDates(start, resumption, employed string, submitted models.Date) (leaveDates, error) {
+	dates := leaveDates{Submitted: submitted}
+	var err error
+
+	if dates.Start, err = models.ParseDate(start); err != nil {
+		return dates, errors.New("start_date must be a date in YYYY-MM-DD format")
+	}
+	if dates.Resumption, err = models.ParseDate(resumption); err != nil {
+		return dates, errors.New("resumption_date must be a date in YYYY-MM-DD format")
+	}
+	if employed != "" {
+		if dates.Employed, err = models.ParseDate(employed); err != nil {
+			return dates, errors.New("date_employed must be a date in YYYY-MM-DD format")
+		}
+	}
+
+	today := models.Today()
+	if dates.Start.Before(submitted.Time) {
+		return dates, errors.New("start_date cannot be in the past")
+	}
+	if !dates.Resumption.After(dates.Start.Time) {
+		return dates, errors.New("resumption_date must be after start_date")
+	}
+	if dates.Employed.After(today.Time) {
+		return dates, errors.New("date_employed cannot be in the future")
+	}
+	return dates, nil
+}
+
+// countLeaveDays counts the working days of the period in dates and the
+// resumption date after them, cross-checking claimed when it is not zero. It
+// writes an error response and returns false on failure.
+func countLeaveDays(w http.ResponseWriter, dates leaveDates, claimed int) (int, models.Date, bool) {
+	startDate, resumptionDate := dates.Start.Time, dates.Resumption.Time
+	cal, err := calendar.LoadRange(database.DB, startDate, resumptionDate)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load holiday calendar: %v", err)
+		respondError(w, http.StatusInternalServerError, ErrPersistRequest)
+		return 0, models.Date{}, false
+	}
+
+	totalDays := cal.WorkingDays(startDate, resumptionDate)
+	if totalDays <= 0 {
+		respondError(w, http.StatusBadRequest, "the selected dates contain no working days")
+		return 0, models.Date{}, false
+	}
+	if claimed != 0 && claimed != totalDays {
+		msg := fmt.Sprintf("Total days mismatch: you entered %d, but the period contains %d working days (excluding weekends and public holidays).", claimed, totalDays)
+		respondError(w, http.StatusBadRequest, msg)
+		return 0, models.Date{}, false
+	}
+	return totalDays, models.NewDate(cal.ResumptionDate(startDate, totalDays)), true
+}
+
 // ============================================================================
 // APPROVAL WORKFLOW - RETRIEVAL HANDLERS
 // ============================================================================
@@ -444,7 +722,8 @@ func SubmitLeaveRequest(w http.ResponseWriter, r *http.Request) {
 // Query params:
 // - token: The unique request token (required)
 //
-// Returns: Complete LeaveRequest object on success, error message on failure
+// Returns: Complete LeaveRequest object, plus any overlapping requests by the
+// same staff member, on success; 410 if the link was used or has expired
 func GetLeaveRequestByToken(w http.ResponseWriter, r *http.Request) {
 	if !validateHTTPMethod(w, r.Method, http.MethodGet) {
 		return
@@ -455,14 +734,12 @@ func GetLeaveRequestByToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var leaveReq models.LeaveRequest
-	if err := database.DB.Where("request_token = ?", token).First(&leaveReq).Error; err != nil {
-		log.Printf("[ERROR] Invalid request token: %s", token)
-		respondError(w, http.StatusNotFound, ErrTokenNotFound)
+	_, leaveReq, ok := requestByLink(w, token, models.LinkManager)
+	if !ok {
 		return
 	}
 
-	respondJSON(w, http.StatusOK, leaveReq)
+	respondJSON(w, http.StatusOK, buildLeaveDetails(database.DB, leaveReq))
 }
 
 // GetLeaveRequestByHRToken retrieves a leave request using the HR-specific token.
@@ -471,7 +748,8 @@ func GetLeaveRequestByToken(w http.ResponseWriter, r *http.Request) {
 // Query params:
 // - token: The unique HR token (required)
 //
-// Returns: Complete LeaveRequest object on success, error message on failure
+// Returns: Complete LeaveRequest object, plus any overlapping requests by the
+// same staff member, on success; 410 if the link was used or has expired
 func GetLeaveRequestByHRToken(w http.ResponseWriter, r *http.Request) {
 	if !validateHTTPMethod(w, r.Method, http.MethodGet) {
 		return
@@ -482,14 +760,12 @@ func GetLeaveRequestByHRToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var leaveReq models.LeaveRequest
-	if err := database.DB.Where("resource_token = ?", token).First(&leaveReq).Error; err != nil {
-		log.Printf("[ERROR] Invalid HR token: %s", token)
-		respondError(w, http.StatusNotFound, ErrTokenNotFound)
+	_, leaveReq, ok := requestByLink(w, token, models.LinkHR)
+	if !ok {
 		return
 	}
 
-	respondJSON(w, http.StatusOK, leaveReq)
+	respondJSON(w, http.StatusOK, buildLeaveDetails(database.DB, leaveReq))
 }
 
 // GetLeaveRequestByMDToken retrieves a leave request using the MD-specific token.
@@ -498,7 +774,8 @@ func GetLeaveRequestByHRToken(w http.ResponseWriter, r *http.Request) {
 // Query params:
 // - token: The unique MD token (required)
 //
-// Returns: Complete LeaveRequest object on success, error message on failure
+// Returns: Complete LeaveRequest object, plus any overlapping requests by the
+// same staff member, on success; 410 if the link was used or has expired
 func GetLeaveRequestByMDToken(w http.ResponseWriter, r *http.Request) {
 	if !validateHTTPMethod(w, r.Method, http.MethodGet) {
 		return
@@ -509,14 +786,12 @@ func GetLeaveRequestByMDToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var leaveReq models.LeaveRequest
-	if err := database.DB.Where("director_token = ?", token).First(&leaveReq).Error; err != nil {
-		log.Printf("[ERROR] Invalid MD token: %s", token)
-		respondError(w, http.StatusNotFound, ErrTokenNotFound)
+	_, leaveReq, ok := requestByLink(w, token, models.LinkMD)
+	if !ok {
 		return
 	}
 
-	respondJSON(w, http.StatusOK, leaveReq)
+	respondJSON(w, http.StatusOK, buildLeaveDetails(database.DB, leaveReq))
 }
 
 // GetFinalArchiveDetails retrieves the finalized leave request for archival purposes.
@@ -525,7 +800,7 @@ func GetLeaveRequestByMDToken(w http.ResponseWriter, r *http.Request) {
 // Query params:
 // - token: The unique final HR archive token (required)
 //
-// Returns: Complete finalized LeaveRequest object on success, error message on failure
+// Returns: Complete finalized LeaveRequest object on success; 410 if the link has expired
 func GetFinalArchiveDetails(w http.ResponseWriter, r *http.Request) {
 	if !validateHTTPMethod(w, r.Method, http.MethodGet) {
 		return
@@ -536,10 +811,8 @@ func GetFinalArchiveDetails(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var leaveReq models.LeaveRequest
-	if err := database.DB.Where("final_token = ?", token).First(&leaveReq).Error; err != nil {
-		log.Printf("[ERROR] Invalid final archive token: %s", token)
-		respondError(w, http.StatusNotFound, ErrTokenNotFound)
+	_, leaveReq, ok := requestByLink(w, token, models.LinkFinal)
+	if !ok {
 		return
 	}
 
@@ -551,24 +824,26 @@ func GetFinalArchiveDetails(w http.ResponseWriter, r *http.Request) {
 // ============================================================================
 
 // HandleLineManagerAction processes the line manager's approval or rejection decision.
-// Updates the request status and sends the request to HR for processing.
+// Updates the request status and sends the request to HR for review or, when
+// rejected, for filing.
 //
 // Request body:
 // - token: Request token (required)
-// - status: "Approved" or "Rejected" (required)
-// - hr_email: HR manager's email address (required for approval)
-// - reason: Rejection reason (required if status is "Rejected")
+// - status: "Approved", "Rejected" or "Returned for Correction" (required)
+// - hr_email: HR manager's email address (required unless returned)
+// - reason: Rejection reason, or what needs correcting (required unless status is "Approved")
+// - signature: Approver signature as a PNG data URL (required if status is "Approved")
 //
 // Workflow:
-// 1. Validates rejection reason if applicable
-// 2. Records the manager's decision
-// 3. Sets appropriate status (Pending HR Review or Rejected by Manager)
-// 4. Generates a unique HR token (for approvals) or notifies staff (for rejections)
-// 5. Saves changes to database
-// 6. Sends email notification to HR or staff
+// 1. Checks the link is still valid (410)
+// 2. Validates the decision, rejection reason and signature
+// 3. Checks the move is allowed from the current status (409)
+// 4. Records the manager's decision
+// 5. Generates a unique HR token to review (approvals) or file (rejections) the request
+// 6. Saves changes to database and queues an email notification to HR and/or staff
 //
 // Returns: Success message on completion
-// Side effect: Sends email asynchronously
+// Side effect: Queues the email in the outbox with the decision
 func HandleLineManagerAction(w http.ResponseWriter, r *http.Request) {
 	if !validateHTTPMethod(w, r.Method, http.MethodPost) {
 		return
@@ -581,109 +856,125 @@ func HandleLineManagerAction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate rejection reason if status is Rejected
-	if req.Status == StatusRejected && req.Reason == "" {
-		log.Printf("[WARN] Rejection attempted without reason for token: %s", req.Token)
-		respondError(w, http.StatusBadRequest, ErrMissingRejectionReason)
+	// Retrieve the leave request through its unused, unexpired link
+	link, leaveReq, ok := requestByLink(w, req.Token, models.LinkManager)
+	if !ok || !checkLinkCode(w, link, req.Code) {
 		return
 	}
 
-	// Validate HR email if approving
-	if req.Status == StatusApproved && req.HREmail == "" {
-		respondError(w, http.StatusBadRequest, "hr_email is required for approval")
-		return
+	outcome, err := decideManager(r, link, leaveReq, req)
+	respondDecision(w, outcome, err)
+}
+
+// decideManager records the line manager's decision on leaveReq, made through
+// link. It is shared by the approval link and the approver inbox.
+func decideManager(r *http.Request, link models.ApprovalLink, leaveReq models.LeaveRequest, req ManagerActionRequest) (decisionOutcome, error) {
+	decision, err := parseDecision(req.Status, req.Reason)
+	if err != nil {
+		return decisionOutcome{}, err
+	}
+	if err := checkSignature(req.Signature, decision == workflow.DecisionApproved); err != nil {
+		return decisionOutcome{}, err
 	}
 
-	// Retrieve the leave request
-	var leaveReq models.LeaveRequest
-	if err := database.DB.Where("request_token = ?", req.Token).First(&leaveReq).Error; err != nil {
-		log.Printf("[ERROR] Leave request not found for token: %s", req.Token)
-		respondError(w, http.StatusNotFound, ErrRequestNotFound)
-		return
+	// Validate HR email, which HR needs to review an approval or file a rejection
+	forwarded := decision != workflow.DecisionReturned
+	if forwarded && req.HREmail == "" {
+		return decisionOutcome{}, refuseDecision(http.StatusBadRequest, "hr_email is required unless returning for correction")
+	}
+	if forwarded {
+		if err := checkRoleHolder(req.HREmail, models.RoleHR); err != nil {
+			return decisionOutcome{}, err
+		}
+	}
+
+	from := workflow.State(leaveReq.Status)
+	next, err := workflow.Transition(from, workflow.ActorLineManager, decision)
+	if err != nil {
+		return decisionOutcome{}, transitionRefused(leaveReq.ID, err)
 	}
 
 	// Record the manager's decision
-	leaveReq.ManagerDecision = req.Status
-	leaveReq.ManagerApproved = (req.Status == StatusApproved)
+	leaveReq.Status = string(next)
+	leaveReq.ManagerDecision = string(decision)
+	leaveReq.ManagerApproved = (decision == workflow.DecisionApproved)
 	leaveReq.HREmail = req.HREmail
+	leaveReq.RequestToken = nil
+
+	entry := linkAuditEntry(r, link, string(workflow.ActorLineManager), string(decision), req.Reason)
+	entry.Signature = req.Signature
+	entry.ForwardedTo = req.HREmail
+
+	// Handle return path, sending the request back to the staff to correct
+	if decision == workflow.DecisionReturned {
+		return returnForCorrection(&leaveReq, from, link, entry, "Line Manager", req.Reason)
+	}
 
 	// Handle approval path
 	if leaveReq.ManagerApproved {
-		leaveReq.Status = StatusPendingHRReview
 		hrTokenStr := uuid.New().String()
 		leaveReq.HRToken = &hrTokenStr
+		hrLink := newLink(leaveReq.ID, models.LinkHR, leaveReq.HREmail, hrTokenStr)
 
 		log.Printf("[DEBUG] Saving HR Token for %s: %s", leaveReq.StaffName, *leaveReq.HRToken)
-		// Save before sending email
-		if err := database.DB.Save(&leaveReq).Error; err != nil {
+		// Save and queue the HR notification together
+		notify := service.HRRequestEmail(linkRecipient(hrLink), leaveReq, signedToken(hrLink))
+		if err := saveDecision(database.DB, &leaveReq, from, link, hrLink, entry, notify); err != nil {
 			log.Printf("[ERROR] Failed to save manager approval: %v", err)
-			respondError(w, http.StatusInternalServerError, ErrSaveAction)
-			return
+			return decisionOutcome{}, actionSaveError(err, ErrSaveAction)
 		}
 
-		// Notify HR of approval
-		go func(hrEmail, staffName, token string) {
-			if err := service.SendToHR(hrEmail, staffName, token); err != nil {
-				log.Printf("[ERROR] Failed to send email to HR (%s): %v", hrEmail, err)
-			} else {
-				log.Printf("[INFO] HR notification sent for %s", staffName)
-			}
-		}(leaveReq.HREmail, leaveReq.StaffName, hrTokenStr)
-
 		log.Printf("[INFO] Manager approved request for %s, forwarded to HR", leaveReq.StaffName)
 
-		respondJSON(w, http.StatusOK, map[string]interface{}{
-			"message": "Request approved and forwarded to HR.",
-			"status":  leaveReq.Status,
-		})
-		return
+		return decisionOutcome{
+			Message: "Request approved and forwarded to HR.",
+			Status:  leaveReq.Status,
+		}, nil
 	}
 
-	// Handle rejection path
-	leaveReq.Status = StatusRejectedByManager
+	// Handle rejection path, notifying the staff and sending the request to HR to file
+	hrTokenStr := uuid.New().String()
+	leaveReq.HRToken = &hrTokenStr
+	hrLink := newLink(leaveReq.ID, models.LinkHR, leaveReq.HREmail, hrTokenStr)
 
-	if err := database.DB.Save(&leaveReq).Error; err != nil {
+	notify := []service.Message{
+		service.RejectionEmail(leaveReq, "Line Manager", req.Reason),
+		service.FilingRequestEmail(linkRecipient(hrLink), leaveReq, req.Reason, signedToken(hrLink)),
+	}
+	if err := saveDecision(database.DB, &leaveReq, from, link, hrLink, entry, notify...); err != nil {
 		log.Printf("[ERROR] Failed to save manager rejection: %v", err)
-		respondError(w, http.StatusInternalServerError, ErrSaveAction)
-		return
+		return decisionOutcome{}, actionSaveError(err, ErrSaveAction)
 	}
 
-	// Notify staff of rejection
-	go func(staffEmail, staffName, reason string) {
-		if err := service.SendRejectionNotification(staffEmail, staffName, "Line Manager", reason); err != nil {
-			log.Printf("[ERROR] Failed to send rejection email to staff (%s): %v", staffEmail, err)
-		} else {
-			log.Printf("[INFO] Rejection notification sent to staff %s", staffName)
-		}
-	}(leaveReq.StaffEmail, leaveReq.StaffName, req.Reason)
-
-	log.Printf("[INFO] Manager rejected request for %s, staff notified", leaveReq.StaffName)
+	log.Printf("[INFO] Manager rejected request for %s, staff notified and sent to HR for filing", leaveReq.StaffName)
 
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"message": "Request rejected. Staff has been notified.",
-		"status":  leaveReq.Status,
-	})
+	return decisionOutcome{
+		Message: "Request rejected. Staff has been notified and HR will file it.",
+		Status:  leaveReq.Status,
+	}, nil
 }
 
 // HandleHRManagerAction processes the HR manager's approval or rejection decision.
-// Updates the request status and forwards the request to the MD for final approval.
+// Updates the request status and forwards the request to the MD for final
+// approval or, when rejected, to review the rejection.
 //
 // Request body:
 // - token: HR token (required)
-// - status: "Approved" or "Rejected" (required)
-// - md_email: Managing Director's email address (required for approval)
-// - reason: Rejection reason (required if status is "Rejected")
+// - status: "Approved", "Rejected" or "Returned for Correction" (required)
+// - md_email: Managing Director's email address (required unless returned)
+// - reason: Rejection reason, or what needs correcting (required unless status is "Approved")
+// - signature: Approver signature as a PNG data URL (required if status is "Approved")
 //
 // Workflow:
-// 1. Validates rejection reason if applicable
-// 2. Records the HR's decision
-// 3. Sets appropriate status (Pending MD Final Approval or Rejected by HR)
-// 4. Generates a unique MD token (for approvals) or notifies staff (for rejections)
-// 5. Saves changes to database
-// 6. Sends email notification to MD or staff
+// 1. Checks the link is still valid (410)
+// 2. Validates the decision, rejection reason and signature
+// 3. Checks the move is allowed from the current status (409)
+// 4. Records the HR's decision
+// 5. Generates a unique MD token to approve (approvals) or review (rejections) the request
+// 6. Saves changes to database and queues an email notification to MD and/or staff
 //
 // Returns: Success message on completion
-// Side effect: Sends email asynchronously
+// Side effect: Queues the email in the outbox with the decision
 func HandleHRManagerAction(w http.ResponseWriter, r *http.Request) {
 	if !validateHTTPMethod(w, r.Method, http.MethodPost) {
 		return
@@ -696,86 +987,105 @@ func HandleHRManagerAction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate rejection reason if status is Rejected
-	if req.Status == StatusRejected && req.Reason == "" {
-		log.Printf("[WARN] HR rejection attempted without reason for token: %s", req.Token)
-		respondError(w, http.StatusBadRequest, ErrMissingRejectionReason)
+	// Retrieve the leave request through its unused, unexpired link
+	link, leaveReq, ok := requestByLink(w, req.Token, models.LinkHR)
+	if !ok || !checkLinkCode(w, link, req.Code) {
 		return
 	}
 
-	// Validate MD email if approving
-	if req.Status == StatusApproved && req.MDEmail == "" {
-		respondError(w, http.StatusBadRequest, "md_email is required for approval")
-		return
+	outcome, err := decideHR(r, link, leaveReq, req)
+	respondDecision(w, outcome, err)
+}
+
+// decideHR records HR's review decision on leaveReq, made through link. It is
+// shared by the approval link and the approver inbox.
+func decideHR(r *http.Request, link models.ApprovalLink, leaveReq models.LeaveRequest, req HRActionRequest) (decisionOutcome, error) {
+	if workflow.State(leaveReq.Status) != workflow.StatePendingHRReview {
+		log.Printf("[ERROR] HR review link for request %d used while it is %q", leaveReq.ID, leaveReq.Status)
+		return decisionOutcome{}, refuseDecision(http.StatusNotFound, ErrTokenNotFound)
 	}
 
-	// Retrieve the leave request
-	var leaveReq models.LeaveRequest
-	if err := database.DB.Where("resource_token = ?", req.Token).First(&leaveReq).Error; err != nil {
-		log.Printf("[ERROR] Leave request not found for HR token: %s", req.Token)
-		respondError(w, http.StatusNotFound, ErrRequestNotFound)
-		return
+	decision, err := parseDecision(req.Status, req.Reason)
+	if err != nil {
+		return decisionOutcome{}, err
+	}
+	if err := checkSignature(req.Signature, decision == workflow.DecisionApproved); err != nil {
+		return decisionOutcome{}, err
+	}
+
+	// Validate MD email, which the MD needs to approve the request or review a rejection
+	forwarded := decision != workflow.DecisionReturned
+	if forwarded && req.MDEmail == "" {
+		return decisionOutcome{}, refuseDecision(http.StatusBadRequest, "md_email is required unless returning for correction")
+	}
+	if forwarded {
+		if err := checkRoleHolder(req.MDEmail, models.RoleMD); err != nil {
+			return decisionOutcome{}, err
+		}
+	}
+
+	from := workflow.State(leaveReq.Status)
+	next, err := workflow.Transition(from, workflow.ActorHR, decision)
+	if err != nil {
+		return decisionOutcome{}, transitionRefused(leaveReq.ID, err)
 	}
 
 	// Record the HR's decision
-	leaveReq.HRDecision = req.Status
-	leaveReq.HRApproved = (req.Status == StatusApproved)
+	leaveReq.Status = string(next)
+	leaveReq.HRDecision = string(decision)
+	leaveReq.HRApproved = (decision == workflow.DecisionApproved)
 	leaveReq.MDEmail = req.MDEmail
+	leaveReq.HRToken = nil
+
+	entry := linkAuditEntry(r, link, string(workflow.ActorHR), string(decision), req.Reason)
+	entry.Signature = req.Signature
+	entry.ForwardedTo = req.MDEmail
+
+	// Handle return path, sending the request back to the staff to correct
+	if decision == workflow.DecisionReturned {
+		return returnForCorrection(&leaveReq, from, link, entry, "HR Department", req.Reason)
+	}
 
 	// Handle approval path
 	if leaveReq.HRApproved {
-		leaveReq.Status = StatusPendingMDApproval
 		MDTokenStr := uuid.New().String()
 		leaveReq.MDToken = &MDTokenStr
+		mdLink := newLink(leaveReq.ID, models.LinkMD, leaveReq.MDEmail, MDTokenStr)
 
-		if err := database.DB.Save(&leaveReq).Error; err != nil {
+		notify := service.MDRequestEmail(linkRecipient(mdLink), leaveReq, signedToken(mdLink))
+		if err := saveDecision(database.DB, &leaveReq, from, link, mdLink, entry, notify); err != nil {
 			log.Printf("[ERROR] Failed to save HR approval: %v", err)
-			respondError(w, http.StatusInternalServerError, ErrSaveAction)
-			return
+			return decisionOutcome{}, actionSaveError(err, ErrSaveAction)
 		}
 
-		// Notify MD of approval
-		go func(mdEmail, staffName, token string) {
-			if err := service.SendToMD(mdEmail, staffName, token); err != nil {
-				log.Printf("[ERROR] Failed to send email to MD (%s): %v", mdEmail, err)
-			} else {
-				log.Printf("[INFO] MD notification sent for %s", staffName)
-			}
-		}(leaveReq.MDEmail, leaveReq.StaffName, MDTokenStr)
-
 		log.Printf("[INFO] HR approved request for %s, forwarded to MD", leaveReq.StaffName)
 
-		respondJSON(w, http.StatusOK, map[string]interface{}{
-			"message": "HR approved. Request forwarded to MD for final action.",
-			"status":  leaveReq.Status,
-		})
-		return
+		return decisionOutcome{
+			Message: "HR approved. Request forwarded to MD for final action.",
+			Status:  leaveReq.Status,
+		}, nil
 	}
 
-	// Handle rejection path
-	leaveReq.Status = StatusRejectedByHR
+	// Handle rejection path, notifying the staff and sending the rejection to the MD to review
+	MDTokenStr := uuid.New().String()
+	leaveReq.MDToken = &MDTokenStr
+	mdLink := newLink(leaveReq.ID, models.LinkMD, leaveReq.MDEmail, MDTokenStr)
 
-	if err := database.DB.Save(&leaveReq).Error; err != nil {
+	notify := []service.Message{
+		service.RejectionUnderReviewEmail(leaveReq, "HR Department", req.Reason),
+		service.RejectionReviewEmail(linkRecipient(mdLink), leaveReq, req.Reason, signedToken(mdLink)),
+	}
+	if err := saveDecision(database.DB, &leaveReq, from, link, mdLink, entry, notify...); err != nil {
 		log.Printf("[ERROR] Failed to save HR rejection: %v", err)
-		respondError(w, http.StatusInternalServerError, ErrSaveAction)
-		return
+		return decisionOutcome{}, actionSaveError(err, ErrSaveAction)
 	}
 
-	// Notify staff of rejection
-	go func(staffEmail, staffName, reason string) {
-		if err := service.SendRejectionNotification(staffEmail, staffName, "HR Department", reason); err != nil {
-			log.Printf("[ERROR] Failed to send rejection email to staff (%s): %v", staffEmail, err)
-		} else {
-			log.Printf("[INFO] HR rejection notification sent to staff %s", staffName)
-		}
-	}(leaveReq.StaffEmail, leaveReq.StaffName, req.Reason)
-
-	log.Printf("[INFO] HR rejected request for %s, staff notified", leaveReq.StaffName)
+	log.Printf("[INFO] HR rejected request for %s, staff notified and sent to MD for review", leaveReq.StaffName)
 
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"message": "Request rejected by HR. Staff has been notified.",
-		"status":  leaveReq.Status,
-	})
+	return decisionOutcome{
+		Message: "Request rejected by HR. Staff has been notified and the MD will review the rejection.",
+		Status:  leaveReq.Status,
+	}, nil
 }
 
 // HandleMDAction processes the Managing Director's final approval or rejection decision.
@@ -783,19 +1093,20 @@ func HandleHRManagerAction(w http.ResponseWriter, r *http.Request) {
 //
 // Request body:
 // - token: MD token (required)
-// - status: "Approved" or "Rejected" (required)
-// - reason: Rejection reason (required if status is "Rejected")
+// - status: "Approved", "Rejected" or "Returned for Correction" (required)
+// - reason: Rejection reason, or what needs correcting (required unless status is "Approved")
+// - signature: Approver signature as a PNG data URL (required if status is "Approved")
 //
 // Workflow:
-// 1. Validates rejection reason if applicable
-// 2. Records the MD's final decision
-// 3. Sets final status (Fully Approved or Rejected by MD)
-// 4. Generates a final archive token (for approvals) or notifies staff (for rejections)
-// 5. Saves changes to database
-// 6. Sends email notification to HR or staff
+// 1. Checks the link is still valid (410)
+// 2. Validates the decision, rejection reason and signature
+// 3. Checks the move is allowed from the current status (409)
+// 4. Records the MD's final decision
+// 5. Generates a final archive token (for approvals) or notifies staff (for rejections and returns)
+// 6. Saves changes to database and queues an email notification to HR or staff
 //
 // Returns: Final status message on completion
-// Side effect: Sends email asynchronously
+// Side effect: Queues the email in the outbox with the decision
 func HandleMDAction(w http.ResponseWriter, r *http.Request) {
 	if !validateHTTPMethod(w, r.Method, http.MethodPost) {
 		return
@@ -808,107 +1119,119 @@ func HandleMDAction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Retrieve the leave request
-	var leaveReq models.LeaveRequest
-	if err := database.DB.Where("director_token = ?", req.Token).First(&leaveReq).Error; err != nil {
-		log.Printf("[ERROR] Leave request not found for MD token: %s", req.Token)
-		respondError(w, http.StatusNotFound, ErrRequestNotFound)
+	// Retrieve the leave request through its unused, unexpired link
+	link, leaveReq, ok := requestByLink(w, req.Token, models.LinkMD)
+	if !ok || !checkLinkCode(w, link, req.Code) {
 		return
 	}
 
+	outcome, err := decideMD(r, link, leaveReq, req)
+	respondDecision(w, outcome, err)
+}
+
+// decideMD records the MD's final decision on leaveReq, made through link. It
+// is shared by the approval link and the approver inbox.
+func decideMD(r *http.Request, link models.ApprovalLink, leaveReq models.LeaveRequest, req MDActionRequest) (decisionOutcome, error) {
+	decision, err := parseDecision(req.Status, req.Reason)
+	if err != nil {
+		return decisionOutcome{}, err
+	}
+	if err := checkSignature(req.Signature, decision == workflow.DecisionApproved); err != nil {
+		return decisionOutcome{}, err
+	}
+
+	from := workflow.State(leaveReq.Status)
+	next, err := workflow.Transition(from, workflow.ActorMD, decision)
+	if err != nil {
+		return decisionOutcome{}, transitionRefused(leaveReq.ID, err)
+	}
+
 	// Record the MD's final decision
-	leaveReq.MDDecision = req.Status
-	leaveReq.MDApproved = (req.Status == StatusApproved)
+	leaveReq.Status = string(next)
+	leaveReq.MDDecision = string(decision)
+	leaveReq.MDApproved = (decision == workflow.DecisionApproved)
+	leaveReq.MDToken = nil
+
+	entry := linkAuditEntry(r, link, string(workflow.ActorMD), string(decision), req.Reason)
+	entry.Signature = req.Signature
+	if leaveReq.MDApproved {
+		entry.ForwardedTo = leaveReq.HREmail
+	}
+
+	// Handle return path, sending the request back to the staff to correct
+	if decision == workflow.DecisionReturned {
+		return returnForCorrection(&leaveReq, from, link, entry, "Managing Director", req.Reason)
+	}
 
 	// Handle approval path
 	if leaveReq.MDApproved {
-		leaveReq.Status = StatusFullyApproved
 		FinalHRTokenStr := uuid.New().String()
 		leaveReq.FinalHRToken = &FinalHRTokenStr
+		leaveReq.RecordPending = true
+		finalLink := newLink(leaveReq.ID, models.LinkFinal, leaveReq.HREmail, FinalHRTokenStr)
 
-		if err := database.DB.Save(&leaveReq).Error; err != nil {
+		notify := service.FinalArchiveEmail(linkRecipient(finalLink), leaveReq, signedToken(finalLink))
+		if err := saveDecision(database.DB, &leaveReq, from, link, finalLink, entry, notify); err != nil {
 			log.Printf("[ERROR] Failed to finalize request: %v", err)
-			respondError(w, http.StatusInternalServerError, ErrFinalizeRequest)
-			return
+			return decisionOutcome{}, actionSaveError(err, ErrFinalizeRequest)
 		}
 
-		// Notify HR of final approval
-		go func(hrEmail, staffName, token string) {
-			if err := service.SendFinalArchiveToHR(hrEmail, staffName, token); err != nil {
-				log.Printf("[ERROR] Failed to send final archive email to HR (%s): %v", hrEmail, err)
-			} else {
-				log.Printf("[INFO] Final archive notification sent for %s", staffName)
-			}
-		}(leaveReq.HREmail, leaveReq.StaffName, FinalHRTokenStr)
+		// Archive and email the final record
+		wakeRecordWorker()
 
 		log.Printf("[INFO] MD approved request for %s, workflow complete", leaveReq.StaffName)
 
-		respondJSON(w, http.StatusOK, map[string]interface{}{
-			"message": "Leave request fully approved. HR has been notified.",
-			"status":  leaveReq.Status,
-		})
-		return
+		return decisionOutcome{
+			Message: "Leave request fully approved. HR has been notified.",
+			Status:  leaveReq.Status,
+		}, nil
 	}
 
-	// Handle rejection path
-	leaveReq.Status = StatusRejectedByMD
-
-	if err := database.DB.Save(&leaveReq).Error; err != nil {
+	// Handle rejection path, notifying the staff
+	notify := service.RejectionEmail(leaveReq, "Managing Director", req.Reason)
+	if err := saveDecision(database.DB, &leaveReq, from, link, nil, entry, notify); err != nil {
 		log.Printf("[ERROR] Failed to save MD rejection: %v", err)
-		respondError(w, http.StatusInternalServerError, ErrFinalizeRequest)
-		return
+		return decisionOutcome{}, actionSaveError(err, ErrFinalizeRequest)
 	}
 
-	// Notify staff of final rejection
-	go func(staffEmail, staffName, reason string) {
-		if err := service.SendRejectionNotification(staffEmail, staffName, "Managing Director", reason); err != nil {
-			log.Printf("[ERROR] Failed to send rejection email to staff (%s): %v", staffEmail, err)
-		} else {
-			log.Printf("[INFO] MD rejection notification sent to staff %s", staffName)
-		}
-	}(leaveReq.StaffEmail, leaveReq.StaffName, req.Reason)
-
 	log.Printf("[INFO] MD rejected request for %s, staff notified", leaveReq.StaffName)
 
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"message": "Request rejected by MD. Staff has been notified.",
-		"status":  leaveReq.Status,
-	})
+	return decisionOutcome{
+		Message: "Request rejected by MD. Staff has been notified.",
+		Status:  leaveReq.Status,
+	}, nil
 }
 
+// DownloadAndArchiveLeavePDF serves the archived leave record through the
+// final archive link. The record is generated and emailed once, when the
+// request is fully approved; later downloads are served from storage.
+//
+// Query params:
+// - token: Final archive token (required)
 func DownloadAndArchiveLeavePDF(w http.ResponseWriter, r *http.Request) {
 	token := r.URL.Query().Get("token")
 
-	// 1. Fetch Request from DB
-	var leave models.LeaveRequest
-	if err := database.DB.Where("final_token = ?", token).First(&leave).Error; err != nil {
-		http.Error(w, "Leave record not found", http.StatusNotFound)
+	// 1. Fetch Request from DB (the archive link must not have expired)
+	_, leave, ok := requestByLink(w, token, models.LinkFinal)
+	if !ok {
 		return
 	}
 
-	// 2. Generate the PDF bytes
-	pdfBytes, err := service.GenerateLeavePDF(leave)
+	// 2. Load the archived PDF (archiving it now for requests approved before archiving)
+	pdfBytes, doc, err := leaveRecord(database.DB, leave)
 	if err != nil {
+		log.Printf("[ERROR] Failed to load leave record for request %d: %v", leave.ID, err)
 		http.Error(w, "Failed to generate PDF", 500)
 		return
 	}
 
-	// 3. Email Staff and HR (Run in background)
-	go func() {
-		subject := "Finalized Leave Record: " + leave.StaffName
-		body := "<p>Attached is the official record of your leave request approval.</p>"
-
-		// Email to Staff
-		service.SendEmailAttachment(leave.StaffEmail, subject, body, pdfBytes, "Leave_Record.pdf")
-
-		// Email to HR (assuming leave.HREmail exists)
-		if leave.HREmail != "" {
-			service.SendEmailAttachment(leave.HREmail, subject, body, pdfBytes, "Leave_Record.pdf")
+	// 3. Email Staff and HR if that has not happened yet
+	if doc.EmailedAt == nil {
+		if err := sendLeaveRecord(database.DB, leave, doc, pdfBytes); err != nil {
+			log.Printf("[ERROR] Failed to queue leave record %s: %v", doc.DocumentID, err)
 		}
-	}()
+	}
 
 	// 4. Force Download in Browser
-	w.Header().Set("Content-Type", "application/pdf")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=Leave_Record_%s.pdf", leave.StaffNo))
-	w.Write(pdfBytes)
+	writePDF(w, "Leave_Record_"+leave.Reference()+".pdf", pdfBytes)
 }
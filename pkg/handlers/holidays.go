@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/calendar"
+	"github.com/JpUnique/petrodata-leave-project/pkg/database"
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+)
+
+// ============================================================================
+// PUBLIC HOLIDAY CALENDAR
+// ============================================================================
+
+// HolidayRequest represents a movable holiday declared by HR.
+type HolidayRequest struct {
+	Date string `json:"date"` // YYYY-MM-DD
+	Name string `json:"name"`
+}
+
+// ListPublicHolidays returns every holiday for a year, fixed and movable.
+// The leave form uses this to preview working days the same way the server counts them.
+//
+// Query params:
+// - year: Calendar year (defaults to the current year)
+func ListPublicHolidays(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodGet) {
+		return
+	}
+
+	year := time.Now().Year()
+	if v := r.URL.Query().Get("year"); v != "" {
+		y, err := strconv.Atoi(v)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "year must be a number")
+			return
+		}
+		year = y
+	}
+
+	cal, err := calendar.Load(database.DB, year)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load holiday calendar for %d: %v", year, err)
+		respondError(w, http.StatusInternalServerError, "failed to load holidays")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, cal.Holidays())
+}
+
+// ManagePublicHolidays serves /api/admin/holidays: POST declares a movable
+// holiday, DELETE (with ?id=) removes one.
+func ManagePublicHolidays(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		createPublicHoliday(w, r)
+	case http.MethodDelete:
+		deletePublicHoliday(w, r)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+	}
+}
+
+func createPublicHoliday(w http.ResponseWriter, r *http.Request) {
+	var req HolidayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, ErrInvalidJSON)
+		return
+	}
+
+	date, err := calendar.Parse(req.Date)
+	if err != nil || strings.TrimSpace(req.Name) == "" {
+		respondError(w, http.StatusBadRequest, "date (YYYY-MM-DD) and name are required")
+		return
+	}
+
+	holiday := models.PublicHoliday{Date: date, Name: strings.TrimSpace(req.Name), CreatedAt: time.Now()}
+	if err := database.DB.Create(&holiday).Error; err != nil {
+		log.Printf("[ERROR] Failed to save holiday %s: %v", req.Date, err)
+		respondError(w, http.StatusConflict, "a holiday already exists on that date")
+		return
+	}
+
+	log.Printf("[INFO] Public holiday declared: %s on %s", holiday.Name, req.Date)
+	respondJSON(w, http.StatusCreated, calendar.Holiday{ID: holiday.ID, Date: req.Date, Name: holiday.Name, Movable: true})
+}
+
+func deletePublicHoliday(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "id is required")
+		return
+	}
+
+	result := database.DB.Delete(&models.PublicHoliday{}, id)
+	if result.Error != nil {
+		log.Printf("[ERROR] Failed to delete holiday %d: %v", id, result.Error)
+		respondError(w, http.StatusInternalServerError, "failed to delete holiday")
+		return
+	}
+	if result.RowsAffected == 0 {
+		respondError(w, http.StatusNotFound, "holiday not found")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Holiday removed"})
+}
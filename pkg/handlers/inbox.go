@@ -0,0 +1,613 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/database"
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"github.com/JpUnique/petrodata-leave-project/pkg/outbox"
+	"github.com/JpUnique/petrodata-leave-project/pkg/service"
+	"github.com/JpUnique/petrodata-leave-project/pkg/utils"
+	"github.com/JpUnique/petrodata-leave-project/pkg/workflow"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// APPROVER INBOX
+// ============================================================================
+
+// maxInboxBatch bounds how many items one bulk action may decide.
+const maxInboxBatch = 50
+
+// InboxActionRequest represents an approver deciding several inbox items at once.
+type InboxActionRequest struct {
+	Items     []InboxActionItem `json:"items"`
+	Signature string            `json:"signature,omitempty"` // PNG data URL applied to every approval
+	Code      string            `json:"code,omitempty"`      // Confirmation code from /api/inbox/code, when REQUIRE_APPROVER_CODE is set
+}
+
+// InboxCodeRequest represents an approver asking for a confirmation code
+// covering several inbox items.
+type InboxCodeRequest struct {
+	IDs []uint `json:"ids"` // Leave request IDs the code will be entered for
+}
+
+// InboxActionItem is the decision on one inbox item.
+type InboxActionItem struct {
+	ID        uint   `json:"id"`     // Leave request ID
+	Status    string `json:"status"` // "Approved", "Rejected" or "Returned for Correction"
+	Reason    string `json:"reason,omitempty"`
+	ForwardTo string `json:"forward_to,omitempty"` // Next approver, when the step's forward_to says one is needed
+}
+
+// inboxItem is one request waiting on the signed-in approver.
+type inboxItem struct {
+	ID                uint        `json:"id"`
+	Reference         string      `json:"reference"`
+	Step              string      `json:"step"`
+	Status            string      `json:"status"`
+	StaffName         string      `json:"staff_name"`
+	StaffNo           string      `json:"staff_no"`
+	Department        string      `json:"department"`
+	LeaveType         string      `json:"leave_type"`
+	StartDate         models.Date `json:"start_date"`
+	ResumptionDate    models.Date `json:"resumption_date"`
+	TotalDays         int         `json:"total_days"`
+	ReliefStaff       string      `json:"relief_staff"`
+	SubmittedAt       time.Time   `json:"submitted_at"`
+	WaitingSince      time.Time   `json:"waiting_since"`
+	WaitingDays       int         `json:"waiting_days"`
+	OnBehalfOf        string      `json:"on_behalf_of,omitempty"`
+	ForwardTo         string      `json:"forward_to,omitempty"` // "hr", "md" or "next_approver" when a decision must name one
+	SignatureRequired bool        `json:"signature_required"`
+}
+
+// inboxActionResult is the outcome of one item of a bulk action.
+type inboxActionResult struct {
+	ID      uint   `json:"id"`
+	OK      bool   `json:"ok"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status,omitempty"` // Request status after the decision
+}
+
+// inboxStep is a kind of pending action: the request state it is found in,
+// who it waits on, the role they must hold and the decision function that
+// settles it.
+type inboxStep struct {
+	approvalStep      // Empty columns for chain stages, whose approver is on the stage
+	name              string
+	role              models.Role // Empty for chain stages, whose approvers HR names on the chain
+	forwardTo         string
+	signatureRequired bool
+	decide            func(r *http.Request, link models.ApprovalLink, leave models.LeaveRequest, item InboxActionItem, signature string) (decisionOutcome, error)
+}
+
+var inboxSteps = []inboxStep{
+	{
+		approvalStep: approvalStep{workflow.StatePending, models.LinkManager, "request_token", "manager_email"},
+		name:         string(workflow.ActorLineManager), role: models.RoleLineManager, forwardTo: "hr", signatureRequired: true,
+		decide: func(r *http.Request, link models.ApprovalLink, leave models.LeaveRequest, item InboxActionItem, signature string) (decisionOutcome, error) {
+			return decideManager(r, link, leave, ManagerActionRequest{Status: item.Status, HREmail: item.ForwardTo, Reason: item.Reason, Signature: signature})
+		},
+	},
+	{
+		approvalStep: approvalStep{workflow.StatePendingHRReview, models.LinkHR, "resource_token", "hr_email"},
+		name:         string(workflow.ActorHR), role: models.RoleHR, forwardTo: "md", signatureRequired: true,
+		decide: func(r *http.Request, link models.ApprovalLink, leave models.LeaveRequest, item InboxActionItem, signature string) (decisionOutcome, error) {
+			return decideHR(r, link, leave, HRActionRequest{Status: item.Status, MDEmail: item.ForwardTo, Reason: item.Reason, Signature: signature})
+		},
+	},
+	{
+		approvalStep: approvalStep{workflow.StateCancellationRequested, models.LinkCancellation, "resource_token", "hr_email"},
+		name:         auditStageCancellation, role: models.RoleHR,
+		decide: func(r *http.Request, link models.ApprovalLink, leave models.LeaveRequest, item InboxActionItem, _ string) (decisionOutcome, error) {
+			return decideCancellation(r, link, leave, CancellationActionRequest{Status: item.Status, Reason: item.Reason})
+		},
+	},
+	{
+		approvalStep: approvalStep{workflow.StateRejectedByManager, models.LinkHR, "resource_token", "hr_email"},
+		name:         auditStageFiling, role: models.RoleHR,
+		decide: func(r *http.Request, link models.ApprovalLink, leave models.LeaveRequest, item InboxActionItem, _ string) (decisionOutcome, error) {
+			return decideFiling(r, link, leave, FilingActionRequest{Reason: item.Reason}) // Filing has no decision to choose
+		},
+	},
+	{
+		approvalStep: approvalStep{workflow.StateRejectedByHR, models.LinkMD, "director_token", "md_email"},
+		name:         auditStageMDReview, role: models.RoleMD, signatureRequired: true,
+		decide: func(r *http.Request, link models.ApprovalLink, leave models.LeaveRequest, item InboxActionItem, signature string) (decisionOutcome, error) {
+			// Approving overturns HR's rejection, rejecting upholds it
+			status := item.Status
+			switch workflow.Decision(status) {
+			case workflow.DecisionApproved:
+				status = string(workflow.DecisionOverturned)
+			case workflow.DecisionRejected:
+				status = string(workflow.DecisionUpheld)
+			}
+			return decideMDReview(r, link, leave, MDReviewRequest{Status: status, Reason: item.Reason, Signature: signature})
+		},
+	},
+	{
+		approvalStep: approvalStep{workflow.StatePendingMDApproval, models.LinkMD, "director_token", "md_email"},
+		name:         string(workflow.ActorMD), role: models.RoleMD, signatureRequired: true,
+		decide: func(r *http.Request, link models.ApprovalLink, leave models.LeaveRequest, item InboxActionItem, signature string) (decisionOutcome, error) {
+			return decideMD(r, link, leave, MDActionRequest{Status: item.Status, Reason: item.Reason, Signature: signature})
+		},
+	},
+	{
+		approvalStep: approvalStep{state: workflow.StatePendingStage, purpose: models.LinkStage},
+		name:         string(workflow.ActorStageApprover),
+		decide: func(r *http.Request, link models.ApprovalLink, leave models.LeaveRequest, item InboxActionItem, signature string) (decisionOutcome, error) {
+			return decideStage(r, link, leave, StageActionRequest{Status: item.Status, NextApproverEmail: item.ForwardTo, Reason: item.Reason, Signature: signature})
+		},
+	},
+}
+
+// pendingAction is a request waiting on an approver at one of its steps.
+type pendingAction struct {
+	leave     models.LeaveRequest
+	step      inboxStep
+	principal string                    // Approver recorded for the step
+	stage     *models.LeaveRequestStage // Current chain stage, for stage steps
+	link      *models.ApprovalLink      // Latest link issued for the step, if any
+}
+
+// waitingSince is when the step was last sent to its approver.
+func (a pendingAction) waitingSince() time.Time {
+	if a.link != nil {
+		return a.link.IssuedAt
+	}
+	return a.leave.CreatedAt
+}
+
+// inboxPrincipals returns the approvers whose steps email acts on: email
+// itself and everyone whose delegation to email is in force today.
+func inboxPrincipals(db *gorm.DB, email string) ([]string, error) {
+	var delegators []string
+	today := models.Today()
+	err := db.Model(&models.Delegation{}).
+		Where("delegate_email = ? AND starts_on <= ? AND ends_on >= ?", email, today, today).
+		Distinct().Pluck("principal_email", &delegators).Error
+	if err != nil {
+		return nil, err
+	}
+	principals := []string{email}
+	for _, p := range delegators {
+		if p != email && activeDelegate(p) == email { // A later delegation may have replaced this one
+			principals = append(principals, p)
+		}
+	}
+	return principals, nil
+}
+
+// pendingActions returns every request whose current step waits on email or
+// on an approver who delegated to email, oldest first. Requests are found by
+// their status and recorded approver, so a request stays listed after its
+// emailed link has expired. Steps needing a role email does not hold are
+// left out, whoever they are addressed to.
+func pendingActions(db *gorm.DB, email string) ([]pendingAction, error) {
+	principals, err := inboxPrincipals(db, email)
+	if err != nil {
+		return nil, err
+	}
+
+	var actions []pendingAction
+	for _, step := range inboxSteps {
+		if step.role != "" {
+			ok, err := hasRole(db, email, step.role)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		found, err := pendingAtStep(db, step, principals)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, found...)
+	}
+	if len(actions) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint, len(actions))
+	for i, a := range actions {
+		ids[i] = a.leave.ID
+	}
+	var links []models.ApprovalLink
+	if err := db.Where("leave_request_id IN ?", ids).Order("issued_at ASC").Find(&links).Error; err != nil {
+		return nil, err
+	}
+	type stepKey struct {
+		requestID uint
+		purpose   string
+	}
+	latest := make(map[stepKey]models.ApprovalLink, len(links))
+	for _, link := range links {
+		latest[stepKey{link.LeaveRequestID, link.Purpose}] = link
+	}
+	for i := range actions {
+		if link, ok := latest[stepKey{actions[i].leave.ID, actions[i].step.purpose}]; ok {
+			actions[i].link = &link
+		}
+	}
+
+	sort.SliceStable(actions, func(i, j int) bool {
+		return actions[i].waitingSince().Before(actions[j].waitingSince())
+	})
+	return actions, nil
+}
+
+// pendingAtStep returns the requests waiting at step on one of principals.
+func pendingAtStep(db *gorm.DB, step inboxStep, principals []string) ([]pendingAction, error) {
+	var requests []models.LeaveRequest
+	if step.purpose == models.LinkStage {
+		var stages []models.LeaveRequestStage
+		err := db.Joins("JOIN leave_requests ON leave_requests.id = leave_request_stages.leave_request_id AND leave_requests.current_stage = leave_request_stages.position").
+			Where("leave_requests.status = ? AND LOWER(TRIM(leave_request_stages.approver_email)) IN ?", string(step.state), principals).
+			Find(&stages).Error
+		if err != nil || len(stages) == 0 {
+			return nil, err
+		}
+		byRequest := make(map[uint]models.LeaveRequestStage, len(stages))
+		ids := make([]uint, 0, len(stages))
+		for _, s := range stages {
+			byRequest[s.LeaveRequestID] = s
+			ids = append(ids, s.LeaveRequestID)
+		}
+		if err := db.Where("id IN ?", ids).Find(&requests).Error; err != nil {
+			return nil, err
+		}
+		actions := make([]pendingAction, 0, len(requests))
+		for _, l := range requests {
+			stage := byRequest[l.ID]
+			actions = append(actions, pendingAction{leave: l, step: step, principal: utils.NormalizeEmail(stage.ApproverEmail), stage: &stage})
+		}
+		return actions, nil
+	}
+
+	err := db.Where("status = ? AND LOWER(TRIM("+step.emailColumn+")) IN ?", string(step.state), principals).
+		Find(&requests).Error
+	if err != nil {
+		return nil, err
+	}
+	actions := make([]pendingAction, 0, len(requests))
+	for _, l := range requests {
+		actions = append(actions, pendingAction{leave: l, step: step, principal: utils.NormalizeEmail(stepApprover(l, step))})
+	}
+	return actions, nil
+}
+
+// stepApprover returns the approver recorded on l for a built-in step.
+func stepApprover(l models.LeaveRequest, step inboxStep) string {
+	switch step.emailColumn {
+	case "manager_email":
+		return l.ManagerEmail
+	case "hr_email":
+		return l.HREmail
+	case "md_email":
+		return l.MDEmail
+	}
+	return ""
+}
+
+// actingLink returns the link email decides a through: the step's latest
+// link when it is still open and addressed to them, otherwise a new one
+// replacing it. An expired or delegated link does not keep an approver from
+// acting in the inbox.
+func actingLink(db *gorm.DB, a pendingAction, email string) (models.ApprovalLink, error) {
+	if a.link != nil && a.link.ApproverEmail == email && checkLinkOpen(*a.link) == nil {
+		return *a.link, nil
+	}
+
+	now := time.Now()
+	link := models.ApprovalLink{
+		Token:          uuid.New().String(),
+		LeaveRequestID: a.leave.ID,
+		Purpose:        a.step.purpose,
+		ApproverEmail:  email,
+		IssuedAt:       now,
+		ExpiresAt:      now.Add(utils.ApprovalLinkTTL()),
+	}
+	if email != a.principal {
+		link.OnBehalfOf = a.principal
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var result *gorm.DB
+		if a.stage != nil {
+			result = tx.Model(&models.LeaveRequestStage{}).Where("id = ? AND decision = ''", a.stage.ID).Update("token", link.Token)
+		} else {
+			result = tx.Model(&models.LeaveRequest{}).Where("id = ? AND status = ?", a.leave.ID, a.leave.Status).Update(a.step.tokenColumn, link.Token)
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errConcurrentUpdate
+		}
+		return issueLink(tx, &link)
+	})
+	if err == nil {
+		log.Printf("[INFO] Issued a new %s link for request %d to %s acting from the inbox", link.Purpose, a.leave.ID, email)
+	}
+	return link, err
+}
+
+// toInboxItem describes a pending action of email for the inbox listing.
+func toInboxItem(a pendingAction, email string) inboxItem {
+	waitingSince := a.waitingSince()
+	item := inboxItem{
+		ID:                a.leave.ID,
+		Reference:         a.leave.Reference(),
+		Step:              a.step.name,
+		Status:            a.leave.Status,
+		StaffName:         a.leave.StaffName,
+		StaffNo:           a.leave.StaffNo,
+		Department:        a.leave.Department,
+		LeaveType:         a.leave.LeaveType,
+		StartDate:         a.leave.StartDate,
+		ResumptionDate:    a.leave.ResumptionDate,
+		TotalDays:         a.leave.TotalDays,
+		ReliefStaff:       a.leave.ReliefStaff,
+		SubmittedAt:       a.leave.CreatedAt,
+		WaitingSince:      waitingSince,
+		WaitingDays:       int(time.Since(waitingSince).Hours() / 24),
+		ForwardTo:         a.step.forwardTo,
+		SignatureRequired: a.step.signatureRequired,
+	}
+	if a.principal != email {
+		item.OnBehalfOf = a.principal
+	}
+	if a.stage != nil {
+		item.Step = a.stage.Name
+	}
+	return item
+}
+
+// inboxApprover returns the account email of the signed-in approver. Steps
+// are matched against the email stored on the account, which is normalized
+// and unique, not against whatever the token carries. It writes a 401
+// response and returns false if there is no such account.
+func inboxApprover(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userEmail, ok := r.Context().Value("userEmail").(string)
+	if !ok || userEmail == "" {
+		respondError(w, http.StatusUnauthorized, "Unauthorized: email not found in session")
+		return "", false
+	}
+
+	var user models.User
+	if err := database.DB.Where("LOWER(email) = ?", utils.NormalizeEmail(userEmail)).First(&user).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("[ERROR] Failed to load account %s: %v", userEmail, err)
+		}
+		respondError(w, http.StatusUnauthorized, "Unauthorized: account not found")
+		return "", false
+	}
+	return user.Email, true
+}
+
+// GetApproverInbox lists the requests waiting on the signed-in approver,
+// oldest first, including those delegated to them.
+//
+// Returns: Pending items with their step, staff, dates, days and waiting time
+func GetApproverInbox(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodGet) {
+		return
+	}
+
+	userEmail, ok := inboxApprover(w, r)
+	if !ok {
+		return
+	}
+
+	actions, err := pendingActions(database.DB, userEmail)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load inbox for %s: %v", userEmail, err)
+		respondError(w, http.StatusInternalServerError, "failed to load inbox")
+		return
+	}
+
+	items := make([]inboxItem, 0, len(actions))
+	for _, a := range actions {
+		items = append(items, toInboxItem(a, userEmail))
+	}
+	respondJSON(w, http.StatusOK, items)
+}
+
+// HandleInboxActions approves or rejects several inbox items in one call.
+// Each item is decided independently by the same decision function as its
+// approval link, and its outcome is reported separately. An item whose link
+// has expired or went to someone else gets a new link for the signed-in
+// approver first.
+//
+// Request body:
+// - items: [{id, status, reason, forward_to}] (required, at most 50)
+// - signature: Approver signature as a PNG data URL (required to approve Manager, HR or MD steps)
+// - code: Confirmation code from /api/inbox/code (required when REQUIRE_APPROVER_CODE is set)
+//
+// Returns: One result per item with its HTTP code, message and new status
+func HandleInboxActions(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodPost) {
+		return
+	}
+
+	userEmail, ok := inboxApprover(w, r)
+	if !ok {
+		return
+	}
+
+	var req InboxActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, ErrInvalidJSON)
+		return
+	}
+	if len(req.Items) == 0 || len(req.Items) > maxInboxBatch {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("between 1 and %d items are required", maxInboxBatch))
+		return
+	}
+
+	actions, err := pendingActions(database.DB, userEmail)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load inbox for %s: %v", userEmail, err)
+		respondError(w, http.StatusInternalServerError, "failed to load inbox")
+		return
+	}
+	byID := make(map[uint]pendingAction, len(actions))
+	for _, a := range actions {
+		byID[a.leave.ID] = a
+	}
+
+	results := make([]inboxActionResult, 0, len(req.Items))
+	succeeded := 0
+	for _, item := range req.Items {
+		action, ok := byID[item.ID]
+		if !ok {
+			results = append(results, inboxActionResult{ID: item.ID, Code: http.StatusNotFound, Message: "this request is not waiting on you"})
+			continue
+		}
+		delete(byID, item.ID) // A request can only be decided once per call
+
+		result := decideInboxItem(r, action, item, req, userEmail)
+		if result.OK {
+			succeeded++
+		}
+		results = append(results, result)
+	}
+
+	log.Printf("[INFO] %s decided %d of %d inbox items", userEmail, succeeded, len(req.Items))
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"succeeded": succeeded,
+		"failed":    len(req.Items) - succeeded,
+		"results":   results,
+	})
+}
+
+// decideInboxItem settles item with the decision function of action's step,
+// acting as email through the step's link. The link's confirmation code is
+// checked as on the approval pages.
+func decideInboxItem(r *http.Request, action pendingAction, item InboxActionItem, req InboxActionRequest, email string) inboxActionResult {
+	result := inboxActionResult{ID: item.ID}
+
+	link, err := actingLink(database.DB, action, email)
+	if err != nil {
+		log.Printf("[ERROR] Failed to issue an inbox link for request %d: %v", action.leave.ID, err)
+		result.Code, result.Message = decisionErrorStatus(actionSaveError(err, ErrSaveAction))
+		return result
+	}
+
+	if utils.ApproverCodeRequired() {
+		if err := verifyLinkCode(link, req.Code); err != nil {
+			result.Code, result.Message = decisionErrorStatus(err)
+			return result
+		}
+	}
+
+	outcome, err := action.step.decide(r, link, action.leave, item, req.Signature)
+	if err != nil {
+		result.Code, result.Message = decisionErrorStatus(err)
+		return result
+	}
+
+	result.OK, result.Code = true, http.StatusOK
+	result.Message, result.Status = outcome.Message, outcome.Status
+	return result
+}
+
+// RequestInboxCode emails the signed-in approver one confirmation code for
+// the listed inbox items. When REQUIRE_APPROVER_CODE is set the code must
+// accompany their decisions in /api/inbox/actions, as it must on the
+// approval pages. Items whose link has expired or went to someone else get a
+// new link for the approver first, so the code is tied to the links they
+// will act through.
+//
+// Request body:
+// - ids: Leave request IDs (required, at most 50)
+func RequestInboxCode(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodPost) {
+		return
+	}
+
+	userEmail, ok := inboxApprover(w, r)
+	if !ok {
+		return
+	}
+
+	var req InboxCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, ErrInvalidJSON)
+		return
+	}
+	if len(req.IDs) == 0 || len(req.IDs) > maxInboxBatch {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("between 1 and %d items are required", maxInboxBatch))
+		return
+	}
+
+	actions, err := pendingActions(database.DB, userEmail)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load inbox for %s: %v", userEmail, err)
+		respondError(w, http.StatusInternalServerError, "failed to load inbox")
+		return
+	}
+	byID := make(map[uint]pendingAction, len(actions))
+	for _, a := range actions {
+		byID[a.leave.ID] = a
+	}
+
+	var links []models.ApprovalLink
+	covered := make(map[uint]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		if covered[id] {
+			continue
+		}
+		covered[id] = true
+		action, ok := byID[id]
+		if !ok {
+			respondError(w, http.StatusNotFound, fmt.Sprintf("request %d is not waiting on you", id))
+			return
+		}
+
+		link, err := actingLink(database.DB, action, userEmail)
+		if err != nil {
+			log.Printf("[ERROR] Failed to issue an inbox link for request %d: %v", id, err)
+			respondError(w, http.StatusInternalServerError, ErrSaveAction)
+			return
+		}
+		links = append(links, link)
+	}
+
+	code, hash, err := newLinkCode()
+	if err != nil {
+		log.Printf("[ERROR] Failed to generate confirmation code: %v", err)
+		respondError(w, http.StatusInternalServerError, ErrSaveAction)
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, link := range links {
+			if err := saveLinkCode(tx, link, hash); err != nil {
+				return err
+			}
+		}
+		return outbox.Enqueue(tx, 0, service.ApprovalCodeEmail(userEmail, code))
+	})
+	if err != nil {
+		log.Printf("[ERROR] Failed to save inbox confirmation code for %s: %v", userEmail, err)
+		respondError(w, http.StatusInternalServerError, ErrSaveAction)
+		return
+	}
+	outbox.Wake()
+
+	respondJSON(w, http.StatusOK, map[string]string{
+		"message": "A confirmation code has been sent to " + userEmail + ".",
+	})
+}
@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/database"
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"github.com/JpUnique/petrodata-leave-project/pkg/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ============================================================================
+// LEAVE TYPE CATALOGUE
+// ============================================================================
+
+// maxSupportingDocumentBytes bounds the size of a decoded supporting document.
+const maxSupportingDocumentBytes = 5 << 20
+
+// maxLeaveRequestBytes bounds a leave request body. It leaves room for a
+// supporting document at the limit, which base64 grows by a third.
+const maxLeaveRequestBytes = 7 << 20
+
+// supportingDocumentTypes maps the accepted data URL prefixes to the file
+// extension and magic bytes of each format.
+var supportingDocumentTypes = map[string]struct {
+	ext   string
+	magic []byte
+}{
+	"data:application/pdf;base64,": {"pdf", []byte("%PDF-")},
+	"data:image/png;base64,":       {"png", []byte("\x89PNG\r\n\x1a\n")},
+	"data:image/jpeg;base64,":      {"jpg", []byte("\xff\xd8\xff")},
+}
+
+// supportingDocumentContentTypes gives the Content-Type a stored document is served with.
+var supportingDocumentContentTypes = map[string]string{
+	".pdf": "application/pdf",
+	".png": "image/png",
+	".jpg": "image/jpeg",
+}
+
+// unknownLeaveTypeError is returned by findLeaveType for a type staff cannot choose.
+type unknownLeaveTypeError struct {
+	Choices []string // Names of the active types
+}
+
+func (e *unknownLeaveTypeError) Error() string {
+	return "leave_type must be one of " + strings.Join(e.Choices, ", ")
+}
+
+// findLeaveType returns the active catalogue entry named name, or an
+// *unknownLeaveTypeError if there is none.
+func findLeaveType(db *gorm.DB, name string) (models.LeaveType, error) {
+	var leaveType models.LeaveType
+	err := db.Where("name = ? AND active", strings.TrimSpace(name)).First(&leaveType).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return leaveType, err
+	}
+
+	unknown := &unknownLeaveTypeError{}
+	if err := db.Model(&models.LeaveType{}).Where("active").Order("name ASC").Pluck("name", &unknown.Choices).Error; err != nil {
+		return leaveType, err
+	}
+	return leaveType, unknown
+}
+
+// respondLeaveTypeError maps a failed findLeaveType to 400 or 500.
+func respondLeaveTypeError(w http.ResponseWriter, err error, message string) {
+	var unknown *unknownLeaveTypeError
+	if errors.As(err, &unknown) {
+		respondError(w, http.StatusBadRequest, unknown.Error())
+		return
+	}
+	log.Printf("[ERROR] Failed to load leave type: %v", err)
+	respondError(w, http.StatusInternalServerError, message)
+}
+
+// checkLeaveTypeRules checks a request for totalDays working days over dates
+// by staff against the rules of leaveType. Gender and length of service come
+// from the HR staff record, never from the form. hasDocument reports whether a
+// supporting document is attached. The error is worded for the staff member.
+func checkLeaveTypeRules(leaveType models.LeaveType, staff models.StaffRecord, dates leaveDates, totalDays int, hasDocument bool) error {
+	label := leaveType.Label
+	if label == "" {
+		label = leaveType.Name + " Leave"
+	}
+
+	if !leaveType.AllowsGender(staff.Gender) {
+		if staff.Gender == "" {
+			return fmt.Errorf("%s is limited to %s staff and your staff record has no gender on file. Please contact HR.", label, leaveType.AllowedGenders)
+		}
+		return fmt.Errorf("%s is only available to %s staff.", label, leaveType.AllowedGenders)
+	}
+	if leaveType.MinServiceMonths > 0 {
+		if staff.EmployedOn.IsZero() {
+			return fmt.Errorf("%s requires %d month(s) of service and your staff record has no employment date on file. Please contact HR.", label, leaveType.MinServiceMonths)
+		}
+		eligible := staff.EmployedOn.AddDate(0, leaveType.MinServiceMonths, 0)
+		if dates.Start.Before(eligible) {
+			return fmt.Errorf("%s requires %d month(s) of service; you are eligible from %s.", label, leaveType.MinServiceMonths, eligible.Format(models.DateLayout))
+		}
+	}
+	if leaveType.MaxConsecutiveDays > 0 && totalDays > leaveType.MaxConsecutiveDays {
+		return fmt.Errorf("%s is limited to %d consecutive working day(s), but you requested %d.", label, leaveType.MaxConsecutiveDays, totalDays)
+	}
+	if leaveType.MinNoticeDays > 0 {
+		earliest := dates.Submitted.AddDate(0, 0, leaveType.MinNoticeDays)
+		if dates.Start.Before(earliest) {
+			return fmt.Errorf("%s needs %d day(s) notice; the earliest start date is %s.", label, leaveType.MinNoticeDays, earliest.Format(models.DateLayout))
+		}
+	}
+	if leaveType.DocumentRequired && !hasDocument {
+		return fmt.Errorf("%s requires a supporting document (PDF, PNG or JPEG).", label)
+	}
+	return nil
+}
+
+// decodeLeaveRequestBody decodes a leave request body into v, reading at most
+// maxLeaveRequestBytes. It writes 413 or 400 (with message) and returns false
+// on failure.
+func decodeLeaveRequestBody(w http.ResponseWriter, r *http.Request, v interface{}, message string) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxLeaveRequestBytes)
+	err := json.NewDecoder(r.Body).Decode(v)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		respondError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("the request is too large; supporting documents must be under %d MB", maxSupportingDocumentBytes>>20))
+		return false
+	case err != nil:
+		log.Printf("[ERROR] Failed to decode leave request body: %v", err)
+		respondError(w, http.StatusBadRequest, message)
+		return false
+	}
+	return true
+}
+
+// decodeSupportingDocument decodes a supporting document sent as a PDF, PNG
+// or JPEG data URL and returns its bytes and file extension.
+func decodeSupportingDocument(dataURL string) ([]byte, string, error) {
+	for prefix, format := range supportingDocumentTypes {
+		encoded, ok := strings.CutPrefix(dataURL, prefix)
+		if !ok {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || !bytes.HasPrefix(data, format.magic) {
+			break
+		}
+		if len(data) > maxSupportingDocumentBytes {
+			return nil, "", fmt.Errorf("supporting_document must be under %d MB", maxSupportingDocumentBytes>>20)
+		}
+		return data, format.ext, nil
+	}
+	return nil, "", errors.New("supporting_document must be a PDF, PNG or JPEG data URL")
+}
+
+// storeSupportingDocument keeps a decoded supporting document in the archive
+// and returns its storage key.
+func storeSupportingDocument(data []byte, ext string) (string, error) {
+	key := fmt.Sprintf("supporting/%d/%s.%s", time.Now().Year(), uuid.New().String(), ext)
+	if err := storage.Archive.Put(key, data); err != nil {
+		return "", fmt.Errorf("store %s: %w", key, err)
+	}
+	return key, nil
+}
+
+// ListLeaveTypes returns the leave types staff can apply for, with their
+// rules. The leave form builds its type list from this.
+func ListLeaveTypes(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodGet) {
+		return
+	}
+
+	var types []models.LeaveType
+	if err := database.DB.Where("active").Order("name ASC").Find(&types).Error; err != nil {
+		log.Printf("[ERROR] Failed to list leave types: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to list leave types")
+		return
+	}
+	respondJSON(w, http.StatusOK, types)
+}
+
+// LeaveTypes serves /api/admin/leave-types: GET lists every type, retired
+// ones included, POST creates or replaces a type by name (and offers it
+// again if it was retired), DELETE (with ?id=) retires one. Retired types
+// stay on existing requests but cannot be chosen for new ones.
+func LeaveTypes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var types []models.LeaveType
+		if err := database.DB.Order("name ASC").Find(&types).Error; err != nil {
+			log.Printf("[ERROR] Failed to list leave types: %v", err)
+			respondError(w, http.StatusInternalServerError, "failed to list leave types")
+			return
+		}
+		respondJSON(w, http.StatusOK, types)
+
+	case http.MethodPost:
+		var leaveType models.LeaveType
+		if err := json.NewDecoder(r.Body).Decode(&leaveType); err != nil {
+			respondError(w, http.StatusBadRequest, ErrInvalidJSON)
+			return
+		}
+		leaveType.Name = strings.TrimSpace(leaveType.Name)
+		leaveType.Label = strings.TrimSpace(leaveType.Label)
+		if leaveType.Name == "" {
+			respondError(w, http.StatusBadRequest, "name is required")
+			return
+		}
+		if leaveType.Entitlement < 0 || leaveType.MaxConsecutiveDays < 0 || leaveType.MinNoticeDays < 0 || leaveType.MinServiceMonths < 0 {
+			respondError(w, http.StatusBadRequest, "entitlement, max_consecutive_days, min_notice_days and min_service_months cannot be negative")
+			return
+		}
+		if leaveType.Name == models.AnnualLeaveType {
+			leaveType.CountsAgainstAnnual = true
+		}
+		leaveType.ID = 0
+		leaveType.Active = true
+		leaveType.UpdatedAt = time.Now()
+
+		err := database.DB.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "name"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"label", "entitlement", "paid", "counts_against_annual", "max_consecutive_days",
+				"min_notice_days", "document_required", "allowed_genders", "min_service_months", "active", "updated_at",
+			}),
+		}).Create(&leaveType).Error
+		if err != nil {
+			log.Printf("[ERROR] Failed to save leave type %s: %v", leaveType.Name, err)
+			respondError(w, http.StatusInternalServerError, "failed to save leave type")
+			return
+		}
+
+		hrEmail, _ := r.Context().Value("userEmail").(string)
+		log.Printf("[INFO] %s saved leave type %s", hrEmail, leaveType.Name)
+		respondJSON(w, http.StatusOK, leaveType)
+
+	case http.MethodDelete:
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "id is required")
+			return
+		}
+
+		result := database.DB.Model(&models.LeaveType{}).Where("id = ? AND active", id).
+			Updates(map[string]interface{}{"active": false, "updated_at": time.Now()})
+		if result.Error != nil {
+			log.Printf("[ERROR] Failed to retire leave type %d: %v", id, result.Error)
+			respondError(w, http.StatusInternalServerError, "failed to retire leave type")
+			return
+		}
+		if result.RowsAffected == 0 {
+			respondError(w, http.StatusNotFound, "leave type not found")
+			return
+		}
+
+		respondJSON(w, http.StatusOK, map[string]string{"message": "Leave type retired"})
+
+	default:
+		respondError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+	}
+}
+
+// DownloadSupportingDocument returns the supporting document attached to a
+// leave request.
+//
+// Query params:
+// - id: Leave request ID (required)
+func DownloadSupportingDocument(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodGet) {
+		return
+	}
+
+	var leaveReq models.LeaveRequest
+	err := database.DB.Where("id = ? AND supporting_document_key <> ''", r.URL.Query().Get("id")).First(&leaveReq).Error
+	if err != nil {
+		respondError(w, http.StatusNotFound, "no supporting document is attached to this request")
+		return
+	}
+
+	data, err := storage.Archive.Get(leaveReq.SupportingDocumentKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		log.Printf("[WARN] Supporting document of request %d is missing from storage", leaveReq.ID)
+		respondError(w, http.StatusNotFound, "the supporting document is no longer available; please ask the staff member to send it again")
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to read supporting document of request %d: %v", leaveReq.ID, err)
+		respondError(w, http.StatusInternalServerError, "failed to read supporting document")
+		return
+	}
+
+	ext := path.Ext(leaveReq.SupportingDocumentKey)
+	w.Header().Set("Content-Type", supportingDocumentContentTypes[ext])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=Supporting_Document_%s%s", leaveReq.Reference(), ext))
+	w.Write(data)
+}
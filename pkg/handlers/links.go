@@ -0,0 +1,517 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/database"
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"github.com/JpUnique/petrodata-leave-project/pkg/outbox"
+	"github.com/JpUnique/petrodata-leave-project/pkg/service"
+	"github.com/JpUnique/petrodata-leave-project/pkg/signedlink"
+	"github.com/JpUnique/petrodata-leave-project/pkg/utils"
+	"github.com/JpUnique/petrodata-leave-project/pkg/workflow"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// APPROVAL LINKS
+// ============================================================================
+
+// ReissueLinkRequest represents HR asking for a fresh link on a stalled request.
+type ReissueLinkRequest struct {
+	ID uint `json:"id"`
+}
+
+// LinkCodeRequest represents an approver asking for a one-time code to be
+// emailed to the address their link was issued to.
+type LinkCodeRequest struct {
+	Token string `json:"token"`
+}
+
+var (
+	errLinkExpired = errors.New(ErrLinkExpired)
+	errLinkUsed    = errors.New(ErrLinkUsed)
+	errLinkInvalid = errors.New(ErrTokenNotFound)
+)
+
+// Approver email confirmation
+const (
+	linkCodeTTL         = 10 * time.Minute
+	maxLinkCodeAttempts = 5
+)
+
+// newLink prepares a link for purpose addressed to email, with token as its
+// nonce. It is stored by issueLink; the emailed URL carries signedToken(link).
+// While email has an active delegation the link is addressed to the delegate.
+func newLink(requestID uint, purpose, email, token string) *models.ApprovalLink {
+	now := time.Now()
+	link := &models.ApprovalLink{
+		Token:          token,
+		LeaveRequestID: requestID,
+		Purpose:        purpose,
+		ApproverEmail:  utils.NormalizeEmail(email),
+		IssuedAt:       now,
+		ExpiresAt:      now.Add(utils.ApprovalLinkTTL()),
+	}
+	if delegate := activeDelegate(link.ApproverEmail); delegate != "" {
+		link.OnBehalfOf, link.ApproverEmail = link.ApproverEmail, delegate
+	}
+	return link
+}
+
+// signedToken returns the tamper-evident token emailed for link.
+func signedToken(link *models.ApprovalLink) string {
+	return signedlink.Sign(signedlink.Claims{
+		Nonce:     link.Token,
+		RequestID: link.LeaveRequestID,
+		Purpose:   link.Purpose,
+		Email:     link.ApproverEmail,
+		ExpiresAt: link.ExpiresAt,
+	})
+}
+
+// issueLink stores link. Earlier unused links of the request with the same
+// purpose are marked used, so only the latest one works.
+func issueLink(tx *gorm.DB, link *models.ApprovalLink) error {
+	err := tx.Model(&models.ApprovalLink{}).
+		Where("leave_request_id = ? AND purpose = ? AND used_at IS NULL", link.LeaveRequestID, link.Purpose).
+		Update("used_at", link.IssuedAt).Error
+	if err != nil {
+		return err
+	}
+	return tx.Create(link).Error
+}
+
+// findLink verifies a signed token issued for purpose and loads its link. The
+// signature must match and the stored link must be for the same request and
+// approver, unused and unexpired. A bare UUID is accepted only for a legacy
+// link emailed before links were signed.
+func findLink(db *gorm.DB, token, purpose string) (models.ApprovalLink, error) {
+	var link models.ApprovalLink
+	claims, err := signedlink.Verify(token)
+	switch {
+	case errors.Is(err, signedlink.ErrExpired):
+		return link, errLinkExpired
+	case errors.Is(err, signedlink.ErrMalformed) && uuid.Validate(token) == nil:
+		return findLegacyLink(db, token, purpose)
+	case err != nil:
+		log.Printf("[WARN] Rejected approval link: %v", err)
+		return link, errLinkInvalid
+	case claims.Purpose != purpose:
+		return link, errLinkInvalid
+	}
+
+	err = db.Where("token = ? AND purpose = ?", claims.Nonce, purpose).First(&link).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return link, errLinkInvalid
+	}
+	if err != nil {
+		return link, err
+	}
+	if link.LeaveRequestID != claims.RequestID || link.ApproverEmail != claims.Email {
+		log.Printf("[WARN] Approval link %d presented with claims for request %d / %s", link.ID, claims.RequestID, claims.Email)
+		return link, errLinkInvalid
+	}
+	return link, checkLinkOpen(link)
+}
+
+// findLegacyLink loads the unsigned legacy link with token for purpose. Such
+// links keep working until the expiry given to them when they were recorded.
+func findLegacyLink(db *gorm.DB, token, purpose string) (models.ApprovalLink, error) {
+	var link models.ApprovalLink
+	err := db.Where("token = ? AND purpose = ? AND legacy", token, purpose).First(&link).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return link, errLinkInvalid
+	}
+	if err != nil {
+		return link, err
+	}
+	return link, checkLinkOpen(link)
+}
+
+// linkPurpose returns the purpose a token was issued for, read from its
+// claims or, for a legacy token, from its stored link. It returns "" when
+// neither gives one; findLink then refuses the token.
+func linkPurpose(db *gorm.DB, token string) string {
+	if claims, err := signedlink.Verify(token); err == nil {
+		return claims.Purpose
+	}
+	var purposes []string
+	db.Model(&models.ApprovalLink{}).Where("token = ? AND legacy", token).Limit(1).Pluck("purpose", &purposes)
+	if len(purposes) == 0 {
+		return ""
+	}
+	return purposes[0]
+}
+
+// checkLinkOpen returns errLinkUsed or errLinkExpired if link can no longer be acted on.
+func checkLinkOpen(link models.ApprovalLink) error {
+	if link.UsedAt != nil {
+		return errLinkUsed
+	}
+	if time.Now().After(link.ExpiresAt) {
+		return errLinkExpired
+	}
+	return nil
+}
+
+// usedLinkColumns marks a link as used and clears its confirmation code, so
+// neither the link nor the code can be used again.
+func usedLinkColumns() map[string]interface{} {
+	return map[string]interface{}{
+		"used_at":         time.Now(),
+		"code_hash":       "",
+		"code_expires_at": nil,
+		"code_attempts":   0,
+	}
+}
+
+// consumeLink marks link as used and clears its confirmation code. It
+// returns errLinkUsed if another action used it first.
+func consumeLink(tx *gorm.DB, link models.ApprovalLink) error {
+	result := tx.Model(&models.ApprovalLink{}).
+		Where("id = ? AND used_at IS NULL", link.ID).
+		Updates(usedLinkColumns())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errLinkUsed
+	}
+	return nil
+}
+
+// revokeLinks marks every outstanding link of a request as used.
+func revokeLinks(tx *gorm.DB, requestID uint) error {
+	return tx.Model(&models.ApprovalLink{}).
+		Where("leave_request_id = ? AND used_at IS NULL", requestID).
+		Updates(usedLinkColumns()).Error
+}
+
+// respondLinkError writes 410 Gone for a used or expired link and 404 for an
+// unknown one.
+func respondLinkError(w http.ResponseWriter, token string, err error) {
+	switch {
+	case errors.Is(err, errLinkUsed), errors.Is(err, errLinkExpired):
+		log.Printf("[WARN] Refused approval link %s: %v", token, err)
+		respondError(w, http.StatusGone, err.Error())
+	case errors.Is(err, errLinkInvalid):
+		log.Printf("[ERROR] Invalid approval link token: %s", token)
+		respondError(w, http.StatusNotFound, ErrTokenNotFound)
+	default:
+		log.Printf("[ERROR] Failed to look up approval link %s: %v", token, err)
+		respondError(w, http.StatusInternalServerError, ErrRequestNotFound)
+	}
+}
+
+// requestByLink resolves a link token to its leave request. It writes 404 or
+// 410 and returns false if the link is unknown, used or expired.
+func requestByLink(w http.ResponseWriter, token, purpose string) (models.ApprovalLink, models.LeaveRequest, bool) {
+	var leaveReq models.LeaveRequest
+	link, err := findLink(database.DB, token, purpose)
+	if err != nil {
+		respondLinkError(w, token, err)
+		return link, leaveReq, false
+	}
+	if err := database.DB.First(&leaveReq, link.LeaveRequestID).Error; err != nil {
+		respondError(w, http.StatusNotFound, ErrRequestNotFound)
+		return link, leaveReq, false
+	}
+	return link, leaveReq, true
+}
+
+// actionSaveError reports a failed decision save as 410, 409 or 500 with message.
+func actionSaveError(err error, message string) error {
+	switch {
+	case errors.Is(err, errLinkUsed):
+		return refuseDecision(http.StatusGone, ErrLinkUsed)
+	case errors.Is(err, errConcurrentUpdate):
+		return refuseDecision(http.StatusConflict, ErrConcurrentUpdate)
+	}
+	return refuseDecision(http.StatusInternalServerError, message)
+}
+
+// ReissueApprovalLink sends a fresh link to whoever the request is waiting on,
+// replacing any earlier link for that step.
+//
+// Request body:
+// - id: Leave request ID (required)
+//
+// Works for requests awaiting the manager, HR, MD or a chain stage, for HR's
+// confirmation of a cancellation, HR's filing of a manager rejection, the
+// MD's review of an HR rejection and for the final archive link.
+func ReissueApprovalLink(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodPost) {
+		return
+	}
+
+	var req ReissueLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, ErrInvalidJSON)
+		return
+	}
+
+	var leaveReq models.LeaveRequest
+	if err := database.DB.First(&leaveReq, req.ID).Error; err != nil {
+		respondError(w, http.StatusNotFound, ErrRequestNotFound)
+		return
+	}
+
+	nonce := uuid.New().String()
+	var token string // Signed once the recipient is known
+	var (
+		purpose, column, email string
+		stage                  models.LeaveRequestStage
+		compose                func(to service.Recipient) service.Message
+	)
+
+	switch workflow.State(leaveReq.Status) {
+	case workflow.StatePending:
+		purpose, column, email = models.LinkManager, "request_token", leaveReq.ManagerEmail
+		compose = func(to service.Recipient) service.Message { return service.ManagerRequestEmail(to, leaveReq, token) }
+	case workflow.StatePendingHRReview:
+		purpose, column, email = models.LinkHR, "resource_token", leaveReq.HREmail
+		compose = func(to service.Recipient) service.Message { return service.HRRequestEmail(to, leaveReq, token) }
+	case workflow.StateCancellationRequested:
+		purpose, column, email = models.LinkCancellation, "resource_token", leaveReq.HREmail
+		compose = func(to service.Recipient) service.Message {
+			return service.CancellationRequestEmail(to, leaveReq, token)
+		}
+	case workflow.StatePendingMDApproval:
+		purpose, column, email = models.LinkMD, "director_token", leaveReq.MDEmail
+		compose = func(to service.Recipient) service.Message { return service.MDRequestEmail(to, leaveReq, token) }
+	case workflow.StateRejectedByManager, workflow.StateRejectedByHR:
+		rejectedBy := workflow.ActorLineManager
+		if workflow.State(leaveReq.Status) == workflow.StateRejectedByHR {
+			rejectedBy = workflow.ActorHR
+		}
+		reason, err := rejectionReason(database.DB, leaveReq.ID, string(rejectedBy))
+		if err != nil {
+			log.Printf("[ERROR] Failed to load rejection of request %d: %v", leaveReq.ID, err)
+			respondError(w, http.StatusInternalServerError, ErrSaveAction)
+			return
+		}
+		if rejectedBy == workflow.ActorHR {
+			purpose, column, email = models.LinkMD, "director_token", leaveReq.MDEmail
+			compose = func(to service.Recipient) service.Message {
+				return service.RejectionReviewEmail(to, leaveReq, reason, token)
+			}
+		} else {
+			purpose, column, email = models.LinkHR, "resource_token", leaveReq.HREmail
+			compose = func(to service.Recipient) service.Message {
+				return service.FilingRequestEmail(to, leaveReq, reason, token)
+			}
+		}
+	case workflow.StateFullyApproved:
+		purpose, column, email = models.LinkFinal, "final_token", leaveReq.HREmail
+		compose = func(to service.Recipient) service.Message { return service.FinalArchiveEmail(to, leaveReq, token) }
+	case workflow.StatePendingStage:
+		err := database.DB.Where("leave_request_id = ? AND position = ?", leaveReq.ID, leaveReq.CurrentStage).First(&stage).Error
+		if err != nil {
+			log.Printf("[ERROR] Current stage of request %d not found: %v", leaveReq.ID, err)
+			respondError(w, http.StatusInternalServerError, ErrSaveAction)
+			return
+		}
+		purpose, email = models.LinkStage, stage.ApproverEmail
+		compose = func(to service.Recipient) service.Message {
+			return service.StageRequestEmail(to, leaveReq, stage.Name, token)
+		}
+	default:
+		respondError(w, http.StatusConflict, fmt.Sprintf("no approval link is outstanding for a request that is %q", leaveReq.Status))
+		return
+	}
+
+	if email == "" {
+		respondError(w, http.StatusConflict, "no recipient is recorded for this step")
+		return
+	}
+
+	link := newLink(leaveReq.ID, purpose, email, nonce)
+	token = signedToken(link)
+
+	hrEmail, _ := r.Context().Value("userEmail").(string)
+	entry := auditEntry(r, leaveReq.ID, hrEmail, auditStage(purpose, stage), models.ActionLinkReissued, "")
+	entry.ForwardedTo = link.ApproverEmail
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if purpose == models.LinkStage {
+			if err := tx.Model(&stage).Update("token", nonce).Error; err != nil {
+				return err
+			}
+		} else {
+			result := tx.Model(&leaveReq).Where("status = ?", leaveReq.Status).Update(column, nonce)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errConcurrentUpdate
+			}
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+		if err := issueLink(tx, link); err != nil {
+			return err
+		}
+		return outbox.Enqueue(tx, leaveReq.ID, compose(linkRecipient(link)))
+	})
+	if err != nil {
+		log.Printf("[ERROR] Failed to re-issue %s link for request %d: %v", purpose, leaveReq.ID, err)
+		respondSaveError(w, err, ErrSaveAction)
+		return
+	}
+
+	log.Printf("[INFO] %s re-issued the %s link for request %d to %s", hrEmail, purpose, leaveReq.ID, link.ApproverEmail)
+	outbox.Wake()
+
+	respondJSON(w, http.StatusOK, map[string]string{
+		"message":   "A new link has been sent to " + link.ApproverEmail + ".",
+		"reference": leaveReq.Reference(),
+		"status":    leaveReq.Status,
+	})
+}
+
+// saveDecision saves a decision made through link in one transaction: the
+// link is consumed, the transition saved, entry added to the audit trail,
+// next (when set) stored as the link for the following step and notify queued
+// in the outbox.
+func saveDecision(db *gorm.DB, leaveReq *models.LeaveRequest, from workflow.State, link models.ApprovalLink, next *models.ApprovalLink, entry models.ApprovalAction, notify ...service.Message) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := consumeLink(tx, link); err != nil {
+			return err
+		}
+		if err := saveTransition(tx, leaveReq, from); err != nil {
+			return err
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+		if next != nil {
+			if err := issueLink(tx, next); err != nil {
+				return err
+			}
+		}
+		return outbox.Enqueue(tx, leaveReq.ID, notify...)
+	})
+	if err == nil {
+		outbox.Wake()
+	}
+	return err
+}
+
+// checkLinkCode enforces the one-time email confirmation when it is enabled.
+// It writes a 403 response and returns false if code is missing or wrong.
+func checkLinkCode(w http.ResponseWriter, link models.ApprovalLink, code string) bool {
+	if !utils.ApproverCodeRequired() {
+		return true
+	}
+	if err := verifyLinkCode(link, code); err != nil {
+		status, message := decisionErrorStatus(err)
+		respondError(w, status, message)
+		return false
+	}
+	return true
+}
+
+// verifyLinkCode checks code against the confirmation code last sent for
+// link, refusing with a 403 if none is pending or it does not match. Wrong
+// codes count towards maxLinkCodeAttempts.
+func verifyLinkCode(link models.ApprovalLink, code string) error {
+	if link.CodeHash == "" || link.CodeExpiresAt == nil || time.Now().After(*link.CodeExpiresAt) {
+		return refuseDecision(http.StatusForbidden, ErrLinkCodeRequired)
+	}
+	if link.CodeAttempts >= maxLinkCodeAttempts {
+		return refuseDecision(http.StatusForbidden, ErrLinkCodeAttempts)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(link.CodeHash), []byte(strings.TrimSpace(code))) != nil {
+		database.DB.Model(&link).Update("code_attempts", gorm.Expr("code_attempts + 1"))
+		log.Printf("[WARN] Wrong confirmation code for approval link %d", link.ID)
+		return refuseDecision(http.StatusForbidden, ErrLinkCodeWrong)
+	}
+	return nil
+}
+
+// newLinkCode returns a random six-digit confirmation code and its bcrypt hash.
+func newLinkCode() (code, hash string, err error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", "", err
+	}
+	code = fmt.Sprintf("%06d", n.Int64())
+	hashed, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		return "", "", err
+	}
+	return code, string(hashed), nil
+}
+
+// saveLinkCode makes hash the pending confirmation code of link for
+// linkCodeTTL, resetting its attempt count.
+func saveLinkCode(tx *gorm.DB, link models.ApprovalLink, hash string) error {
+	return tx.Model(&link).Updates(map[string]interface{}{
+		"code_hash":       hash,
+		"code_expires_at": time.Now().Add(linkCodeTTL),
+		"code_attempts":   0,
+	}).Error
+}
+
+// RequestLinkCode emails a one-time confirmation code to the approver a link
+// was issued to. The code must accompany the decision when
+// REQUIRE_APPROVER_CODE is enabled, so a forwarded email cannot be acted on.
+//
+// Request body:
+// - token: The signed link token (required)
+func RequestLinkCode(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodPost) {
+		return
+	}
+
+	var req LinkCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, ErrInvalidJSON)
+		return
+	}
+	if !validateToken(w, req.Token) {
+		return
+	}
+
+	link, err := findLink(database.DB, req.Token, linkPurpose(database.DB, req.Token))
+	if err != nil {
+		respondLinkError(w, req.Token, err)
+		return
+	}
+
+	code, hash, err := newLinkCode()
+	if err != nil {
+		log.Printf("[ERROR] Failed to generate confirmation code: %v", err)
+		respondError(w, http.StatusInternalServerError, ErrSaveAction)
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := saveLinkCode(tx, link, hash); err != nil {
+			return err
+		}
+		return outbox.Enqueue(tx, link.LeaveRequestID, service.ApprovalCodeEmail(link.ApproverEmail, code))
+	})
+	if err != nil {
+		log.Printf("[ERROR] Failed to save confirmation code for link %d: %v", link.ID, err)
+		respondError(w, http.StatusInternalServerError, ErrSaveAction)
+		return
+	}
+	outbox.Wake()
+
+	respondJSON(w, http.StatusOK, map[string]string{
+		"message": "A confirmation code has been sent to " + link.ApproverEmail + ".",
+	})
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/database"
+	"github.com/JpUnique/petrodata-leave-project/pkg/ledger"
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"github.com/JpUnique/petrodata-leave-project/pkg/utils"
+	"github.com/JpUnique/petrodata-leave-project/pkg/workflow"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// STAFF DASHBOARD ("MY REQUESTS")
+// ============================================================================
+
+// stageDecision is one approval step of a request as shown to the staff member.
+type stageDecision struct {
+	Name      string     `json:"name"`
+	Approver  string     `json:"approver,omitempty"`
+	Decision  string     `json:"decision"` // "" while awaiting action
+	Reason    string     `json:"reason,omitempty"`
+	DecidedAt *time.Time `json:"decided_at,omitempty"`
+}
+
+// myLeaveRequest is a leave request as returned to the staff member who made it.
+// Approval tokens are never included.
+type myLeaveRequest struct {
+	models.LeaveRequest
+	Reference        string          `json:"reference"`
+	Stages           []stageDecision `json:"stages"`
+	RemainingBalance *int            `json:"remaining_balance"` // For the request's leave type and balance year
+	PDFURL           string          `json:"pdf_url,omitempty"` // Only once Fully Approved
+}
+
+// builtInStages describes the Manager -> HR -> MD flow of a request not on a chain.
+func builtInStages(l models.LeaveRequest) []stageDecision {
+	return []stageDecision{
+		{Name: string(workflow.ActorLineManager), Approver: l.ManagerEmail, Decision: l.ManagerDecision},
+		{Name: string(workflow.ActorHR), Approver: l.HREmail, Decision: l.HRDecision},
+		{Name: string(workflow.ActorMD), Approver: l.MDEmail, Decision: l.MDDecision},
+	}
+}
+
+// requestStageDecisions returns the approval steps of l.
+func requestStageDecisions(db *gorm.DB, l models.LeaveRequest) ([]stageDecision, error) {
+	if l.ChainID == nil {
+		return builtInStages(l), nil
+	}
+	stages, err := loadRequestStages(db, l.ID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]stageDecision, 0, len(stages))
+	for _, s := range stages {
+		out = append(out, stageDecision{
+			Name:      s.Name,
+			Approver:  s.ApproverEmail,
+			Decision:  s.Decision,
+			Reason:    s.Reason,
+			DecidedAt: s.DecidedAt,
+		})
+	}
+	return out, nil
+}
+
+// withoutTokens clears the approval link tokens so they are not leaked to staff.
+func withoutTokens(l models.LeaveRequest) models.LeaveRequest {
+	l.RequestToken, l.HRToken, l.MDToken, l.FinalHRToken = nil, nil, nil, nil
+	return l
+}
+
+// GetMyLeaveRequests returns the authenticated staff member's leave requests, newest first.
+//
+// Query params:
+// - status: Exact status, e.g. "Fully Approved" (optional)
+// - year: Balance year (optional)
+// - leave_type: Leave type (optional)
+//
+// Returns: Requests with their stage decisions, remaining balance and PDF link
+func GetMyLeaveRequests(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodGet) {
+		return
+	}
+
+	userEmail, ok := r.Context().Value("userEmail").(string)
+	if !ok || userEmail == "" {
+		respondError(w, http.StatusUnauthorized, "Unauthorized: email not found in session")
+		return
+	}
+	userEmail = utils.NormalizeEmail(userEmail)
+
+	q := database.DB.Where("staff_email = ?", userEmail)
+	if status := strings.TrimSpace(r.URL.Query().Get("status")); status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if v := r.URL.Query().Get("year"); v != "" {
+		year, err := strconv.Atoi(v)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "year must be a number")
+			return
+		}
+		q = q.Where("balance_year = ?", year)
+	}
+	if leaveType := strings.TrimSpace(r.URL.Query().Get("leave_type")); leaveType != "" {
+		q = q.Where("leave_type ILIKE ?", leaveType)
+	}
+
+	var requests []models.LeaveRequest
+	if err := q.Order("created_at DESC").Find(&requests).Error; err != nil {
+		log.Printf("[ERROR] Failed to list leave requests for %s: %v", userEmail, err)
+		respondError(w, http.StatusInternalServerError, "failed to load leave requests")
+		return
+	}
+
+	balances := make(map[ledger.Key]*int)
+	resp := make([]myLeaveRequest, 0, len(requests))
+	for _, l := range requests {
+		stages, err := requestStageDecisions(database.DB, l)
+		if err != nil {
+			log.Printf("[ERROR] Failed to load stages for request %d: %v", l.ID, err)
+			respondError(w, http.StatusInternalServerError, "failed to load leave requests")
+			return
+		}
+
+		key := balanceKey(&l)
+		remaining, seen := balances[key]
+		if !seen {
+			if bal, err := ledger.Get(database.DB, key); err != nil {
+				log.Printf("[WARN] No balance for %s %d %s: %v", key.StaffEmail, key.Year, key.LeaveType, err)
+			} else {
+				n := bal.Remaining()
+				remaining = &n
+			}
+			balances[key] = remaining
+		}
+
+		item := myLeaveRequest{
+			LeaveRequest:     withoutTokens(l),
+			Reference:        l.Reference(),
+			Stages:           stages,
+			RemainingBalance: remaining,
+		}
+		if workflow.State(l.Status) == workflow.StateFullyApproved {
+			item.PDFURL = fmt.Sprintf("/api/leave/my-requests/pdf?id=%d", l.ID)
+		}
+		resp = append(resp, item)
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// DownloadMyLeavePDF returns the final leave record of one of the
+// authenticated staff member's Fully Approved requests.
+//
+// Query params:
+// - id: Leave request ID (required)
+func DownloadMyLeavePDF(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodGet) {
+		return
+	}
+
+	userEmail, ok := r.Context().Value("userEmail").(string)
+	if !ok || userEmail == "" {
+		respondError(w, http.StatusUnauthorized, "Unauthorized: email not found in session")
+		return
+	}
+	userEmail = utils.NormalizeEmail(userEmail)
+
+	var leave models.LeaveRequest
+	err := database.DB.Where("id = ? AND staff_email = ? AND status = ?", r.URL.Query().Get("id"), userEmail, string(workflow.StateFullyApproved)).
+		First(&leave).Error
+	if err != nil {
+		respondError(w, http.StatusNotFound, ErrRequestNotFound)
+		return
+	}
+
+	pdfBytes, _, err := leaveRecord(database.DB, leave)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load leave record for request %d: %v", leave.ID, err)
+		respondError(w, http.StatusInternalServerError, "failed to generate PDF")
+		return
+	}
+
+	writePDF(w, "Leave_Record_"+leave.Reference()+".pdf", pdfBytes)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/database"
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"github.com/JpUnique/petrodata-leave-project/pkg/outbox"
+)
+
+// ============================================================================
+// NOTIFICATION OUTBOX (HR)
+// ============================================================================
+
+// ResendOutboxRequest represents HR asking for a failed notification to be
+// delivered again.
+type ResendOutboxRequest struct {
+	ID uint `json:"id"`
+}
+
+// outboxEntry is one notification of the outbox listing.
+type outboxEntry struct {
+	models.OutboxEmail
+	Reference string `json:"reference,omitempty"`
+}
+
+// ListOutbox lists queued notifications, newest first.
+//
+// Query params:
+// - status: "pending", "sent" or "failed" (optional, defaults to "failed")
+func ListOutbox(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodGet) {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = models.OutboxFailed
+	case models.OutboxPending, models.OutboxSent, models.OutboxFailed:
+	default:
+		respondError(w, http.StatusBadRequest, "status must be pending, sent or failed")
+		return
+	}
+
+	var emails []models.OutboxEmail
+	err := database.DB.Where("status = ?", status).Order("created_at DESC").Limit(200).Find(&emails).Error
+	if err != nil {
+		log.Printf("[ERROR] Failed to list outbox: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to list notifications")
+		return
+	}
+
+	resp := make([]outboxEntry, 0, len(emails))
+	for _, email := range emails {
+		entry := outboxEntry{OutboxEmail: email}
+		if email.LeaveRequestID != nil {
+			entry.Reference = models.LeaveRequest{ID: *email.LeaveRequestID}.Reference()
+		}
+		resp = append(resp, entry)
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// ResendOutboxEmail queues a failed notification for delivery again.
+//
+// Request body:
+// - id: Outbox email ID (required)
+func ResendOutboxEmail(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodPost) {
+		return
+	}
+
+	var req ResendOutboxRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, ErrInvalidJSON)
+		return
+	}
+
+	err := outbox.Resend(database.DB, req.ID)
+	if errors.Is(err, outbox.ErrNotFailed) {
+		respondError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to re-send notification %d: %v", req.ID, err)
+		respondError(w, http.StatusInternalServerError, ErrSaveAction)
+		return
+	}
+
+	hrEmail, _ := r.Context().Value("userEmail").(string)
+	log.Printf("[INFO] %s re-queued notification %d", hrEmail, req.ID)
+	respondJSON(w, http.StatusOK, map[string]string{
+		"message": "The notification has been queued for delivery.",
+	})
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"github.com/JpUnique/petrodata-leave-project/pkg/utils"
+	"github.com/JpUnique/petrodata-leave-project/pkg/workflow"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// OVERLAPPING LEAVE DETECTION
+// ============================================================================
+
+// leaveSummary is a short description of another leave request.
+type leaveSummary struct {
+	ID             uint        `json:"id"`
+	Reference      string      `json:"reference"`
+	StaffName      string      `json:"staff_name"`
+	Status         string      `json:"status"`
+	StartDate      models.Date `json:"start_date"`
+	ResumptionDate models.Date `json:"resumption_date"`
+}
+
+func summarizeLeave(l models.LeaveRequest) leaveSummary {
+	return leaveSummary{
+		ID:             l.ID,
+		Reference:      l.Reference(),
+		StaffName:      l.StaffName,
+		Status:         l.Status,
+		StartDate:      l.StartDate,
+		ResumptionDate: l.ResumptionDate,
+	}
+}
+
+// leaveDetailsResponse is the leave request as returned to approvers, flagged
+// with anything the approver should know before deciding.
+type leaveDetailsResponse struct {
+	models.LeaveRequest
+	Reference    string          `json:"reference"`
+	Overlaps     []leaveSummary  `json:"overlaps"`
+	Coverage     coverageSummary `json:"coverage"`
+	CodeRequired bool            `json:"code_required"` // Decisions need a code emailed to the approver
+
+	// A supporting document is attached (HR downloads it from /api/admin/leave/supporting-document)
+	SupportingDocument bool `json:"supporting_document"`
+}
+
+// activeLeavesBetween returns the requests that still hold dates (not rejected
+// or cancelled) and overlap [start, resumption). Leave is taken up to, but not
+// including, the resumption date.
+func activeLeavesBetween(db *gorm.DB, start, resumption models.Date) *gorm.DB {
+	inactive := make([]string, 0)
+	for _, s := range workflow.InactiveStates() {
+		inactive = append(inactive, string(s))
+	}
+	return db.Model(&models.LeaveRequest{}).
+		Where("status NOT IN ?", inactive).
+		Where("start_date < ? AND resumption_date > ?", resumption, start)
+}
+
+// findOverlaps returns the staff member's active requests overlapping the
+// given range, excluding excludeID.
+func findOverlaps(db *gorm.DB, staffEmail string, start, resumption models.Date, excludeID uint) ([]models.LeaveRequest, error) {
+	var overlaps []models.LeaveRequest
+	err := activeLeavesBetween(db, start, resumption).
+		Where("staff_email = ? AND id <> ?", staffEmail, excludeID).
+		Order("start_date ASC").
+		Find(&overlaps).Error
+	return overlaps, err
+}
+
+// overlapMessage describes the conflicting requests for the submission error.
+func overlapMessage(overlaps []models.LeaveRequest) string {
+	parts := make([]string, 0, len(overlaps))
+	for _, o := range overlaps {
+		parts = append(parts, fmt.Sprintf("%s (%s to %s, %s)", o.Reference(), o.StartDate, o.ResumptionDate, o.Status))
+	}
+	return "These dates overlap your existing leave request " + strings.Join(parts, "; ") + "."
+}
+
+// buildLeaveDetails wraps leaveReq with its overlap flags and department
+// coverage for an approver detail endpoint.
+func buildLeaveDetails(db *gorm.DB, leaveReq models.LeaveRequest) leaveDetailsResponse {
+	resp := leaveDetailsResponse{
+		LeaveRequest: leaveReq,
+		Reference:    leaveReq.Reference(),
+		Overlaps:     []leaveSummary{},
+		CodeRequired: utils.ApproverCodeRequired(),
+
+		SupportingDocument: leaveReq.SupportingDocumentKey != "",
+	}
+
+	overlaps, err := findOverlaps(db, leaveReq.StaffEmail, leaveReq.StartDate, leaveReq.ResumptionDate, leaveReq.ID)
+	if err != nil {
+		log.Printf("[ERROR] Overlap check failed for request %d: %v", leaveReq.ID, err)
+	}
+	for _, o := range overlaps {
+		resp.Overlaps = append(resp.Overlaps, summarizeLeave(o))
+	}
+
+	if resp.Coverage, err = buildCoverage(db, leaveReq); err != nil {
+		log.Printf("[ERROR] Coverage check failed for request %d: %v", leaveReq.ID, err)
+	}
+	return resp
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/database"
+	"github.com/JpUnique/petrodata-leave-project/pkg/ledger"
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"github.com/JpUnique/petrodata-leave-project/pkg/service"
+	"github.com/JpUnique/petrodata-leave-project/pkg/workflow"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// REJECTION FILING AND MD REVIEW
+// ============================================================================
+
+// FilingActionRequest represents HR filing a request the line manager rejected.
+type FilingActionRequest struct {
+	Token  string `json:"token"`
+	Reason string `json:"reason,omitempty"` // Filing note (optional)
+	Code   string `json:"code,omitempty"`   // Required when approvers must confirm their email
+}
+
+// MDReviewRequest represents the MD's review of a request HR rejected.
+type MDReviewRequest struct {
+	Token     string `json:"token"`
+	Status    string `json:"status"` // "Overturned" approves the leave, "Upheld" keeps the rejection
+	Reason    string `json:"reason,omitempty"`
+	Code      string `json:"code,omitempty"`      // Required when approvers must confirm their email
+	Signature string `json:"signature,omitempty"` // PNG data URL, required if overturned
+}
+
+// rejectionDetailsResponse is a rejected request as shown to whoever files or
+// reviews the rejection.
+type rejectionDetailsResponse struct {
+	leaveDetailsResponse
+	RejectedBy      string `json:"rejected_by"`
+	RejectionReason string `json:"rejection_reason"`
+}
+
+// rejectionReason returns the reason given with the latest rejection of a
+// request at stage.
+func rejectionReason(db *gorm.DB, requestID uint, stage string) (string, error) {
+	var entry models.ApprovalAction
+	err := db.Where("request_id = ? AND stage = ? AND decision = ?", requestID, stage, string(workflow.DecisionRejected)).
+		Order("action_date DESC, id DESC").Limit(1).Find(&entry).Error
+	return entry.Reason, err
+}
+
+// respondRejectionDetails writes the details of the request a link of purpose
+// opens, if it is in state, with the reason it was rejected at stage.
+func respondRejectionDetails(w http.ResponseWriter, r *http.Request, purpose string, state workflow.State, stage string) {
+	if !validateHTTPMethod(w, r.Method, http.MethodGet) {
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	if !validateToken(w, token) {
+		return
+	}
+
+	_, leaveReq, ok := requestByLink(w, token, purpose)
+	if !ok {
+		return
+	}
+	if workflow.State(leaveReq.Status) != state {
+		log.Printf("[ERROR] Link for request %d does not open a %s", leaveReq.ID, state)
+		respondError(w, http.StatusNotFound, ErrTokenNotFound)
+		return
+	}
+
+	reason, err := rejectionReason(database.DB, leaveReq.ID, stage)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load rejection of request %d: %v", leaveReq.ID, err)
+	}
+
+	respondJSON(w, http.StatusOK, rejectionDetailsResponse{
+		leaveDetailsResponse: buildLeaveDetails(database.DB, leaveReq),
+		RejectedBy:           stage,
+		RejectionReason:      reason,
+	})
+}
+
+// GetFilingDetails retrieves a request the line manager rejected for HR to file.
+//
+// Query params:
+// - token: The HR token issued with the rejection (required)
+func GetFilingDetails(w http.ResponseWriter, r *http.Request) {
+	respondRejectionDetails(w, r, models.LinkHR, workflow.StateRejectedByManager, string(workflow.ActorLineManager))
+}
+
+// HandleFilingAction records HR filing a request the line manager rejected.
+// The rejection itself stands; filing closes the case.
+//
+// Request body:
+// - token: HR filing token (required)
+// - reason: Filing note (optional)
+func HandleFilingAction(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodPost) {
+		return
+	}
+
+	var req FilingActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, ErrInvalidJSON)
+		return
+	}
+
+	link, leaveReq, ok := requestByLink(w, req.Token, models.LinkHR)
+	if !ok || !checkLinkCode(w, link, req.Code) {
+		return
+	}
+
+	outcome, err := decideFiling(r, link, leaveReq, req)
+	respondDecision(w, outcome, err)
+}
+
+// decideFiling records HR filing leaveReq through link. It is shared by the
+// filing link and the approver inbox.
+func decideFiling(r *http.Request, link models.ApprovalLink, leaveReq models.LeaveRequest, req FilingActionRequest) (decisionOutcome, error) {
+	from := workflow.State(leaveReq.Status)
+	next, err := workflow.Transition(from, workflow.ActorHR, workflow.DecisionFiled)
+	if err != nil {
+		return decisionOutcome{}, transitionRefused(leaveReq.ID, err)
+	}
+
+	leaveReq.Status = string(next)
+	leaveReq.HRToken = nil
+	entry := linkAuditEntry(r, link, auditStageFiling, string(workflow.DecisionFiled), req.Reason)
+
+	if err := saveDecision(database.DB, &leaveReq, from, link, nil, entry); err != nil {
+		log.Printf("[ERROR] Failed to file rejected request %d: %v", leaveReq.ID, err)
+		return decisionOutcome{}, actionSaveError(err, ErrSaveAction)
+	}
+
+	log.Printf("[INFO] HR filed rejected request %d", leaveReq.ID)
+
+	return decisionOutcome{Message: "Rejected request filed.", Status: leaveReq.Status}, nil
+}
+
+// GetMDReviewDetails retrieves a request HR rejected for the MD to review.
+//
+// Query params:
+// - token: The MD token issued with the rejection (required)
+func GetMDReviewDetails(w http.ResponseWriter, r *http.Request) {
+	respondRejectionDetails(w, r, models.LinkMD, workflow.StateRejectedByHR, string(workflow.ActorHR))
+}
+
+// HandleMDReviewAction records the MD upholding or overturning an HR rejection.
+//
+// Request body:
+// - token: MD review token (required)
+// - status: "Overturned" or "Upheld" (required)
+// - reason: Explanation (optional; an upheld rejection keeps HR's reason if empty)
+// - signature: MD signature as a PNG data URL (required if status is "Overturned")
+//
+// Overturning approves the leave as the MD's final approval would: the days
+// are charged to the staff balance again (400 if it no longer covers them)
+// and HR receives the archive link. Upholding tells the staff the rejection
+// is final.
+func HandleMDReviewAction(w http.ResponseWriter, r *http.Request) {
+	if !validateHTTPMethod(w, r.Method, http.MethodPost) {
+		return
+	}
+
+	var req MDReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, ErrInvalidJSON)
+		return
+	}
+
+	link, leaveReq, ok := requestByLink(w, req.Token, models.LinkMD)
+	if !ok || !checkLinkCode(w, link, req.Code) {
+		return
+	}
+
+	outcome, err := decideMDReview(r, link, leaveReq, req)
+	respondDecision(w, outcome, err)
+}
+
+// decideMDReview records the MD's review of HR's rejection of leaveReq, made
+// through link. It is shared by the review link and the approver inbox.
+func decideMDReview(r *http.Request, link models.ApprovalLink, leaveReq models.LeaveRequest, req MDReviewRequest) (decisionOutcome, error) {
+	decision := workflow.Decision(req.Status)
+	if decision != workflow.DecisionOverturned && decision != workflow.DecisionUpheld {
+		return decisionOutcome{}, refuseDecision(http.StatusBadRequest, `status must be "Overturned" or "Upheld"`)
+	}
+	overturned := decision == workflow.DecisionOverturned
+	if err := checkSignature(req.Signature, overturned); err != nil {
+		return decisionOutcome{}, err
+	}
+
+	from := workflow.State(leaveReq.Status)
+	next, err := workflow.Transition(from, workflow.ActorMD, decision)
+	if err != nil {
+		return decisionOutcome{}, transitionRefused(leaveReq.ID, err)
+	}
+
+	// The rejection freed the dates, so another request may hold them by now
+	if overturned {
+		overlaps, err := findOverlaps(database.DB, leaveReq.StaffEmail, leaveReq.StartDate, leaveReq.ResumptionDate, leaveReq.ID)
+		if err != nil {
+			log.Printf("[ERROR] Overlap check failed for request %d: %v", leaveReq.ID, err)
+			return decisionOutcome{}, refuseDecision(http.StatusInternalServerError, ErrSaveAction)
+		}
+		if len(overlaps) > 0 {
+			return decisionOutcome{}, refuseDecision(http.StatusConflict, overlapMessage(overlaps))
+		}
+	}
+
+	leaveReq.Status = string(next)
+	leaveReq.MDDecision = string(decision)
+	leaveReq.MDApproved = overturned
+	leaveReq.MDToken = nil
+
+	entry := linkAuditEntry(r, link, auditStageMDReview, string(decision), req.Reason)
+	entry.Signature = req.Signature
+
+	if overturned {
+		finalToken := uuid.New().String()
+		leaveReq.FinalHRToken = &finalToken
+		leaveReq.RecordPending = true
+		finalLink := newLink(leaveReq.ID, models.LinkFinal, leaveReq.HREmail, finalToken)
+		entry.ForwardedTo = leaveReq.HREmail
+
+		notify := service.FinalArchiveEmail(linkRecipient(finalLink), leaveReq, signedToken(finalLink))
+		err := saveDecision(database.DB, &leaveReq, from, link, finalLink, entry, notify)
+		var balanceErr *ledger.InsufficientBalanceError
+		if errors.As(err, &balanceErr) {
+			return decisionOutcome{}, refuseDecision(http.StatusBadRequest, balanceErr.Error())
+		}
+		if err != nil {
+			log.Printf("[ERROR] Failed to overturn rejection of request %d: %v", leaveReq.ID, err)
+			return decisionOutcome{}, actionSaveError(err, ErrFinalizeRequest)
+		}
+
+		// Archive and email the final record
+		wakeRecordWorker()
+
+		log.Printf("[INFO] MD overturned HR rejection of request for %s, workflow complete", leaveReq.StaffName)
+
+		return decisionOutcome{
+			Message: "HR rejection overturned. Leave request fully approved and HR has been notified.",
+			Status:  leaveReq.Status,
+		}, nil
+	}
+
+	reason := req.Reason
+	if reason == "" {
+		if reason, err = rejectionReason(database.DB, leaveReq.ID, string(workflow.ActorHR)); err != nil {
+			log.Printf("[ERROR] Failed to load rejection of request %d: %v", leaveReq.ID, err)
+			return decisionOutcome{}, refuseDecision(http.StatusInternalServerError, ErrSaveAction)
+		}
+	}
+
+	notify := service.RejectionEmail(leaveReq, "Managing Director", reason)
+	if err := saveDecision(database.DB, &leaveReq, from, link, nil, entry, notify); err != nil {
+		log.Printf("[ERROR] Failed to uphold rejection of request %d: %v", leaveReq.ID, err)
+		return decisionOutcome{}, actionSaveError(err, ErrSaveAction)
+	}
+
+	log.Printf("[INFO] MD upheld HR rejection of request for %s, staff notified", leaveReq.StaffName)
+
+	return decisionOutcome{
+		Message: "HR rejection upheld. Staff has been notified.",
+		Status:  leaveReq.Status,
+	}, nil
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"github.com/JpUnique/petrodata-leave-project/pkg/outbox"
+	"github.com/JpUnique/petrodata-leave-project/pkg/service"
+	"github.com/JpUnique/petrodata-leave-project/pkg/utils"
+	"github.com/JpUnique/petrodata-leave-project/pkg/workflow"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ============================================================================
+// APPROVAL REMINDERS AND ESCALATION
+// ============================================================================
+
+// reminderInterval is how often the scheduler looks for stalled approvals.
+const reminderInterval = 15 * time.Minute
+
+// approvalStep is a step of the built-in workflow: the status a request waits
+// in, the purpose of its link and the columns recording the link and approver.
+type approvalStep struct {
+	state       workflow.State
+	purpose     string // Link purpose
+	tokenColumn string // Column on leave_requests holding the link nonce
+	emailColumn string // Column on leave_requests holding the approver
+}
+
+var approvalSteps = []approvalStep{
+	{workflow.StatePending, models.LinkManager, "request_token", "manager_email"},
+	{workflow.StatePendingHRReview, models.LinkHR, "resource_token", "hr_email"},
+	{workflow.StatePendingMDApproval, models.LinkMD, "director_token", "md_email"},
+}
+
+// StartReminders runs the reminder scheduler until ctx is cancelled. A request
+// left with its approver for longer than REMINDER_AFTER_HOURS gets a reminder,
+// repeated each period, and after ESCALATE_AFTER_HOURS it is passed to the
+// fallback approver of its step (ESCALATION_MANAGER_EMAIL, ESCALATION_HR_EMAIL
+// or ESCALATION_MD_EMAIL). Each reminder and escalation is audited.
+func StartReminders(ctx context.Context, db *gorm.DB) {
+	go func() {
+		ticker := time.NewTicker(reminderInterval)
+		defer ticker.Stop()
+		for {
+			followUpStalledApprovals(db)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// followUpStalledApprovals reminds or escalates every approval that has
+// waited longer than the reminder period.
+func followUpStalledApprovals(db *gorm.DB) {
+	cutoff := time.Now().Add(-utils.ReminderAfter())
+	for _, step := range approvalSteps {
+		var ids []uint
+		err := db.Model(&models.ApprovalLink{}).
+			Joins("JOIN leave_requests ON leave_requests.id = approval_links.leave_request_id").
+			Where("approval_links.purpose = ? AND approval_links.used_at IS NULL AND approval_links.issued_at <= ?", step.purpose, cutoff).
+			Where("leave_requests.status = ?", string(step.state)).
+			Pluck("approval_links.id", &ids).Error
+		if err != nil {
+			log.Printf("[ERROR] Failed to find stalled %s approvals: %v", step.purpose, err)
+			continue
+		}
+		for _, id := range ids {
+			if err := followUp(db, step, id); err != nil {
+				log.Printf("[ERROR] Failed to follow up approval link %d: %v", id, err)
+			}
+		}
+	}
+}
+
+// followUp sends a reminder for the link with id, or escalates its request,
+// if one is due. The link is locked so concurrent schedulers act on it once.
+func followUp(db *gorm.DB, step approvalStep, id uint) error {
+	queued := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var link models.ApprovalLink
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND used_at IS NULL", id).First(&link).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil // Acted on since it was found
+		}
+		if err != nil {
+			return err
+		}
+
+		var leaveReq models.LeaveRequest
+		if err := tx.First(&leaveReq, link.LeaveRequestID).Error; err != nil {
+			return err
+		}
+		if leaveReq.Status != string(step.state) {
+			return nil
+		}
+
+		waiting := time.Since(link.IssuedAt)
+		fallback := utils.EscalationEmail(step.purpose)
+		if waiting >= utils.EscalateAfter() && fallback != "" && fallback != link.Principal() && fallback != link.ApproverEmail {
+			queued = true
+			return escalateApproval(tx, &leaveReq, step, link, fallback, waiting)
+		}
+
+		var reminders int64
+		err = tx.Model(&models.ApprovalAction{}).
+			Where("request_id = ? AND decision = ? AND action_date >= ?", leaveReq.ID, models.ActionReminderSent, link.IssuedAt).
+			Count(&reminders).Error
+		if err != nil {
+			return err
+		}
+		if waiting < time.Duration(reminders+1)*utils.ReminderAfter() {
+			return nil // Reminded within the current period
+		}
+		queued = true
+		return remindApprover(tx, &leaveReq, step, link, waiting)
+	})
+	if err == nil && queued {
+		outbox.Wake()
+	}
+	return err
+}
+
+// remindApprover queues a reminder to the approver holding link. An expired
+// link is replaced first so the reminder carries one that works.
+func remindApprover(tx *gorm.DB, leaveReq *models.LeaveRequest, step approvalStep, link models.ApprovalLink, waiting time.Duration) error {
+	current := &link
+	if time.Now().After(link.ExpiresAt) {
+		var err error
+		if current, err = replaceStepLink(tx, leaveReq, step, link.Principal()); err != nil {
+			return err
+		}
+	}
+
+	entry := systemEntry(leaveReq.ID, auditStage(step.purpose, models.LeaveRequestStage{}), models.ActionReminderSent,
+		fmt.Sprintf("Waiting %d day(s) for a decision", int(waiting.Hours()/24)))
+	entry.ForwardedTo = link.ApproverEmail
+	if err := tx.Create(&entry).Error; err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] Reminding %s of request %d, waiting since %s", link.ApproverEmail, leaveReq.ID, link.IssuedAt.Format(time.RFC3339))
+	notify := service.ReminderEmail(linkRecipient(current), *leaveReq, step.purpose, signedToken(current), waiting)
+	return outbox.Enqueue(tx, leaveReq.ID, notify)
+}
+
+// escalateApproval passes the step link belongs to over to fallback with a
+// new link. The stalled approver's link stops working.
+func escalateApproval(tx *gorm.DB, leaveReq *models.LeaveRequest, step approvalStep, link models.ApprovalLink, fallback string, waiting time.Duration) error {
+	next, err := replaceStepLink(tx, leaveReq, step, fallback)
+	if err != nil {
+		return err
+	}
+
+	entry := systemEntry(leaveReq.ID, auditStage(step.purpose, models.LeaveRequestStage{}), models.ActionEscalated,
+		fmt.Sprintf("No decision from %s after %d day(s)", link.ApproverEmail, int(waiting.Hours()/24)))
+	entry.ForwardedTo = fallback
+	if err := tx.Create(&entry).Error; err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] Escalating request %d from %s to %s", leaveReq.ID, link.ApproverEmail, fallback)
+	notify := service.EscalationEmail(linkRecipient(next), *leaveReq, step.purpose, signedToken(next), link.ApproverEmail, waiting)
+	return outbox.Enqueue(tx, leaveReq.ID, notify)
+}
+
+// replaceStepLink issues a new link for step to email, replacing the current
+// one, and records email as the request's approver for the step.
+func replaceStepLink(tx *gorm.DB, leaveReq *models.LeaveRequest, step approvalStep, email string) (*models.ApprovalLink, error) {
+	nonce := uuid.New().String()
+	result := tx.Model(leaveReq).Where("status = ?", leaveReq.Status).
+		Updates(map[string]interface{}{step.tokenColumn: nonce, step.emailColumn: email})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errConcurrentUpdate
+	}
+
+	link := newLink(leaveReq.ID, step.purpose, email, nonce)
+	return link, issueLink(tx, link)
+}
+
+// systemEntry starts an audit trail row for an action taken by the server.
+func systemEntry(requestID uint, stage, decision, reason string) models.ApprovalAction {
+	return models.ApprovalAction{
+		RequestID:  requestID,
+		Approver:   models.ActorSystem,
+		Stage:      stage,
+		Decision:   decision,
+		Reason:     reason,
+		ActionDate: time.Now(),
+	}
+}
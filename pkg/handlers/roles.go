@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/database"
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"github.com/JpUnique/petrodata-leave-project/pkg/utils"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// ROLES
+// ============================================================================
+
+// RoleAssignmentRequest represents an admin changing a user's role.
+type RoleAssignmentRequest struct {
+	Email string      `json:"email"`
+	Role  models.Role `json:"role"`
+}
+
+// userSummary is a user as listed to administrators (without the password hash).
+type userSummary struct {
+	ID       uint        `json:"id"`
+	FullName string      `json:"full_name"`
+	Email    string      `json:"email"`
+	StaffNo  string      `json:"staff_no"`
+	Role     models.Role `json:"role"`
+}
+
+// hasRole reports whether email belongs to a registered user holding one of
+// roles. Admins hold every role.
+func hasRole(db *gorm.DB, email string, roles ...models.Role) (bool, error) {
+	var user models.User
+	err := db.Where("LOWER(email) = ?", utils.NormalizeEmail(email)).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if user.Role == models.RoleAdmin {
+		return true, nil
+	}
+	for _, r := range roles {
+		if user.Role == r {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkRoleHolder checks that a forwarding address belongs to a user with
+// role, refusing the decision with a 400 if it does not.
+func checkRoleHolder(email string, role models.Role) error {
+	ok, err := hasRole(database.DB, email, role)
+	if err != nil {
+		log.Printf("[ERROR] Role lookup failed for %s: %v", email, err)
+		return refuseDecision(http.StatusInternalServerError, ErrSaveAction)
+	}
+	if !ok {
+		log.Printf("[WARN] Forwarding to %s rejected: not a registered %s user", email, role)
+		return refuseDecision(http.StatusBadRequest, fmt.Sprintf("%s is not a registered user with the %s role", email, role))
+	}
+	return nil
+}
+
+// UserRoles serves /api/admin/users: GET lists users and their roles, POST
+// assigns a role to a user.
+//
+// Request body (POST):
+// - email: User email (required)
+// - role: One of staff, line_manager, hr, md, admin (required)
+func UserRoles(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var users []models.User
+		if err := database.DB.Order("full_name ASC").Find(&users).Error; err != nil {
+			log.Printf("[ERROR] Failed to list users: %v", err)
+			respondError(w, http.StatusInternalServerError, "failed to list users")
+			return
+		}
+		resp := make([]userSummary, 0, len(users))
+		for _, u := range users {
+			resp = append(resp, userSummary{ID: u.ID, FullName: u.FullName, Email: u.Email, StaffNo: u.StaffNo, Role: u.Role})
+		}
+		respondJSON(w, http.StatusOK, resp)
+
+	case http.MethodPost:
+		var req RoleAssignmentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, ErrInvalidJSON)
+			return
+		}
+		if !req.Role.Valid() {
+			respondError(w, http.StatusBadRequest, "role must be one of staff, line_manager, hr, md, admin")
+			return
+		}
+
+		result := database.DB.Model(&models.User{}).
+			Where("LOWER(email) = ?", utils.NormalizeEmail(req.Email)).
+			Update("role", req.Role)
+		if result.Error != nil {
+			log.Printf("[ERROR] Failed to assign role to %s: %v", req.Email, result.Error)
+			respondError(w, http.StatusInternalServerError, "failed to assign role")
+			return
+		}
+		if result.RowsAffected == 0 {
+			respondError(w, http.StatusNotFound, "user not found")
+			return
+		}
+
+		adminEmail, _ := r.Context().Value("userEmail").(string)
+		log.Printf("[INFO] %s assigned role %s to %s", adminEmail, req.Role, req.Email)
+		respondJSON(w, http.StatusOK, map[string]string{
+			"message": "Role updated. It takes effect at the user's next login.",
+			"email":   req.Email,
+			"role":    string(req.Role),
+		})
+
+	default:
+		respondError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/database"
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"github.com/JpUnique/petrodata-leave-project/pkg/utils"
+	"gorm.io/gorm/clause"
+)
+
+// ============================================================================
+// STAFF RECORDS
+// ============================================================================
+
+// StaffRecords serves /api/admin/staff-records: GET lists the HR staff
+// records, POST creates or replaces the record for an email. A gender or
+// employment date left empty is taken from the staff ID when it has the usual
+// "<M|F>/<day>/<month>/<year>/<serial>" form.
+//
+// Request body (POST):
+// - email, name, staff_id (required)
+// - leave_entitlement: Annual leave days (required)
+// - gender: "Male" or "Female" (optional)
+// - employed_on: Employment date, YYYY-MM-DD (optional)
+func StaffRecords(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var staff []models.StaffRecord
+		if err := database.DB.Order("name ASC").Find(&staff).Error; err != nil {
+			log.Printf("[ERROR] Failed to list staff records: %v", err)
+			respondError(w, http.StatusInternalServerError, "failed to list staff records")
+			return
+		}
+		respondJSON(w, http.StatusOK, staff)
+
+	case http.MethodPost:
+		var staff models.StaffRecord
+		if err := json.NewDecoder(r.Body).Decode(&staff); err != nil {
+			respondError(w, http.StatusBadRequest, ErrInvalidJSON)
+			return
+		}
+		staff.Email = utils.NormalizeEmail(staff.Email)
+		staff.Name = strings.TrimSpace(staff.Name)
+		staff.StaffID = strings.TrimSpace(staff.StaffID)
+		if staff.Email == "" || staff.Name == "" || staff.StaffID == "" || staff.LeaveEntitlement <= 0 {
+			respondError(w, http.StatusBadRequest, "email, name, staff_id and leave_entitlement > 0 are required")
+			return
+		}
+		if staff.Gender != "" && staff.Gender != "Male" && staff.Gender != "Female" {
+			respondError(w, http.StatusBadRequest, `gender must be "Male" or "Female"`)
+			return
+		}
+		if staff.EmployedOn.After(models.Today().Time) {
+			respondError(w, http.StatusBadRequest, "employed_on cannot be in the future")
+			return
+		}
+		staff.DeriveFromStaffID()
+		staff.ID = 0
+
+		err := database.DB.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "email"}},
+			DoUpdates: clause.AssignmentColumns([]string{"name", "staff_id", "leave_entitlement", "gender", "employed_on", "updated_at"}),
+		}).Create(&staff).Error
+		if err != nil {
+			log.Printf("[ERROR] Failed to save staff record for %s: %v", staff.Email, err)
+			respondError(w, http.StatusInternalServerError, "failed to save staff record")
+			return
+		}
+
+		hrEmail, _ := r.Context().Value("userEmail").(string)
+		log.Printf("[INFO] %s saved the staff record of %s", hrEmail, staff.Email)
+		respondJSON(w, http.StatusOK, staff)
+
+	default:
+		respondError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+	}
+}
@@ -0,0 +1,234 @@
+// Package ledger maintains per-staff, per-year, per-leave-type leave balances.
+// Days requested are reserved while a request is pending, moved to used when
+// the request is fully approved, and handed back on rejection or cancellation.
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"github.com/JpUnique/petrodata-leave-project/pkg/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Bucket is where a request's days currently sit in the ledger.
+type Bucket int
+
+// Ledger buckets
+const (
+	None Bucket = iota
+	Reserved
+	Used
+)
+
+// defaultCarryOverCap is used when LEAVE_CARRY_OVER_CAP is not set.
+const defaultCarryOverCap = 5
+
+// ErrNoStaffRecord is returned when no HR staff record exists for the email.
+var ErrNoStaffRecord = errors.New("staff record not found")
+
+// InsufficientBalanceError is returned when a request needs more days than remain.
+type InsufficientBalanceError struct {
+	LeaveType string
+	Year      int
+	Remaining int
+	Requested int
+}
+
+func (e *InsufficientBalanceError) Error() string {
+	return fmt.Sprintf("Policy Violation: You have %d day(s) of %s leave remaining for %d, but you requested %d days.",
+		e.Remaining, e.LeaveType, e.Year, e.Requested)
+}
+
+// Key identifies a single balance row.
+type Key struct {
+	StaffEmail string
+	Year       int
+	LeaveType  string
+}
+
+func (k Key) normalize() Key {
+	return Key{
+		StaffEmail: utils.NormalizeEmail(k.StaffEmail),
+		Year:       k.Year,
+		LeaveType:  strings.TrimSpace(k.LeaveType),
+	}
+}
+
+// CarryOverCap returns the maximum number of unused days carried into a new year.
+func CarryOverCap() int {
+	if v, err := strconv.Atoi(os.Getenv("LEAVE_CARRY_OVER_CAP")); err == nil && v >= 0 {
+		return v
+	}
+	return defaultCarryOverCap
+}
+
+// Get returns the balance for key, creating it (with carry-over from the
+// previous year) if it does not exist yet.
+func Get(db *gorm.DB, key Key) (models.LeaveBalance, error) {
+	return ensure(db, key.normalize(), false)
+}
+
+// Move shifts days for key from one bucket to another. Moving out of None
+// consumes balance and fails with *InsufficientBalanceError if not enough remains.
+func Move(tx *gorm.DB, key Key, days int, from, to Bucket) error {
+	if from == to || days <= 0 {
+		return nil
+	}
+
+	balance, err := ensure(tx, key.normalize(), true)
+	if err != nil {
+		return err
+	}
+
+	if from == None && balance.Remaining() < days {
+		return &InsufficientBalanceError{
+			LeaveType: balance.LeaveType,
+			Year:      balance.Year,
+			Remaining: balance.Remaining(),
+			Requested: days,
+		}
+	}
+
+	adjust(&balance, from, -days)
+	adjust(&balance, to, days)
+
+	return tx.Model(&balance).Select("reserved", "used").Updates(&balance).Error
+}
+
+// Reserve holds days for a newly submitted request.
+func Reserve(tx *gorm.DB, key Key, days int) error {
+	return Move(tx, key, days, None, Reserved)
+}
+
+// adjust adds days to bucket of b. A bucket never goes below zero; taking
+// out more than it holds means the ledger and the request disagree, which is
+// logged before the bucket is clamped.
+func adjust(b *models.LeaveBalance, bucket Bucket, days int) {
+	var field *int
+	var name string
+	switch bucket {
+	case Reserved:
+		field, name = &b.Reserved, "reserved"
+	case Used:
+		field, name = &b.Used, "used"
+	default:
+		return
+	}
+	*field += days
+	if *field < 0 {
+		log.Printf("[WARN] Ledger %s days of %s %d %s went to %d; clamped to 0", name, b.StaffEmail, b.Year, b.LeaveType, *field)
+		*field = 0
+	}
+}
+
+// ensure loads (optionally locking) or creates the balance row for key.
+func ensure(db *gorm.DB, key Key, lock bool) (models.LeaveBalance, error) {
+	var balance models.LeaveBalance
+
+	query := db
+	if lock {
+		query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	err := query.Where("staff_email = ? AND year = ? AND leave_type = ?", key.StaffEmail, key.Year, key.LeaveType).
+		First(&balance).Error
+	if err == nil {
+		return balance, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return balance, err
+	}
+
+	var staff models.StaffRecord
+	if err := db.Where("email ILIKE ?", key.StaffEmail).First(&staff).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return balance, ErrNoStaffRecord
+		}
+		return balance, err
+	}
+
+	carried, err := carryOver(db, key)
+	if err != nil {
+		return balance, err
+	}
+
+	// Leave types with their own entitlement in the catalogue override the staff record
+	entitlement := staff.LeaveEntitlement
+	var leaveType models.LeaveType
+	if err := db.Where("name = ?", key.LeaveType).Limit(1).Find(&leaveType).Error; err != nil {
+		return balance, err
+	}
+	if leaveType.Entitlement > 0 {
+		entitlement = leaveType.Entitlement
+	}
+
+	balance = models.LeaveBalance{
+		StaffEmail:  key.StaffEmail,
+		Year:        key.Year,
+		LeaveType:   key.LeaveType,
+		Entitlement: entitlement,
+		CarriedOver: carried,
+	}
+
+	// Another request may have created the row concurrently; reload in that case
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&balance)
+	if result.Error != nil {
+		return balance, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ensure(db, key, lock)
+	}
+	return balance, nil
+}
+
+// carryOver computes the days brought forward from the previous year, capped by CarryOverCap.
+func carryOver(db *gorm.DB, key Key) (int, error) {
+	var prev models.LeaveBalance
+	err := db.Where("staff_email = ? AND year = ? AND leave_type = ?", key.StaffEmail, key.Year-1, key.LeaveType).
+		First(&prev).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return min(max(prev.Remaining(), 0), CarryOverCap()), nil
+}
+
+// Rollover recomputes the carry-over of every balance in year from the final
+// figures of year-1, creating balances for staff who had none. It returns the
+// number of balances written.
+func Rollover(db *gorm.DB, year int) (int, error) {
+	var previous []models.LeaveBalance
+	if err := db.Where("year = ?", year-1).Find(&previous).Error; err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, prev := range previous {
+			key := Key{StaffEmail: prev.StaffEmail, Year: year, LeaveType: prev.LeaveType}
+			balance, err := ensure(tx, key, true)
+			if errors.Is(err, ErrNoStaffRecord) {
+				log.Printf("[WARN] Skipping rollover for %s: no staff record", prev.StaffEmail)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			carried := min(max(prev.Remaining(), 0), CarryOverCap())
+			if err := tx.Model(&balance).Update("carried_over", carried).Error; err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
@@ -0,0 +1,243 @@
+package ledger
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestAdjust(t *testing.T) {
+	tests := []struct {
+		name         string
+		bucket       Bucket
+		days         int
+		start        models.LeaveBalance
+		wantReserved int
+		wantUsed     int
+	}{
+		{"reserve", Reserved, 3, models.LeaveBalance{Reserved: 2}, 5, 0},
+		{"release", Reserved, -2, models.LeaveBalance{Reserved: 5}, 3, 0},
+		{"use", Used, 4, models.LeaveBalance{Used: 1}, 0, 5},
+		{"restore", Used, -4, models.LeaveBalance{Used: 6}, 0, 2},
+		{"none changes nothing", None, 7, models.LeaveBalance{Reserved: 1, Used: 1}, 1, 1},
+		{"reserved clamps at zero", Reserved, -5, models.LeaveBalance{Reserved: 2}, 0, 0},
+		{"used clamps at zero", Used, -5, models.LeaveBalance{Used: 3}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.start
+			adjust(&b, tt.bucket, tt.days)
+			if b.Reserved != tt.wantReserved || b.Used != tt.wantUsed {
+				t.Errorf("reserved/used = %d/%d, want %d/%d", b.Reserved, b.Used, tt.wantReserved, tt.wantUsed)
+			}
+		})
+	}
+}
+
+func TestKeyNormalize(t *testing.T) {
+	got := Key{StaffEmail: "  Ada.Obi@PetroData.net ", Year: 2026, LeaveType: " Annual "}.normalize()
+	want := Key{StaffEmail: "ada.obi@petrodata.net", Year: 2026, LeaveType: "Annual"}
+	if got != want {
+		t.Errorf("normalize() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCarryOverCap(t *testing.T) {
+	tests := []struct {
+		env  string
+		want int
+	}{
+		{"", defaultCarryOverCap},
+		{"10", 10},
+		{"0", 0},
+		{"-1", defaultCarryOverCap},
+		{"ten", defaultCarryOverCap},
+	}
+	for _, tt := range tests {
+		t.Setenv("LEAVE_CARRY_OVER_CAP", tt.env)
+		if got := CarryOverCap(); got != tt.want {
+			t.Errorf("CarryOverCap() with %q = %d, want %d", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestInsufficientBalanceError(t *testing.T) {
+	err := &InsufficientBalanceError{LeaveType: "Annual", Year: 2026, Remaining: 2, Requested: 5}
+	msg := err.Error()
+	for _, part := range []string{"2 day(s)", "Annual", "2026", "requested 5"} {
+		if !strings.Contains(msg, part) {
+			t.Errorf("Error() = %q, missing %q", msg, part)
+		}
+	}
+}
+
+// testDB opens the Postgres database in TEST_DATABASE_URL and returns a
+// transaction rolled back when the test ends. Tests needing it are skipped
+// when the variable is not set.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	tx := db.Begin()
+	t.Cleanup(func() { tx.Rollback() })
+	if err := tx.AutoMigrate(&models.StaffRecord{}, &models.LeaveType{}, &models.LeaveBalance{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	// Start from empty tables inside the transaction
+	for _, table := range []string{"leave_balances", "leave_types", "staff_records"} {
+		if err := tx.Exec("DELETE FROM " + table).Error; err != nil {
+			t.Fatalf("clear %s: %v", table, err)
+		}
+	}
+	return tx
+}
+
+func addStaff(t *testing.T, tx *gorm.DB, email string, entitlement int) {
+	t.Helper()
+	staff := models.StaffRecord{Name: email, StaffID: email, Email: email, LeaveEntitlement: entitlement}
+	if err := tx.Create(&staff).Error; err != nil {
+		t.Fatalf("create staff %s: %v", email, err)
+	}
+}
+
+func balanceOf(t *testing.T, tx *gorm.DB, key Key) models.LeaveBalance {
+	t.Helper()
+	b, err := Get(tx, key)
+	if err != nil {
+		t.Fatalf("Get(%+v): %v", key, err)
+	}
+	return b
+}
+
+func TestReserveAndMove(t *testing.T) {
+	tx := testDB(t)
+	t.Setenv("LEAVE_CARRY_OVER_CAP", "5")
+	addStaff(t, tx, "ada@petrodata.net", 20)
+	key := Key{StaffEmail: "Ada@PetroData.net", Year: 2026, LeaveType: "Annual"}
+
+	if err := Reserve(tx, key, 8); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if b := balanceOf(t, tx, key); b.Entitlement != 20 || b.Reserved != 8 || b.Remaining() != 12 {
+		t.Fatalf("after reserve: %+v", b)
+	}
+
+	// Asking for more than remains fails and changes nothing
+	err := Reserve(tx, key, 13)
+	var balanceErr *InsufficientBalanceError
+	if !errors.As(err, &balanceErr) || balanceErr.Remaining != 12 || balanceErr.Requested != 13 {
+		t.Fatalf("Reserve over balance = %v, want *InsufficientBalanceError for 12 remaining", err)
+	}
+
+	if err := Move(tx, key, 8, Reserved, Used); err != nil {
+		t.Fatalf("Move reserved -> used: %v", err)
+	}
+	if b := balanceOf(t, tx, key); b.Reserved != 0 || b.Used != 8 {
+		t.Fatalf("after approval: %+v", b)
+	}
+
+	if err := Move(tx, key, 8, Used, None); err != nil {
+		t.Fatalf("Move used -> none: %v", err)
+	}
+	if b := balanceOf(t, tx, key); b.Used != 0 || b.Remaining() != 20 {
+		t.Fatalf("after cancellation: %+v", b)
+	}
+
+	// No-op moves
+	if err := Move(tx, key, 0, None, Reserved); err != nil {
+		t.Fatalf("Move of 0 days: %v", err)
+	}
+	if err := Move(tx, key, 3, Used, Used); err != nil {
+		t.Fatalf("Move within a bucket: %v", err)
+	}
+	if b := balanceOf(t, tx, key); b.Reserved != 0 || b.Used != 0 {
+		t.Fatalf("no-op moves changed the balance: %+v", b)
+	}
+}
+
+func TestReserveWithoutStaffRecord(t *testing.T) {
+	tx := testDB(t)
+	err := Reserve(tx, Key{StaffEmail: "nobody@petrodata.net", Year: 2026, LeaveType: "Annual"}, 1)
+	if !errors.Is(err, ErrNoStaffRecord) {
+		t.Fatalf("Reserve = %v, want ErrNoStaffRecord", err)
+	}
+}
+
+func TestLeaveTypeEntitlementOverridesStaffRecord(t *testing.T) {
+	tx := testDB(t)
+	addStaff(t, tx, "ada@petrodata.net", 20)
+	if err := tx.Create(&models.LeaveType{Name: "Sick", Entitlement: 10, Active: true}).Error; err != nil {
+		t.Fatalf("create leave type: %v", err)
+	}
+
+	sick := balanceOf(t, tx, Key{StaffEmail: "ada@petrodata.net", Year: 2026, LeaveType: "Sick"})
+	annual := balanceOf(t, tx, Key{StaffEmail: "ada@petrodata.net", Year: 2026, LeaveType: "Annual"})
+	if sick.Entitlement != 10 || annual.Entitlement != 20 {
+		t.Fatalf("entitlements sick/annual = %d/%d, want 10/20", sick.Entitlement, annual.Entitlement)
+	}
+}
+
+func TestRollover(t *testing.T) {
+	tx := testDB(t)
+	t.Setenv("LEAVE_CARRY_OVER_CAP", "5")
+	addStaff(t, tx, "ada@petrodata.net", 20)
+	addStaff(t, tx, "bola@petrodata.net", 20)
+
+	ada := Key{StaffEmail: "ada@petrodata.net", Year: 2025, LeaveType: "Annual"}
+	bola := Key{StaffEmail: "bola@petrodata.net", Year: 2025, LeaveType: "Annual"}
+	if err := Reserve(tx, ada, 18); err != nil { // 2 days left: all carried
+		t.Fatalf("Reserve: %v", err)
+	}
+	if err := Reserve(tx, bola, 4); err != nil { // 16 days left: capped at 5
+		t.Fatalf("Reserve: %v", err)
+	}
+	// A balance whose staff record is gone is skipped
+	orphan := models.LeaveBalance{StaffEmail: "gone@petrodata.net", Year: 2025, LeaveType: "Annual", Entitlement: 20}
+	if err := tx.Create(&orphan).Error; err != nil {
+		t.Fatalf("create orphan balance: %v", err)
+	}
+
+	count, err := Rollover(tx, 2026)
+	if err != nil {
+		t.Fatalf("Rollover: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Rollover wrote %d balances, want 2", count)
+	}
+
+	ada.Year, bola.Year = 2026, 2026
+	if b := balanceOf(t, tx, ada); b.CarriedOver != 2 || b.Remaining() != 22 {
+		t.Errorf("ada 2026: %+v, want 2 carried over", b)
+	}
+	if b := balanceOf(t, tx, bola); b.CarriedOver != 5 {
+		t.Errorf("bola 2026: %+v, want carry-over capped at 5", b)
+	}
+
+	// Late changes to the previous year are picked up by a second rollover
+	bola.Year = 2025
+	if err := Move(tx, bola, 4, Reserved, None); err != nil {
+		t.Fatalf("Move: %v", err)
+	}
+	if err := Reserve(tx, bola, 17); err != nil { // 3 days left
+		t.Fatalf("Reserve: %v", err)
+	}
+	if _, err := Rollover(tx, 2026); err != nil {
+		t.Fatalf("second Rollover: %v", err)
+	}
+	bola.Year = 2026
+	if b := balanceOf(t, tx, bola); b.CarriedOver != 3 {
+		t.Errorf("bola 2026 after second rollover: %+v, want 3 carried over", b)
+	}
+}
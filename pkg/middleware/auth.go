@@ -6,56 +6,103 @@ import (
 	"os"
 	"strings"
 
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 // Auth validates JWT token and adds user info to request context
 func Auth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Get Authorization header
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, `{"error":"Missing authorization token"}`, http.StatusUnauthorized)
+		claims, ok := parseClaims(w, r)
+		if !ok {
 			return
 		}
 
-		// Expected format: "Bearer <token>"
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			http.Error(w, `{"error":"Invalid authorization format"}`, http.StatusUnauthorized)
+		// Call next handler with enriched context
+		next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
+	}
+}
+
+// AuthRole is Auth restricted to users holding one of roles. Admins are
+// always allowed. Tokens issued before roles existed count as staff.
+func AuthRole(next http.HandlerFunc, roles ...models.Role) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := parseClaims(w, r)
+		if !ok {
 			return
 		}
 
-		tokenString := parts[1]
-
-		// Parse and validate token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Ensure signing method is HMAC
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
+		role := claimRole(claims)
+		allowed := role == models.RoleAdmin
+		for _, want := range roles {
+			if role == want {
+				allowed = true
 			}
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
-
-		if err != nil || !token.Valid {
-			http.Error(w, `{"error":"Invalid or expired token"}`, http.StatusUnauthorized)
+		}
+		if !allowed {
+			http.Error(w, `{"error":"You do not have permission to perform this action"}`, http.StatusForbidden)
 			return
 		}
 
-		// Extract claims
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			http.Error(w, `{"error":"Invalid token claims"}`, http.StatusUnauthorized)
-			return
+		next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
+	}
+}
+
+// parseClaims validates the bearer token and returns its claims. It writes a
+// 401 response and returns false on failure.
+func parseClaims(w http.ResponseWriter, r *http.Request) (jwt.MapClaims, bool) {
+	// Get Authorization header
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, `{"error":"Missing authorization token"}`, http.StatusUnauthorized)
+		return nil, false
+	}
+
+	// Expected format: "Bearer <token>"
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		http.Error(w, `{"error":"Invalid authorization format"}`, http.StatusUnauthorized)
+		return nil, false
+	}
+
+	tokenString := parts[1]
+
+	// Parse and validate token
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		// Ensure signing method is HMAC
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
 		}
+		return []byte(os.Getenv("JWT_SECRET")), nil
+	})
 
-		// Add user data to context
-		ctx := r.Context()
-		ctx = context.WithValue(ctx, "userEmail", claims["email"])
-		ctx = context.WithValue(ctx, "userName", claims["name"])
-		ctx = context.WithValue(ctx, "userStaffNo", claims["staff_no"])
+	if err != nil || !token.Valid {
+		http.Error(w, `{"error":"Invalid or expired token"}`, http.StatusUnauthorized)
+		return nil, false
+	}
 
-		// Call next handler with enriched context
-		next.ServeHTTP(w, r.WithContext(ctx))
+	// Extract claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		http.Error(w, `{"error":"Invalid token claims"}`, http.StatusUnauthorized)
+		return nil, false
+	}
+	return claims, true
+}
+
+// claimRole returns the role carried in the token, defaulting to staff.
+func claimRole(claims jwt.MapClaims) models.Role {
+	if role, ok := claims["role"].(string); ok && models.Role(role).Valid() {
+		return models.Role(role)
 	}
+	return models.RoleStaff
+}
+
+// withClaims adds user data to the request context
+func withClaims(ctx context.Context, claims jwt.MapClaims) context.Context {
+	ctx = context.WithValue(ctx, "userEmail", claims["email"])
+	ctx = context.WithValue(ctx, "userName", claims["name"])
+	ctx = context.WithValue(ctx, "userStaffNo", claims["staff_no"])
+	ctx = context.WithValue(ctx, "userRole", string(claimRole(claims)))
+	return ctx
 }
@@ -1,11 +1,38 @@
 package models
 
 import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
 )
 
+// Role is a user's authority in the leave workflow.
+type Role string
+
+// User roles
+const (
+	RoleStaff       Role = "staff"
+	RoleLineManager Role = "line_manager"
+	RoleHR          Role = "hr"
+	RoleMD          Role = "md"
+	RoleAdmin       Role = "admin"
+)
+
+// Valid reports whether r is one of the defined roles.
+func (r Role) Valid() bool {
+	switch r {
+	case RoleStaff, RoleLineManager, RoleHR, RoleMD, RoleAdmin:
+		return true
+	}
+	return false
+}
+
 type User struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
 	FullName    string    `json:"full_name"`
@@ -13,6 +40,7 @@ type User struct {
 	Password    string    `json:"password"`
 	PhoneNumber string    `json:"phone_number"`
 	StaffNo     string    `gorm:"uniqueIndex" json:"staff_no"`
+	Role        Role      `gorm:"default:'staff'" json:"role"`
 	CreatedAt   time.Time `json:"created_at"`
 }
 
@@ -24,12 +52,12 @@ type LeaveRequest struct {
 	Designation           string `json:"designation"`
 	Department            string `json:"department"`
 	LeaveType             string `json:"leave_type"`
-	StartDate             string `json:"start_date"`
-	ResumptionDate        string `json:"resumption_date"`
+	StartDate             Date   `gorm:"index" json:"start_date"`
+	ResumptionDate        Date   `gorm:"index" json:"resumption_date"`
 	TotalDays             int    `json:"total_days"`
 	ReliefStaff           string `json:"relief_staff"`
 	ContactAddress        string `json:"contact_address"`
-	DateEmployed          string `json:"date_employed"` // NEW
+	DateEmployed          Date   `json:"date_employed"` // NEW
 	PhoneNumber           string `json:"phone_number"`
 	LeaveAllowanceRequest bool   `json:"leave_allowance_request"`
 
@@ -57,14 +85,228 @@ type LeaveRequest struct {
 	MDToken      *string `gorm:"column:director_token" json:"director_token"` // MD's link (Added)
 	FinalHRToken *string `gorm:"column:final_token" json:"final_token"`       // Added for the Archive/PDF page
 
+	// Configured approval chain (nil means the built-in Manager -> HR -> MD flow)
+	ChainID      *uint `gorm:"index" json:"chain_id,omitempty"`
+	CurrentStage int   `json:"current_stage,omitempty"` // Position of the stage awaiting action
+
+	// Leave balance year the request is reserved against / debited from
+	BalanceYear int `json:"balance_year"`
+	// Leave type whose balance is charged, e.g. "Annual" for types counted
+	// against annual leave (empty on requests made before the catalogue)
+	BalanceType string `json:"balance_type,omitempty"`
+
+	// Supporting document (e.g. a medical certificate), kept in storage
+	SupportingDocumentKey string `json:"-"`
+
+	// Set with the final approval until the record worker has archived and
+	// emailed the leave record
+	RecordPending bool `gorm:"not null;default:false" json:"-"`
+
+	// Withdrawal by the staff member
+	CancellationReason string     `json:"cancellation_reason,omitempty"`
+	CancelledAt        *time.Time `json:"cancelled_at,omitempty"`
+
 	CreatedAt time.Time `json:"created_at"`
 }
+
+// Reference returns the human-readable request reference, e.g. "LR-000042".
+func (l LeaveRequest) Reference() string {
+	return fmt.Sprintf("LR-%06d", l.ID)
+}
+
+// ApprovalAction is one entry in a request's audit trail: a decision, a
+// forward, a cancellation step or a link re-issue. Rows are never changed.
 type ApprovalAction struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	RequestID   uint      `gorm:"index" json:"request_id"`
+	Approver    string    `json:"approver"`                             // Email of whoever acted
+	OnBehalfOf  string    `json:"on_behalf_of,omitempty"`               // Principal, when a delegate acted for them
+	Signature   string    `gorm:"type:text" json:"signature,omitempty"` // PNG data URL drawn or typed by the approver
+	Stage       string    `json:"stage"`
+	Decision    string    `json:"decision"`
+	Reason      string    `json:"reason,omitempty"`
+	ForwardedTo string    `json:"forwarded_to,omitempty"`
+	ClientIP    string    `json:"client_ip"`
+	UserAgent   string    `json:"user_agent"`
+	ActionDate  time.Time `gorm:"index" json:"action_date"`
+}
+
+// Audit trail entries that are not workflow decisions
+const (
+	ActionLinkReissued = "Link Re-issued"
+	ActionReminderSent = "Reminder Sent"
+	ActionEscalated    = "Escalated"
+)
+
+// ActorSystem is the audit trail approver of actions taken by the server itself.
+const ActorSystem = "system"
+
+// signaturePrefix is the data URL prefix every stored signature carries.
+const signaturePrefix = "data:image/png;base64,"
+
+// MaxSignatureBytes bounds the size of a decoded signature image.
+const MaxSignatureBytes = 200 << 10
+
+// pngMagic is the fixed header of every PNG file.
+var pngMagic = []byte("\x89PNG\r\n\x1a\n")
+
+// ErrInvalidSignature is returned when a signature is not a PNG data URL.
+var ErrInvalidSignature = errors.New("signature must be a PNG image")
+
+// SignatureImage decodes the PNG signature captured with the action.
+func (a ApprovalAction) SignatureImage() ([]byte, error) {
+	encoded, ok := strings.CutPrefix(a.Signature, signaturePrefix)
+	if !ok {
+		return nil, ErrInvalidSignature
+	}
+	img, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || !bytes.HasPrefix(img, pngMagic) {
+		return nil, ErrInvalidSignature
+	}
+	if len(img) > MaxSignatureBytes {
+		return nil, fmt.Errorf("signature image must be under %d KB", MaxSignatureBytes>>10)
+	}
+	return img, nil
+}
+
+// ErrImmutableAction is returned when an audit trail row is updated or deleted.
+var ErrImmutableAction = errors.New("approval actions cannot be changed")
+
+// BeforeUpdate keeps audit trail rows immutable.
+func (ApprovalAction) BeforeUpdate(*gorm.DB) error { return ErrImmutableAction }
+
+// BeforeDelete keeps audit trail rows immutable.
+func (ApprovalAction) BeforeDelete(*gorm.DB) error { return ErrImmutableAction }
+
+// ApprovalChain is an approval route defined as data. At submission the most
+// specific active chain matching the department, leave type and duration is
+// used; requests matching no chain follow the built-in Manager -> HR -> MD flow.
+type ApprovalChain struct {
+	ID           uint                 `gorm:"primaryKey" json:"id"`
+	Name         string               `json:"name"`
+	Department   string               `gorm:"index" json:"department"` // Empty matches any department
+	LeaveType    string               `json:"leave_type"`              // Empty matches any leave type
+	MinDays      int                  `json:"min_days"`
+	MaxDays      int                  `json:"max_days"` // 0 means no upper bound
+	Priority     int                  `json:"priority"` // Higher wins when several chains match
+	ArchiveEmail string               `json:"archive_email"`
+	Active       bool                 `gorm:"not null;default:false" json:"active"`
+	Stages       []ApprovalChainStage `gorm:"foreignKey:ChainID;constraint:OnDelete:CASCADE" json:"stages"`
+	CreatedAt    time.Time            `json:"created_at"`
+}
+
+// ApprovalChainStage is one step of an ApprovalChain.
+type ApprovalChainStage struct {
+	ID            uint   `gorm:"primaryKey" json:"id"`
+	ChainID       uint   `gorm:"index" json:"chain_id"`
+	Position      int    `json:"position"`
+	Name          string `json:"name"`           // e.g. "Line Manager", "Operations Head"
+	ApproverEmail string `json:"approver_email"` // Empty: chosen by the previous approver (or the staff for stage 1)
+}
+
+// LeaveRequestStage is the per-request copy of a chain stage, holding its own
+// link token and decision.
+type LeaveRequestStage struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	LeaveRequestID uint       `gorm:"index" json:"leave_request_id"`
+	Position       int        `json:"position"`
+	Name           string     `json:"name"`
+	ApproverEmail  string     `json:"approver_email"`
+	Token          *string    `gorm:"uniqueIndex" json:"-"`
+	Decision       string     `json:"decision"`
+	Reason         string     `json:"reason,omitempty"`
+	DecidedAt      *time.Time `json:"decided_at,omitempty"`
+}
+
+// LeaveBalance is a staff member's ledger for one leave type in one year.
+// Days move from Reserved to Used on final approval and are released on
+// rejection or cancellation.
+type LeaveBalance struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	StaffEmail  string    `gorm:"uniqueIndex:idx_leave_balances_key" json:"staff_email"`
+	Year        int       `gorm:"uniqueIndex:idx_leave_balances_key" json:"year"`
+	LeaveType   string    `gorm:"uniqueIndex:idx_leave_balances_key" json:"leave_type"`
+	Entitlement int       `json:"entitlement"`
+	CarriedOver int       `json:"carried_over"`
+	Reserved    int       `json:"reserved"`
+	Used        int       `json:"used"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Remaining returns the days still available to request.
+func (b LeaveBalance) Remaining() int {
+	return b.Entitlement + b.CarriedOver - b.Reserved - b.Used
+}
+
+// PublicHoliday is a movable public holiday (e.g. Eid-el-Fitr, Eid-el-Kabir)
+// declared each year and entered by HR. Fixed-date holidays are computed.
+type PublicHoliday struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Date      time.Time `gorm:"type:date;uniqueIndex" json:"date"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Approval link purposes
+const (
+	LinkManager      = "manager"
+	LinkHR           = "hr"
+	LinkMD           = "md"
+	LinkFinal        = "final"
+	LinkStage        = "stage"
+	LinkCancellation = "cancellation" // HR's confirmation of a cancelled approved leave
+)
+
+// ApprovalLink records when an emailed link token was issued, when it expires
+// and when it was used. A token stops working once used, replaced or expired.
+// The emailed URL carries a signed form of Token bound to ApproverEmail.
+type ApprovalLink struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	Token          string     `gorm:"uniqueIndex" json:"-"`
+	LeaveRequestID uint       `gorm:"index" json:"leave_request_id"`
+	Purpose        string     `json:"purpose"`
+	ApproverEmail  string     `json:"approver_email"`
+	OnBehalfOf     string     `json:"on_behalf_of,omitempty"` // Principal, when issued to their delegate
+	IssuedAt       time.Time  `json:"issued_at"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	UsedAt         *time.Time `json:"used_at,omitempty"`                              // Set when acted on, replaced or revoked
+	Legacy         bool       `gorm:"not null;default:false" json:"legacy,omitempty"` // Emailed unsigned, before links were signed
+
+	// One-time code emailed to ApproverEmail when approvers must confirm their address
+	CodeHash      string     `json:"-"`
+	CodeExpiresAt *time.Time `json:"-"`
+	CodeAttempts  int        `json:"-"`
+}
+
+// Delegation hands an approver's links to a delegate for a date range, e.g.
+// while they are out of office. Links issued to the principal in that range
+// go to the delegate instead, with the principal copied.
+type Delegation struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	PrincipalEmail string    `gorm:"index" json:"principal_email"`
+	DelegateEmail  string    `json:"delegate_email"`
+	StartsOn       Date      `json:"starts_on"`
+	EndsOn         Date      `json:"ends_on"` // Inclusive
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Principal returns the approver the link is for: the one it was issued to,
+// or the principal when it was issued to their delegate.
+func (l ApprovalLink) Principal() string {
+	if l.OnBehalfOf != "" {
+		return l.OnBehalfOf
+	}
+	return l.ApproverEmail
+}
+
+// StaffingRule is the minimum number of staff a department must keep on duty.
+// Approvers get a hard warning when a leave would take the department below it.
+type StaffingRule struct {
 	ID         uint      `gorm:"primaryKey" json:"id"`
-	RequestID  uint      `json:"request_id"`
-	Approver   string    `json:"approver"`
-	Signature  string    `json:"signature"`
-	ActionDate time.Time `json:"action_date"`
+	Department string    `gorm:"uniqueIndex" json:"department"`
+	Headcount  int       `json:"headcount"`
+	MinOnDuty  int       `json:"min_on_duty"`
+	UpdatedAt  time.Time `json:"updated_at"`
 }
 
 // StaffRecord stores the HR-provided entitlement data
@@ -74,4 +316,133 @@ type StaffRecord struct {
 	StaffID          string `gorm:"uniqueIndex" json:"staff_id"`
 	Email            string `gorm:"uniqueIndex" json:"email"`
 	LeaveEntitlement int    `json:"leave_entitlement"`
+	Gender           string `json:"gender,omitempty"`      // "Male" or "Female", for gender-restricted leave types
+	EmployedOn       Date   `json:"employed_on,omitempty"` // For leave types with a minimum length of service
+}
+
+// DeriveFromStaffID fills an empty Gender and EmployedOn from the staff ID,
+// which PetroData issues as "<M|F>/<day>/<month>/<year employed>/<serial>",
+// e.g. "F/06/04/2010/0034". IDs in any other form are left alone.
+func (s *StaffRecord) DeriveFromStaffID() {
+	parts := strings.Split(strings.TrimSpace(s.StaffID), "/")
+	if len(parts) != 5 {
+		return
+	}
+	if s.Gender == "" {
+		switch strings.ToUpper(parts[0]) {
+		case "M":
+			s.Gender = "Male"
+		case "F":
+			s.Gender = "Female"
+		}
+	}
+	if s.EmployedOn.IsZero() {
+		day, dayErr := strconv.Atoi(parts[1])
+		month, monthErr := strconv.Atoi(parts[2])
+		year, yearErr := strconv.Atoi(parts[3])
+		if dayErr != nil || monthErr != nil || yearErr != nil {
+			return
+		}
+		employed := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+		if employed.Day() == day && int(employed.Month()) == month && employed.Year() == year && employed.Before(time.Now()) {
+			s.EmployedOn = NewDate(employed)
+		}
+	}
+}
+
+// AnnualLeaveType is the leave type whose balance is charged for types that
+// count against annual leave.
+const AnnualLeaveType = "Annual"
+
+// LeaveType is an entry of the HR-managed leave type catalogue and the rules
+// applied when a request of that type is submitted. Zero values mean no rule.
+type LeaveType struct {
+	ID                  uint      `gorm:"primaryKey" json:"id"`
+	Name                string    `gorm:"uniqueIndex" json:"name"` // Stored on requests, e.g. "Sick"
+	Label               string    `json:"label"`                   // Shown on the leave form, e.g. "Sick Leave"
+	Entitlement         int       `json:"entitlement"`             // Days a year; 0 uses the staff record's entitlement
+	Paid                bool      `json:"paid"`
+	CountsAgainstAnnual bool      `json:"counts_against_annual"` // Charged to the annual leave balance
+	MaxConsecutiveDays  int       `json:"max_consecutive_days"`  // Working days per request
+	MinNoticeDays       int       `json:"min_notice_days"`       // Calendar days between submission and start
+	DocumentRequired    bool      `json:"document_required"`     // A supporting document must be attached
+	AllowedGenders      string    `json:"allowed_genders"`       // Comma separated; empty allows everyone
+	MinServiceMonths    int       `json:"min_service_months"`    // Months since the employment date
+	Active              bool      `json:"active"`                // Offered on the leave form
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// BalanceType returns the leave type whose balance a request of t is charged to.
+func (t LeaveType) BalanceType() string {
+	if t.CountsAgainstAnnual {
+		return AnnualLeaveType
+	}
+	return t.Name
+}
+
+// AllowsGender reports whether staff of gender may take leave of type t.
+func (t LeaveType) AllowsGender(gender string) bool {
+	if strings.TrimSpace(t.AllowedGenders) == "" {
+		return true
+	}
+	for _, allowed := range strings.Split(t.AllowedGenders, ",") {
+		if strings.EqualFold(strings.TrimSpace(allowed), strings.TrimSpace(gender)) {
+			return true
+		}
+	}
+	return false
+}
+
+// LeaveDocument is one generated leave record PDF. The PDF prints DocumentID
+// and a QR code to the public verification page, and SHA256 is the hash of
+// the bytes as issued so an altered copy can be told apart from the original.
+// The final record of a fully approved request is archived: generated once,
+// kept in storage under StorageKey and emailed to staff and HR once.
+type LeaveDocument struct {
+	ID             uint       `gorm:"primaryKey" json:"-"`
+	DocumentID     string     `gorm:"uniqueIndex;size:36" json:"document_id"`
+	LeaveRequestID uint       `gorm:"index" json:"leave_request_id"`
+	StaffNo        string     `gorm:"index" json:"staff_no"`
+	StaffName      string     `json:"staff_name"`
+	Year           int        `gorm:"index" json:"year"` // Leave balance year
+	StatusAtIssue  string     `json:"status_at_issue"`
+	SHA256         string     `gorm:"size:64" json:"sha256"`
+	Size           int        `json:"size"`
+	StorageKey     string     `json:"-"`                                    // Empty for records generated before archiving, or whose file was lost and re-issued
+	ReissueOf      string     `gorm:"size:36" json:"reissue_of,omitempty"`  // Document ID of the lost record this one re-issues
+	ReplacedBy     string     `gorm:"size:36" json:"replaced_by,omitempty"` // Document ID of the record re-issued in place of this one
+	GeneratedAt    time.Time  `json:"generated_at"`
+	EmailedAt      *time.Time `json:"emailed_at,omitempty"`
+}
+
+// ArchivedFile holds a stored file for the database archive backend.
+type ArchivedFile struct {
+	Key       string `gorm:"primaryKey"`
+	Data      []byte
+	CreatedAt time.Time
+}
+
+// Outbox delivery states
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed" // Gave up after the maximum number of attempts
+)
+
+// OutboxEmail is a notification queued in the same transaction as the change
+// it announces and delivered by the outbox worker with retries.
+type OutboxEmail struct {
+	ID                uint       `gorm:"primaryKey" json:"id"`
+	LeaveRequestID    *uint      `gorm:"index" json:"leave_request_id,omitempty"`
+	Recipient         string     `json:"recipient"` // To addresses, comma separated
+	Subject           string     `json:"subject"`
+	Payload           string     `gorm:"type:text" json:"-"` // JSON-encoded service.Message
+	Status            string     `gorm:"index;default:'pending'" json:"status"`
+	Attempts          int        `json:"attempts"`
+	NextAttemptAt     time.Time  `gorm:"index" json:"next_attempt_at"`
+	LastAttemptAt     *time.Time `json:"last_attempt_at,omitempty"`
+	LastError         string     `json:"last_error,omitempty"`
+	ProviderMessageID string     `json:"provider_message_id,omitempty"`
+	SentAt            *time.Time `json:"sent_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
 }
@@ -0,0 +1,213 @@
+// Package outbox delivers workflow notifications reliably. Messages are
+// written to the outbox_emails table in the same transaction as the change
+// they announce, then sent by a background worker that retries failed
+// deliveries with exponential backoff and records each outcome.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"github.com/JpUnique/petrodata-leave-project/pkg/service"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Worker tuning
+const (
+	pollInterval       = 5 * time.Second
+	batchSize          = 20
+	claimLease         = 2 * time.Minute // A claimed message is retried after this if its worker dies
+	sendTimeout        = 30 * time.Second
+	baseBackoff        = 30 * time.Second
+	maxBackoff         = 6 * time.Hour
+	defaultMaxAttempts = 8
+)
+
+// ErrNotFailed is returned by Resend for a message that has not failed.
+var ErrNotFailed = errors.New("only failed notifications can be re-sent")
+
+var wake = make(chan struct{}, 1)
+
+// maxAttempts is how many deliveries are tried before a message is marked
+// failed, taken from OUTBOX_MAX_ATTEMPTS.
+func maxAttempts() int {
+	n, err := strconv.Atoi(os.Getenv("OUTBOX_MAX_ATTEMPTS"))
+	if err != nil || n <= 0 {
+		return defaultMaxAttempts
+	}
+	return n
+}
+
+// backoff is the delay before the next delivery after attempts failures.
+func backoff(attempts int) time.Duration {
+	d := baseBackoff
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
+
+// Enqueue queues msgs for delivery as part of tx. requestID links them to a
+// leave request; 0 means none.
+func Enqueue(tx *gorm.DB, requestID uint, msgs ...service.Message) error {
+	now := time.Now()
+	for _, msg := range msgs {
+		payload, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		email := models.OutboxEmail{
+			Recipient:     strings.Join(msg.To, ", "),
+			Subject:       msg.Subject,
+			Payload:       string(payload),
+			Status:        models.OutboxPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		}
+		if requestID != 0 {
+			email.LeaveRequestID = &requestID
+		}
+		if err := tx.Create(&email).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Wake asks the worker to look for due messages now rather than at its next
+// poll. Call it after committing a transaction that enqueued messages.
+func Wake() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs the delivery worker until ctx is cancelled.
+func Start(ctx context.Context, db *gorm.DB) {
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			deliverDue(ctx, db)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-wake:
+			}
+		}
+	}()
+}
+
+// deliverDue sends every message whose next attempt is due.
+func deliverDue(ctx context.Context, db *gorm.DB) {
+	for ctx.Err() == nil {
+		batch, err := claim(db)
+		if err != nil {
+			log.Printf("[ERROR] outbox: failed to claim messages: %v", err)
+			return
+		}
+		if len(batch) == 0 {
+			return
+		}
+		for _, email := range batch {
+			deliver(ctx, db, email)
+		}
+	}
+}
+
+// claim takes a batch of due messages, pushing their next attempt past the
+// lease so other workers skip them while they are being sent.
+func claim(db *gorm.DB) ([]models.OutboxEmail, error) {
+	var batch []models.OutboxEmail
+	now := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.OutboxPending, now).
+			Order("next_attempt_at ASC, id ASC").
+			Limit(batchSize).
+			Find(&batch).Error
+		if err != nil || len(batch) == 0 {
+			return err
+		}
+		ids := make([]uint, len(batch))
+		for i, email := range batch {
+			ids[i] = email.ID
+		}
+		return tx.Model(&models.OutboxEmail{}).Where("id IN ?", ids).
+			Update("next_attempt_at", now.Add(claimLease)).Error
+	})
+	return batch, err
+}
+
+// deliver makes one delivery attempt and records its outcome.
+func deliver(ctx context.Context, db *gorm.DB, email models.OutboxEmail) {
+	now := time.Now()
+	attempts := email.Attempts + 1
+	updates := map[string]interface{}{
+		"attempts":        attempts,
+		"last_attempt_at": now,
+	}
+
+	var msg service.Message
+	err := json.Unmarshal([]byte(email.Payload), &msg)
+	if err == nil {
+		sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+		var messageID string
+		messageID, err = service.Deliver(sendCtx, msg)
+		cancel()
+		if err == nil {
+			updates["status"] = models.OutboxSent
+			updates["sent_at"] = now
+			updates["provider_message_id"] = messageID
+			updates["last_error"] = ""
+			log.Printf("[INFO] outbox: sent %d %q to %s (%s)", email.ID, email.Subject, email.Recipient, messageID)
+		}
+	}
+
+	if err != nil {
+		updates["last_error"] = err.Error()
+		if attempts >= maxAttempts() {
+			updates["status"] = models.OutboxFailed
+			log.Printf("[ERROR] outbox: giving up on %d %q to %s after %d attempts: %v", email.ID, email.Subject, email.Recipient, attempts, err)
+		} else {
+			updates["next_attempt_at"] = now.Add(backoff(attempts))
+			log.Printf("[WARN] outbox: attempt %d of %d on %d %q to %s failed: %v", attempts, maxAttempts(), email.ID, email.Subject, email.Recipient, err)
+		}
+	}
+
+	if err := db.Model(&models.OutboxEmail{}).Where("id = ?", email.ID).Updates(updates).Error; err != nil {
+		log.Printf("[ERROR] outbox: failed to record attempt on %d: %v", email.ID, err)
+	}
+}
+
+// Resend puts a failed message back in the queue with a fresh set of attempts.
+func Resend(db *gorm.DB, id uint) error {
+	result := db.Model(&models.OutboxEmail{}).
+		Where("id = ? AND status = ?", id, models.OutboxFailed).
+		Updates(map[string]interface{}{
+			"status":          models.OutboxPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFailed
+	}
+	Wake()
+	return nil
+}
@@ -2,105 +2,21 @@ package service
 
 import (
 	"context"
-	"encoding/base64"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"regexp"
 	"time"
 
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
 	"github.com/jaytaylor/html2text"
-	"github.com/mailersend/mailersend-go"
 )
 
-// ============================================================================
-// MAILERSEND CLIENT SETUP
-// ============================================================================
-
-var (
-	mailerSendClient *mailersend.Mailersend
-	fromEmail        mailersend.From
-)
-
-func init() {
-	// Initialize MailerSend client with API key from environment
-	apiKey := os.Getenv("MAILER_SEND_API_KEY")
-	// if apiKey == "" {
-	// 	panic("MAILER_SEND_API_KEY environment variable is required")
-	// }
-
-	mailerSendClient = mailersend.NewMailersend(apiKey)
-
-	// Set default sender (must be verified domain in MailerSend)
-	senderEmail := os.Getenv("SENDER_EMAIL")
-	if senderEmail == "" {
-		senderEmail = "ITools@petrodata.net"
-	}
-
-	fromEmail = mailersend.From{
-		Name:  "PetroData Portal",
-		Email: senderEmail,
-	}
-}
-
 // ============================================================================
 // CORE MAILER LOGIC
 // ============================================================================
 
-// sendViaMailerSend handles the email sending via MailerSend API
-func sendViaMailerSend(toEmail, subject, html string, ccEmails ...string) error {
-	// Validate recipient
-	if toEmail == "" {
-		return fmt.Errorf("recipient email is required")
-	}
-
-	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	// Build recipient list
-	recipients := []mailersend.Recipient{
-		{
-			Email: toEmail,
-		},
-	}
-
-	// Build CC list if provided
-	var ccRecipients []mailersend.Recipient
-	for _, cc := range ccEmails {
-		if cc != "" {
-			ccRecipients = append(ccRecipients, mailersend.Recipient{Email: cc})
-		}
-	}
-
-	// Create message
-	message := mailerSendClient.Email.NewMessage()
-	message.SetFrom(fromEmail)
-	message.SetRecipients(recipients)
-	message.SetSubject(subject)
-	message.SetHTML(html)
-	message.SetText(stripHTML(html)) // Plain text fallback
-
-	// Add CC if any
-	if len(ccRecipients) > 0 {
-		message.SetCc(ccRecipients)
-	}
-
-	// Add tags for tracking
-	message.SetTags([]string{"leave-request", "petrodata"})
-
-	// Send email
-	res, err := mailerSendClient.Email.Send(ctx, message)
-	if err != nil {
-		return fmt.Errorf("failed to send email to %s: %w", toEmail, err)
-	}
-
-	// Log success (optional - in production use proper logging)
-	fmt.Printf("Email sent successfully to %s. Message ID: %s\n", toEmail, res.Header.Get("X-Message-Id"))
-
-	return nil
-}
-
 // stripHTML removes HTML tags for plain text version (basic implementation)
 func stripHTML(html string) string {
 	text, err := html2text.FromString(html, html2text.Options{
@@ -115,114 +31,174 @@ func stripHTML(html string) string {
 }
 
 // ============================================================================
-// WORKFLOW FUNCTIONS
+// WORKFLOW NOTIFICATIONS
 // ============================================================================
 
-// SendToManager triggers the first approval step (Staff -> Line Manager)
-func SendToManager(email, staffName, token string) error {
-	baseURL := os.Getenv("BASE_URL")
-	if baseURL == "" {
-		baseURL = "https://petrodata-portal.onrender.com"
-	}
+// The functions below compose workflow notifications from the email
+// templates. They are queued in the outbox with the change they announce and
+// delivered by its worker.
 
-	link := fmt.Sprintf("%s/approve.html?token=%s", baseURL, token)
+// Recipient is who a workflow email is addressed to. OnBehalfOf is set when
+// an approval link goes to the delegate of an approver who is away; the
+// principal is copied.
+type Recipient struct {
+	Email      string
+	OnBehalfOf string
+}
 
-	html := fmt.Sprintf(`
-		<div style="font-family: Arial, sans-serif; border: 1px solid #ddd; padding: 20px; border-radius: 8px;">
-			<h2 style="color: #004d40;">Leave Approval Required</h2>
-			<p>A new leave request has been submitted by <strong>%s</strong>.</p>
-			<p>Please review the details and provide your decision by clicking the button below:</p>
-			<div style="margin: 25px 0;">
-				<a href="%s" style="background-color: #004d40; color: white; padding: 12px 25px; text-decoration: none; border-radius: 5px; font-weight: bold;">Review Request</a>
-			</div>
-			<p style="font-size: 11px; color: #888;">This is an automated message from PetroData Portal.</p>
-		</div>`, staffName, link)
+// notification is a workflow email to a single recipient
+func notification(to Recipient, subject, html string) Message {
+	msg := Message{
+		To:      []string{to.Email},
+		Subject: subject,
+		HTML:    html,
+		Tags:    []string{"leave-request", "petrodata"},
+	}
+	if to.OnBehalfOf != "" {
+		msg.Cc = []string{to.OnBehalfOf}
+	}
+	return msg
+}
 
-	return sendViaMailerSend(email, "New Leave Request: "+staffName, html)
+// ManagerRequestEmail asks the line manager to review a new request (Staff -> Line Manager)
+func ManagerRequestEmail(to Recipient, leave models.LeaveRequest, token string) Message {
+	data := leaveEmailData(leave)
+	data.Link = approvalURL(models.LinkManager, token)
+	return renderEmail(to, tmplManagerRequest, data)
 }
 
-// SendToHR notifies the HR manager after the line manager approves (Manager -> HR)
-func SendToHR(email, staffName, token string) error {
-	baseURL := os.Getenv("BASE_URL")
-	if baseURL == "" {
-		baseURL = "https://petrodata-portal.onrender.com"
-	}
+// HRRequestEmail asks the HR manager to review after the line manager approves (Manager -> HR)
+func HRRequestEmail(to Recipient, leave models.LeaveRequest, token string) Message {
+	data := leaveEmailData(leave)
+	data.Link = approvalURL(models.LinkHR, token)
+	return renderEmail(to, tmplHRRequest, data)
+}
+
+// MDRequestEmail asks the Managing Director for the final sign-off (HR -> MD)
+func MDRequestEmail(to Recipient, leave models.LeaveRequest, token string) Message {
+	data := leaveEmailData(leave)
+	data.Link = approvalURL(models.LinkMD, token)
+	return renderEmail(to, tmplMDRequest, data)
+}
 
-	link := fmt.Sprintf("%s/approve_hr.html?resource_token=%s", baseURL, token)
+// StageRequestEmail asks the approver of a stage on a configured approval chain to decide
+func StageRequestEmail(to Recipient, leave models.LeaveRequest, stageName, token string) Message {
+	data := leaveEmailData(leave)
+	data.StageName = stageName
+	data.Link = portalURL("approve_stage.html?stage_token=" + url.QueryEscape(token))
+	return renderEmail(to, tmplStageRequest, data)
+}
 
-	html := fmt.Sprintf(`
-		<div style="font-family: Arial, sans-serif; border: 1px solid #ddd; padding: 20px; border-radius: 8px;">
-			<h2 style="color: #004d40;">Leave Approval Required</h2>
-			<p>A new leave request has been submitted by <strong>%s</strong> and approved by the Line Manager.</p>
-			<p>Please review the details and provide your decision by clicking the button below:</p>
-			<div style="margin: 25px 0;">
-				<a href="%s" style="background-color: #004d40; color: white; padding: 12px 25px; text-decoration: none; border-radius: 5px; font-weight: bold;">Review Request</a>
-			</div>
-			<p style="font-size: 11px; color: #888;">This is an automated message from PetroData Portal.</p>
-		</div>`, staffName, link)
+// ReminderEmail reminds the approver holding a link of purpose that a request
+// has been waiting on them for waiting
+func ReminderEmail(to Recipient, leave models.LeaveRequest, purpose, token string, waiting time.Duration) Message {
+	data := leaveEmailData(leave)
+	data.Link = approvalURL(purpose, token)
+	data.WaitingDays = int(waiting.Hours() / 24)
+	return renderEmail(to, tmplReminder, data)
+}
 
-	return sendViaMailerSend(email, "HR Action Needed - Leave: "+staffName, html)
+// EscalationEmail passes a stalled request to the fallback approver of its step
+func EscalationEmail(to Recipient, leave models.LeaveRequest, purpose, token, previousApprover string, waiting time.Duration) Message {
+	data := leaveEmailData(leave)
+	data.Link = approvalURL(purpose, token)
+	data.WaitingDays = int(waiting.Hours() / 24)
+	data.PreviousApprover = previousApprover
+	return renderEmail(to, tmplEscalation, data)
 }
 
-// SendToMD notifies the Managing Director for the final sign-off (HR -> MD)
-func SendToMD(email, staffName, token string) error {
-	baseURL := os.Getenv("BASE_URL")
-	if baseURL == "" {
-		baseURL = "https://petrodata-portal.onrender.com"
+// approvalURL is the page an approver opens a link of purpose on
+func approvalURL(purpose, token string) string {
+	token = url.QueryEscape(token)
+	switch purpose {
+	case models.LinkHR:
+		return portalURL("approve_hr.html?resource_token=" + token)
+	case models.LinkMD:
+		return portalURL("approve_md.html?director_token=" + token)
+	case models.LinkCancellation:
+		return portalURL("approve_cancellation.html?resource_token=" + token)
 	}
+	return portalURL("approve.html?token=" + token)
+}
 
-	link := fmt.Sprintf("%s/approve_md.html?director_token=%s", baseURL, token)
+// FinalArchiveEmail tells HR that the chain is complete and files are ready (MD -> HR Archive)
+func FinalArchiveEmail(to Recipient, leave models.LeaveRequest, token string) Message {
+	data := leaveEmailData(leave)
+	data.Link = portalURL("final_archive.html?final_token=" + url.QueryEscape(token))
+	return renderEmail(to, tmplFinalArchive, data)
+}
 
-	html := fmt.Sprintf(`
-		<div style="font-family: Arial, sans-serif; border: 1px solid #ddd; padding: 20px; border-radius: 8px;">
-			<h2 style="color: #004d40;">Final Approval Required</h2>
-			<p>A leave request from <strong>%s</strong> has been approved by both the Line Manager and HR.</p>
-			<p>Your final approval is required. Please review by clicking the button below:</p>
-			<div style="margin: 25px 0;">
-				<a href="%s" style="background-color: #004d40; color: white; padding: 12px 25px; text-decoration: none; border-radius: 5px; font-weight: bold;">Review Request</a>
-			</div>
-			<p style="font-size: 11px; color: #888;">This is an automated message from PetroData Portal.</p>
-		</div>`, staffName, link)
+// LeaveRecordEmail carries the archived leave record PDF (staff and HR copies)
+func LeaveRecordEmail(email string, leave models.LeaveRequest, pdf []byte) Message {
+	msg := renderEmail(Recipient{Email: email}, tmplLeaveRecord, leaveEmailData(leave))
+	msg.Attachments = []Attachment{{FileName: "Leave_Record_" + leave.Reference() + ".pdf", ContentType: "application/pdf", Content: pdf}}
+	return msg
+}
 
-	return sendViaMailerSend(email, "Final MD Approval: "+staffName, html)
+// RejectionEmail tells staff their request was rejected at some stage
+func RejectionEmail(leave models.LeaveRequest, rejectedBy, reason string) Message {
+	data := leaveEmailData(leave)
+	data.RejectedBy = rejectedBy
+	data.Reason = reason
+	return renderEmail(Recipient{Email: leave.StaffEmail}, tmplRejection, data)
 }
 
-// SendFinalArchiveToHR notifies HR that the chain is complete and files are ready (MD -> HR Archive)
-func SendFinalArchiveToHR(email, staffName, token string) error {
-	baseURL := os.Getenv("BASE_URL")
-	if baseURL == "" {
-		baseURL = "https://petrodata-portal.onrender.com"
-	}
+// RejectionUnderReviewEmail tells staff their request was rejected and that the MD will review the rejection
+func RejectionUnderReviewEmail(leave models.LeaveRequest, rejectedBy, reason string) Message {
+	data := leaveEmailData(leave)
+	data.RejectedBy = rejectedBy
+	data.Reason = reason
+	data.UnderReview = true
+	return renderEmail(Recipient{Email: leave.StaffEmail}, tmplRejection, data)
+}
 
-	link := fmt.Sprintf("%s/final_archive.html?final_token=%s", baseURL, token)
+// FilingRequestEmail asks HR to file a request the line manager rejected (Manager -> HR)
+func FilingRequestEmail(to Recipient, leave models.LeaveRequest, reason, token string) Message {
+	data := leaveEmailData(leave)
+	data.Reason = reason
+	data.Link = portalURL("file_rejection.html?resource_token=" + url.QueryEscape(token))
+	return renderEmail(to, tmplFilingRequest, data)
+}
+
+// RejectionReviewEmail asks the MD to uphold or overturn a rejection by HR (HR -> MD)
+func RejectionReviewEmail(to Recipient, leave models.LeaveRequest, reason, token string) Message {
+	data := leaveEmailData(leave)
+	data.Reason = reason
+	data.Link = portalURL("review_md.html?director_token=" + url.QueryEscape(token))
+	return renderEmail(to, tmplRejectionReview, data)
+}
+
+// ReturnedEmail tells staff their request was sent back for correction, with the reviewer's comments
+func ReturnedEmail(leave models.LeaveRequest, returnedBy, comments string) Message {
+	data := leaveEmailData(leave)
+	data.ReturnedBy = returnedBy
+	data.Reason = comments
+	return renderEmail(Recipient{Email: leave.StaffEmail}, tmplReturned, data)
+}
+
+// WithdrawalNoticeEmail tells an approver holding a pending link that the staff withdrew the request
+func WithdrawalNoticeEmail(email string, leave models.LeaveRequest) Message {
+	return renderEmail(Recipient{Email: email}, tmplWithdrawalNotice, leaveEmailData(leave))
+}
 
-	html := fmt.Sprintf(`
-		<div style="font-family: Arial, sans-serif; border: 1px solid #ddd; padding: 20px; border-radius: 8px;">
-			<h2 style="color: #004d40;">Workflow Complete</h2>
-			<p>The leave workflow for <strong>%s</strong> is now <strong>Fully Approved</strong>.</p>
-			<p>Click the button below to view and download the final archive for records:</p>
-			<div style="margin: 25px 0;">
-				<a href="%s" style="background-color: #004d40; color: white; padding: 12px 25px; text-decoration: none; border-radius: 5px; font-weight: bold;">Download Archive</a>
-			</div>
-			<p style="font-size: 11px; color: #888;">This is an automated message from PetroData Portal.</p>
-		</div>`, staffName, link)
+// CancellationRequestEmail asks HR to confirm the cancellation of an approved leave
+func CancellationRequestEmail(to Recipient, leave models.LeaveRequest, token string) Message {
+	data := leaveEmailData(leave)
+	data.Link = approvalURL(models.LinkCancellation, token)
+	return renderEmail(to, tmplCancellationRequest, data)
+}
 
-	return sendViaMailerSend(email, "COMPLETED Workflow: "+staffName, html)
+// ApprovalCodeEmail carries the one-time code an approver enters to confirm they own the link's address
+func ApprovalCodeEmail(email, code string) Message {
+	return renderEmail(Recipient{Email: email}, tmplApprovalCode, EmailData{Code: code})
 }
 
-// SendRejectionNotification notifies staff when request is rejected at any stage
-func SendRejectionNotification(staffEmail, staffName, rejectedBy, reason string) error {
-	html := fmt.Sprintf(`
-		<div style="font-family: Arial, sans-serif; border: 1px solid #ddd; padding: 20px; border-radius: 8px;">
-			<h2 style="color: #d32f2f;">Leave Request Update</h2>
-			<p>Hello <strong>%s</strong>,</p>
-			<p>Your leave request has been <strong>declined</strong> by <strong>%s</strong>.</p>
-			<p><strong>Reason:</strong> %s</p>
-			<p>If you have questions, please contact %s directly.</p>
-			<p style="font-size: 11px; color: #888;">This is an automated message from PetroData Portal.</p>
-		</div>`, staffName, rejectedBy, reason, rejectedBy)
-
-	return sendViaMailerSend(staffEmail, "Leave Request Declined: "+staffName, html)
+// CancellationOutcomeEmail tells the staff whether HR confirmed the cancellation of their approved leave
+func CancellationOutcomeEmail(leave models.LeaveRequest, confirmed bool, reason string) Message {
+	data := leaveEmailData(leave)
+	data.Confirmed = confirmed
+	data.Reason = reason
+	return renderEmail(Recipient{Email: leave.StaffEmail}, tmplCancellationOutcome, data)
 }
 
 // ============================================================================
@@ -231,123 +207,57 @@ func SendRejectionNotification(staffEmail, staffName, rejectedBy, reason string)
 
 // SendBulkEmails sends emails to multiple recipients (useful for notifications)
 func SendBulkEmails(recipients []string, subject, html string) error {
-	if len(recipients) == 0 {
-		return fmt.Errorf("no recipients provided")
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	// Build recipient list
-	var to []mailersend.Recipient
+	var to []string
 	for _, email := range recipients {
 		if email != "" {
-			to = append(to, mailersend.Recipient{Email: email})
+			to = append(to, email)
 		}
 	}
+	if len(to) == 0 {
+		return fmt.Errorf("no recipients provided")
+	}
 
-	message := mailerSendClient.Email.NewMessage()
-	message.SetFrom(fromEmail)
-	message.SetRecipients(to)
-	message.SetSubject(subject)
-	message.SetHTML(html)
-	message.SetText(stripHTML(html))
-	message.SetTags([]string{"bulk-notification", "petrodata"})
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
-	res, err := mailerSendClient.Email.Send(ctx, message)
+	messageID, err := Deliver(ctx, Message{
+		To:      to,
+		Subject: subject,
+		HTML:    html,
+		Tags:    []string{"bulk-notification", "petrodata"},
+	})
 	if err != nil {
 		return fmt.Errorf("bulk send failed: %w", err)
 	}
 
-	fmt.Printf("Bulk email sent to %d recipients. Message ID: %s\n", len(to), res.Header.Get("X-Message-Id"))
+	log.Printf("[INFO] Bulk email sent to %d recipients. Message ID: %s", len(to), messageID)
 	return nil
 }
 
 // SendEmailWithAttachment sends email with file attachment (for supporting documents)
 func SendEmailWithAttachment(toEmail, subject, html, filePath, fileName string) error {
-	// Read file
-	file, err := os.Open(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to open attachment: %w", err)
-	}
-	defer file.Close()
-
-	// Get file info for reading
-	stat, err := file.Stat()
-	if err != nil {
-		return fmt.Errorf("failed to stat file: %w", err)
-	}
-
-	// Read file content
-	content := make([]byte, stat.Size())
-	_, err = file.Read(content)
+	content, err := os.ReadFile(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
-	}
-
-	// Encode to base64
-	encoded := make([]byte, base64.StdEncoding.EncodedLen(len(content)))
-	base64.StdEncoding.Encode(encoded, content)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-
-	recipients := []mailersend.Recipient{{Email: toEmail}}
-
-	message := mailerSendClient.Email.NewMessage()
-	message.SetFrom(fromEmail)
-	message.SetRecipients(recipients)
-	message.SetSubject(subject)
-	message.SetHTML(html)
-	message.SetText(stripHTML(html))
-
-	// Add attachment
-	attachment := mailersend.Attachment{
-		Filename:    fileName,
-		Content:     string(encoded),
-		Disposition: "attachment",
+		return fmt.Errorf("failed to read attachment: %w", err)
 	}
-	message.AddAttachment(attachment)
-
-	res, err := mailerSendClient.Email.Send(ctx, message)
-	if err != nil {
-		return fmt.Errorf("failed to send email with attachment: %w", err)
-	}
-
-	fmt.Printf("Email with attachment sent. Message ID: %s\n", res.Header.Get("X-Message-Id"))
-	return nil
+	return SendEmailAttachment(toEmail, subject, html, content, fileName)
 }
 
-// SendEmailWithRawAttachment sends an email using raw bytes instead of a file path
+// SendEmailAttachment sends an email using raw bytes instead of a file path
 func SendEmailAttachment(toEmail, subject, html string, content []byte, fileName string) error {
-	// 1. Encode the raw bytes directly to base64
-	encoded := base64.StdEncoding.EncodeToString(content)
-
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
-	recipients := []mailersend.Recipient{{Email: toEmail}}
-
-	message := mailerSendClient.Email.NewMessage()
-	message.SetFrom(fromEmail)
-	message.SetRecipients(recipients)
-	message.SetSubject(subject)
-	message.SetHTML(html)
-	message.SetText(stripHTML(html))
-
-	// 2. Add attachment using the encoded string
-	attachment := mailersend.Attachment{
-		Filename:    fileName,
-		Content:     encoded,
-		Disposition: "attachment",
-	}
-	message.AddAttachment(attachment)
-
-	res, err := mailerSendClient.Email.Send(ctx, message)
+	messageID, err := Deliver(ctx, Message{
+		To:          []string{toEmail},
+		Subject:     subject,
+		HTML:        html,
+		Attachments: []Attachment{{FileName: fileName, Content: content}},
+	})
 	if err != nil {
-		return fmt.Errorf("failed to send email with raw attachment: %w", err)
+		return fmt.Errorf("failed to send email with attachment: %w", err)
 	}
 
-	log.Printf("[INFO] Email with PDF attachment sent to %s. ID: %s", toEmail, res.Header.Get("X-Message-Id"))
+	log.Printf("[INFO] Email with attachment sent to %s. Message ID: %s", toEmail, messageID)
 	return nil
 }
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultMailDir is where the file transport writes when MAIL_DIR is not set.
+const defaultMailDir = "./mail-outbox"
+
+// fileMailer writes each message as an .eml file instead of sending it, for
+// local development and tests.
+type fileMailer struct {
+	dir string
+}
+
+func newFileMailerFromEnv() (Mailer, error) {
+	dir := os.Getenv("MAIL_DIR")
+	if dir == "" {
+		dir = defaultMailDir
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &fileMailer{dir: dir}, nil
+}
+
+func (m *fileMailer) Send(_ context.Context, from Sender, msg Message) (string, error) {
+	messageID := newMessageID(from)
+	raw, err := buildMIME(from, msg, messageID)
+	if err != nil {
+		return "", err
+	}
+
+	name := time.Now().Format("20060102-150405") + "-" + strings.Trim(messageID, "<>") + ".eml"
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, raw, 0o640); err != nil {
+		return "", err
+	}
+	return messageID, nil
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+
+	"github.com/mailersend/mailersend-go"
+)
+
+// mailerSendMailer sends through the MailerSend API.
+type mailerSendMailer struct {
+	client *mailersend.Mailersend
+}
+
+func newMailerSendFromEnv() (Mailer, error) {
+	apiKey := os.Getenv("MAILER_SEND_API_KEY")
+	if apiKey == "" {
+		return nil, errors.New("MAILER_SEND_API_KEY is required for the mailersend transport")
+	}
+	return &mailerSendMailer{client: mailersend.NewMailersend(apiKey)}, nil
+}
+
+func (m *mailerSendMailer) Send(ctx context.Context, from Sender, msg Message) (string, error) {
+	message := m.client.Email.NewMessage()
+	message.SetFrom(mailersend.From{Name: from.Name, Email: from.Email})
+	message.SetRecipients(mailerSendRecipients(msg.To))
+	if cc := mailerSendRecipients(msg.Cc); len(cc) > 0 {
+		message.SetCc(cc)
+	}
+	message.SetSubject(msg.Subject)
+	message.SetHTML(msg.HTML)
+	message.SetText(msg.Text)
+	if len(msg.Tags) > 0 {
+		message.SetTags(msg.Tags)
+	}
+	for _, a := range msg.Attachments {
+		message.AddAttachment(mailersend.Attachment{
+			Filename:    a.FileName,
+			Content:     base64.StdEncoding.EncodeToString(a.Content),
+			Disposition: "attachment",
+		})
+	}
+
+	res, err := m.client.Email.Send(ctx, message)
+	if err != nil {
+		return "", err
+	}
+	return res.Header.Get("X-Message-Id"), nil
+}
+
+func mailerSendRecipients(emails []string) []mailersend.Recipient {
+	var recipients []mailersend.Recipient
+	for _, email := range emails {
+		if email != "" {
+			recipients = append(recipients, mailersend.Recipient{Email: email})
+		}
+	}
+	return recipients
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/smtp"
+	"os"
+)
+
+// smtpMailer sends through an SMTP server. Port 465 uses implicit TLS; other
+// ports upgrade with STARTTLS when the server offers it.
+type smtpMailer struct {
+	host     string
+	port     string
+	username string
+	password string
+}
+
+func newSMTPFromEnv() (Mailer, error) {
+	m := &smtpMailer{
+		host:     os.Getenv("SMTP_HOST"),
+		port:     os.Getenv("SMTP_PORT"),
+		username: os.Getenv("SMTP_USERNAME"),
+		password: os.Getenv("SMTP_PASSWORD"),
+	}
+	if m.host == "" {
+		return nil, errors.New("SMTP_HOST is required for the smtp transport")
+	}
+	if m.port == "" {
+		m.port = "587"
+	}
+	return m, nil
+}
+
+func (m *smtpMailer) Send(ctx context.Context, from Sender, msg Message) (string, error) {
+	messageID := newMessageID(from)
+	raw, err := buildMIME(from, msg, messageID)
+	if err != nil {
+		return "", err
+	}
+
+	addr := net.JoinHostPort(m.host, m.port)
+	dialer := &net.Dialer{}
+	var conn net.Conn
+	if m.port == "465" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: m.host}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return "", err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return "", err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return "", err
+		}
+	}
+	if m.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return "", err
+		}
+	}
+
+	if err := client.Mail(from.Email); err != nil {
+		return "", err
+	}
+	for _, rcpt := range append(append([]string{}, msg.To...), msg.Cc...) {
+		if rcpt == "" {
+			continue
+		}
+		if err := client.Rcpt(rcpt); err != nil {
+			return "", err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return messageID, client.Quit()
+}
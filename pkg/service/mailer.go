@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// ============================================================================
+// MAIL TRANSPORT
+// ============================================================================
+
+// Message is one outgoing email.
+type Message struct {
+	To          []string
+	Cc          []string
+	Subject     string
+	HTML        string
+	Text        string // Plain text alternative, derived from HTML when empty
+	Tags        []string
+	Attachments []Attachment
+}
+
+// Attachment is a file sent with a Message.
+type Attachment struct {
+	FileName    string
+	ContentType string
+	Content     []byte
+}
+
+// Sender is the address messages are sent from.
+type Sender struct {
+	Name  string
+	Email string
+}
+
+// Mailer delivers messages. Send returns the provider's message ID when the
+// transport has one.
+type Mailer interface {
+	Send(ctx context.Context, from Sender, msg Message) (string, error)
+}
+
+// Transports selectable with MAIL_TRANSPORT
+const (
+	TransportMailerSend = "mailersend"
+	TransportSMTP       = "smtp"
+	TransportFile       = "file"
+)
+
+var (
+	mailer     Mailer
+	sender     Sender
+	mailerOnce sync.Once
+	mailerErr  error
+)
+
+// InitMailer configures the mail transport from the environment and reports
+// a configuration error. It is called once at startup; later calls are no-ops.
+//
+// MAIL_TRANSPORT selects "mailersend" (MAILER_SEND_API_KEY), "smtp"
+// (SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD) or "file" (.eml files
+// written to MAIL_DIR). When unset, MailerSend is used if an API key is
+// configured and the file transport otherwise, so local runs never send mail.
+func InitMailer() error {
+	mailerOnce.Do(func() {
+		sender = Sender{Name: "PetroData Portal", Email: os.Getenv("SENDER_EMAIL")}
+		if sender.Email == "" {
+			sender.Email = "ITools@petrodata.net"
+		}
+		if mailer != nil {
+			return // Set by SetMailer
+		}
+
+		transport := os.Getenv("MAIL_TRANSPORT")
+		if transport == "" {
+			transport = TransportFile
+			if os.Getenv("MAILER_SEND_API_KEY") != "" {
+				transport = TransportMailerSend
+			}
+		}
+
+		switch transport {
+		case TransportMailerSend:
+			mailer, mailerErr = newMailerSendFromEnv()
+		case TransportSMTP:
+			mailer, mailerErr = newSMTPFromEnv()
+		case TransportFile:
+			mailer, mailerErr = newFileMailerFromEnv()
+		default:
+			mailerErr = fmt.Errorf("unknown MAIL_TRANSPORT %q (want mailersend, smtp or file)", transport)
+		}
+		if mailerErr == nil {
+			log.Printf("mail: using the %s transport", transport)
+		}
+	})
+	return mailerErr
+}
+
+// SetMailer replaces the configured transport, for tests and tools. It must be
+// called before the first message is sent.
+func SetMailer(m Mailer) {
+	mailer = m
+}
+
+// Deliver sends msg through the configured transport and returns the
+// provider's message ID.
+func Deliver(ctx context.Context, msg Message) (string, error) {
+	if err := InitMailer(); err != nil {
+		return "", err
+	}
+	if len(msg.To) == 0 || msg.To[0] == "" {
+		return "", fmt.Errorf("recipient email is required")
+	}
+	if msg.Text == "" {
+		msg.Text = stripHTML(msg.HTML)
+	}
+	return mailer.Send(ctx, sender, msg)
+}
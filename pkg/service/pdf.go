@@ -7,17 +7,28 @@ import (
 	"github.com/johnfercher/maroto/v2"
 
 	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"github.com/johnfercher/maroto/v2/pkg/components/code"
 	"github.com/johnfercher/maroto/v2/pkg/components/col"
 	"github.com/johnfercher/maroto/v2/pkg/components/image"
 	"github.com/johnfercher/maroto/v2/pkg/components/row"
 	"github.com/johnfercher/maroto/v2/pkg/components/text"
 	"github.com/johnfercher/maroto/v2/pkg/consts/align"
+	"github.com/johnfercher/maroto/v2/pkg/consts/extension"
 	"github.com/johnfercher/maroto/v2/pkg/consts/fontstyle"
 	"github.com/johnfercher/maroto/v2/pkg/core"
 	"github.com/johnfercher/maroto/v2/pkg/props"
 )
 
-func GenerateLeavePDF(leave models.LeaveRequest) ([]byte, error) {
+// VerificationURL is the public page that confirms the record behind a
+// generated PDF. It is what the QR code on the PDF encodes.
+func VerificationURL(documentID string) string {
+	return portalURL("verify.html?doc=" + documentID)
+}
+
+// GenerateLeavePDF renders the official leave record, including every action
+// in trail (oldest first) under the approval audit trail. The document ID of
+// doc is printed with a QR code linking to its verification page.
+func GenerateLeavePDF(leave models.LeaveRequest, trail []models.ApprovalAction, doc models.LeaveDocument) ([]byte, error) {
 	m := maroto.New()
 
 	// Primary Brand Color: PetroData Green (#004d40)
@@ -46,7 +57,7 @@ func GenerateLeavePDF(leave models.LeaveRequest) ([]byte, error) {
 		sectionHeader("PERSONNEL PROFILE", brandColor),
 		renderDataRow("Staff Name", leave.StaffName, "Staff Number", leave.StaffNo),
 		renderDataRow("Designation", leave.Designation, "Department", leave.Department),
-		renderDataRow("Phone Number", leave.PhoneNumber, "Date Employed", leave.DateEmployed),
+		renderDataRow("Phone Number", leave.PhoneNumber, "Date Employed", leave.DateEmployed.String()),
 	)
 
 	// 3. Leave Particulars
@@ -58,8 +69,9 @@ func GenerateLeavePDF(leave models.LeaveRequest) ([]byte, error) {
 	m.AddRows(
 		sectionHeader("LEAVE PARTICULARS", brandColor),
 		renderDataRow("Leave Type", leave.LeaveType, "Leave Allowance", allowanceStatus),
-		renderDataRow("Total Duration", fmt.Sprintf("%d Working Days", leave.TotalDays), "Relief Staff", leave.ReliefStaff),
-		renderDataRow("Start Date", leave.StartDate, "Resumption Date", leave.ResumptionDate),
+		// TotalDays is computed by the server (weekends and public holidays excluded)
+		renderDataRow("Total Duration", fmt.Sprintf("%d Working Days (excl. public holidays)", leave.TotalDays), "Relief Staff", leave.ReliefStaff),
+		renderDataRow("Start Date", leave.StartDate.String(), "Resumption Date", leave.ResumptionDate.String()),
 		row.New(15).Add(
 			col.New(12).Add(
 				text.New("Contact Address During Leave", props.Text{Size: 7, Color: &props.Color{Red: 100, Green: 100, Blue: 100}}),
@@ -74,12 +86,33 @@ func GenerateLeavePDF(leave models.LeaveRequest) ([]byte, error) {
 		renderDataRow("Line Manager", leave.ManagerDecision, "HR Verification", leave.HRDecision),
 		renderDataRow("MD Final Approval", leave.MDDecision, "Current Status", leave.Status),
 	)
+	signed := false
+	for _, action := range trail {
+		m.AddRows(renderActionRow(action))
+		signed = signed || action.Signature != ""
+	}
 
 	// 5. Footer / Disclaimer
+	disclaimer := "This is a computer-generated document and is valid without a physical signature."
+	if signed {
+		disclaimer = "This is a computer-generated document. Signatures above were captured electronically with each decision."
+	}
+	verifyURL := VerificationURL(doc.DocumentID)
 	m.AddRows(
-		row.New(20), // Spacer
+		row.New(10), // Spacer
+		row.New(28).Add(
+			col.New(9).Add(
+				text.New("DOCUMENT VERIFICATION", props.Text{Size: 8, Style: fontstyle.Bold, Color: brandColor}),
+				text.New("Document ID: "+doc.DocumentID, props.Text{Size: 8, Top: 5}),
+				text.New("Scan the code or visit the address below to confirm this record with PetroData:", props.Text{
+					Size: 7, Top: 11, Color: &props.Color{Red: 100, Green: 100, Blue: 100},
+				}),
+				text.New(verifyURL, props.Text{Size: 7, Top: 16}),
+			),
+			col.New(3).Add(code.NewQr(verifyURL, props.Rect{Percent: 100, Center: true})),
+		),
 		row.New(10).Add(
-			col.New(12).Add(text.New("This is a computer-generated document and is valid without a physical signature.", props.Text{
+			col.New(12).Add(text.New(disclaimer, props.Text{
 				Size: 7, Align: align.Center, Color: &props.Color{Red: 150, Green: 150, Blue: 150},
 			})),
 		),
@@ -101,6 +134,44 @@ func sectionHeader(title string, color *props.Color) core.Row {
 	)
 }
 
+// Helper: One audit trail entry (when / who / what / signature)
+func renderActionRow(a models.ApprovalAction) core.Row {
+	grey := &props.Color{Red: 100, Green: 100, Blue: 100}
+
+	outcome := a.Decision
+	if a.ForwardedTo != "" {
+		outcome += " -> " + a.ForwardedTo
+	}
+	approver := a.Approver
+	if a.OnBehalfOf != "" {
+		approver += " on behalf of " + a.OnBehalfOf
+	}
+	detail := a.Reason
+	if detail == "" {
+		detail = "IP " + a.ClientIP
+	}
+
+	signature := col.New(2)
+	if img, err := a.SignatureImage(); err == nil {
+		signature.Add(image.NewFromBytes(img, extension.Png, props.Rect{Percent: 90, Center: true}))
+	}
+
+	return row.New(16).Add(
+		col.New(3).Add(
+			text.New(a.ActionDate.Format("Jan 02, 2006 15:04"), props.Text{Size: 7, Color: grey}),
+			text.New(a.Stage, props.Text{Size: 8, Top: 4, Style: fontstyle.Bold}),
+		),
+		col.New(4).Add(
+			text.New(approver, props.Text{Size: 7, Color: grey}),
+			text.New(outcome, props.Text{Size: 8, Top: 4, Style: fontstyle.Bold}),
+		),
+		col.New(3).Add(
+			text.New(detail, props.Text{Size: 7, Top: 2}),
+		),
+		signature,
+	)
+}
+
 // Helper: Two-column Data Rows
 func renderDataRow(label1, val1, label2, val2 string) core.Row {
 	if val1 == "" {
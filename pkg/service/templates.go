@@ -0,0 +1,216 @@
+package service
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+)
+
+// ============================================================================
+// EMAIL TEMPLATES
+// ============================================================================
+
+//go:embed templates/email
+var embeddedTemplates embed.FS
+
+// Email templates. Each has an HTML body (<name>.html) and a plain text body
+// with the subject (<name>.txt), rendered inside layout.html and layout.txt.
+const (
+	tmplManagerRequest      = "manager_request"
+	tmplHRRequest           = "hr_request"
+	tmplMDRequest           = "md_request"
+	tmplStageRequest        = "stage_request"
+	tmplFinalArchive        = "final_archive"
+	tmplLeaveRecord         = "leave_record"
+	tmplRejection           = "rejection"
+	tmplReturned            = "returned"
+	tmplFilingRequest       = "filing_request"
+	tmplRejectionReview     = "rejection_review"
+	tmplWithdrawalNotice    = "withdrawal_notice"
+	tmplCancellationRequest = "cancellation_request"
+	tmplCancellationOutcome = "cancellation_outcome"
+	tmplApprovalCode        = "approval_code"
+	tmplReminder            = "reminder"
+	tmplEscalation          = "escalation"
+)
+
+var templateNames = []string{
+	tmplManagerRequest, tmplHRRequest, tmplMDRequest, tmplStageRequest,
+	tmplFinalArchive, tmplLeaveRecord, tmplRejection, tmplReturned, tmplWithdrawalNotice,
+	tmplCancellationRequest, tmplCancellationOutcome, tmplApprovalCode,
+	tmplReminder, tmplEscalation, tmplFilingRequest, tmplRejectionReview,
+}
+
+// EmailData is what email templates can use. The leave fields are empty for
+// emails that are not about a request, such as the approval code.
+type EmailData struct {
+	StaffName      string
+	Reference      string
+	LeaveType      string
+	StartDate      string
+	ResumptionDate string
+	TotalDays      int
+	ReliefStaff    string
+
+	Link        string // Action link, for emails with a button
+	StageName   string // Approval chain stage, for stage requests
+	RejectedBy  string // Who declined, for rejections
+	UnderReview bool   // Whether the MD will review a rejection
+	ReturnedBy  string // Who asked for corrections, for returned requests
+	Reason      string // Reason given with a rejection, return or declined cancellation
+	Confirmed   bool   // Whether HR confirmed a cancellation
+	Code        string // One-time approval code
+
+	WaitingDays      int    // How long a stalled request has waited, for reminders and escalations
+	PreviousApprover string // Who the request waited on, for escalations
+	OnBehalfOf       string // Approver whose delegate receives the email
+}
+
+// emailTemplate is the parsed HTML and plain text bodies of one email.
+type emailTemplate struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+var (
+	defaultTemplates map[string]emailTemplate // Built in
+	templates        map[string]emailTemplate // With HR's overrides
+	templatesOnce    sync.Once
+	templatesErr     error
+)
+
+// LoadEmailTemplates parses the email templates and reports an error in them.
+// It is called once at startup; later calls are no-ops.
+//
+// Templates are built in. HR can override any of them, including the shared
+// layouts, by placing a file of the same name in EMAIL_TEMPLATE_DIR; overrides
+// are read at startup, so a restart picks up changes.
+func LoadEmailTemplates() error {
+	templatesOnce.Do(func() {
+		builtIn, err := fs.Sub(embeddedTemplates, "templates/email")
+		if err != nil {
+			templatesErr = err
+			return
+		}
+		if defaultTemplates, templatesErr = parseTemplates(builtIn); templatesErr != nil {
+			return
+		}
+		templates = defaultTemplates
+
+		dir := os.Getenv("EMAIL_TEMPLATE_DIR")
+		if dir == "" {
+			return
+		}
+		templates, templatesErr = parseTemplates(overlayFS{dir: dir, base: builtIn})
+		if templatesErr != nil {
+			templatesErr = fmt.Errorf("email templates in %s: %w", dir, templatesErr)
+			return
+		}
+		log.Printf("mail: using email templates from %s", dir)
+	})
+	return templatesErr
+}
+
+// parseTemplates parses every email template in fsys.
+func parseTemplates(fsys fs.FS) (map[string]emailTemplate, error) {
+	parsed := make(map[string]emailTemplate, len(templateNames))
+	for _, name := range templateNames {
+		html, err := htmltemplate.ParseFS(fsys, "layout.html", name+".html")
+		if err != nil {
+			return nil, err
+		}
+		text, err := texttemplate.ParseFS(fsys, "layout.txt", name+".txt")
+		if err != nil {
+			return nil, err
+		}
+		parsed[name] = emailTemplate{html: html, text: text}
+	}
+	return parsed, nil
+}
+
+// overlayFS serves files from dir, falling back to base for those not there.
+type overlayFS struct {
+	dir  string
+	base fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	f, err := os.Open(filepath.Join(o.dir, filepath.FromSlash(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return o.base.Open(name)
+	}
+	return f, err
+}
+
+// renderEmail renders template name for data into a notification to to.
+// If an overridden template fails, the built-in one is used instead so the
+// notification still goes out.
+func renderEmail(to Recipient, name string, data EmailData) Message {
+	data.OnBehalfOf = to.OnBehalfOf
+	if err := LoadEmailTemplates(); err != nil {
+		log.Printf("[ERROR] %v", err)
+	}
+	msg, err := executeTemplate(templates[name], to, data)
+	if err != nil {
+		log.Printf("[ERROR] Email template %s failed, using the built-in one: %v", name, err)
+		msg, err = executeTemplate(defaultTemplates[name], to, data)
+		if err != nil {
+			log.Printf("[ERROR] Built-in email template %s failed: %v", name, err)
+		}
+	}
+	return msg
+}
+
+// executeTemplate renders the subject and both bodies of t.
+func executeTemplate(t emailTemplate, to Recipient, data EmailData) (Message, error) {
+	if t.html == nil || t.text == nil {
+		return Message{}, errors.New("template not loaded")
+	}
+	var subject, text, html bytes.Buffer
+	if err := t.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := t.text.ExecuteTemplate(&text, "layout", data); err != nil {
+		return Message{}, err
+	}
+	if err := t.html.ExecuteTemplate(&html, "layout", data); err != nil {
+		return Message{}, err
+	}
+
+	msg := notification(to, strings.TrimSpace(subject.String()), html.String())
+	msg.Text = text.String()
+	return msg, nil
+}
+
+// leaveEmailData fills the leave fields of the template data from leave.
+func leaveEmailData(leave models.LeaveRequest) EmailData {
+	return EmailData{
+		StaffName:      leave.StaffName,
+		Reference:      leave.Reference(),
+		LeaveType:      leave.LeaveType,
+		StartDate:      leave.StartDate.String(),
+		ResumptionDate: leave.ResumptionDate.String(),
+		TotalDays:      leave.TotalDays,
+		ReliefStaff:    leave.ReliefStaff,
+	}
+}
+
+// portalURL is the address of page on the portal, from BASE_URL.
+func portalURL(page string) string {
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "https://petrodata-portal.onrender.com"
+	}
+	return baseURL + "/" + page
+}
@@ -0,0 +1,121 @@
+package signedlink
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testClaims() Claims {
+	return Claims{
+		Nonce:     "5f0c6b9e-8a4e-4c1b-9d55-0d6a1f2f3b7c",
+		RequestID: 42,
+		Purpose:   "manager",
+		Email:     "manager@petrodata.net",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	t.Setenv("LINK_SIGNING_KEY", "test-key")
+	want := testClaims()
+	token := Sign(want)
+
+	if strings.ContainsAny(token, "+/=") {
+		t.Errorf("token %q is not URL safe", token)
+	}
+	got, err := Verify(token)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if got.Nonce != want.Nonce || got.RequestID != want.RequestID || got.Purpose != want.Purpose || got.Email != want.Email {
+		t.Errorf("Verify = %+v, want %+v", got, want)
+	}
+	if !got.ExpiresAt.Equal(want.ExpiresAt.UTC().Truncate(time.Second)) {
+		t.Errorf("ExpiresAt = %v, want %v to the second", got.ExpiresAt, want.ExpiresAt)
+	}
+}
+
+func TestVerifyExpired(t *testing.T) {
+	t.Setenv("LINK_SIGNING_KEY", "test-key")
+	c := testClaims()
+	c.ExpiresAt = time.Now().Add(-time.Minute)
+	if _, err := Verify(Sign(c)); !errors.Is(err, ErrExpired) {
+		t.Errorf("Verify of an expired token = %v, want ErrExpired", err)
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	t.Setenv("LINK_SIGNING_KEY", "test-key")
+	token := Sign(testClaims())
+	payload, sig, _ := strings.Cut(token, ".")
+
+	// Re-encode the claims for another request and keep the old signature
+	forged := testClaims()
+	forged.RequestID = 43
+	raw, _ := json.Marshal(forged)
+	forgedPayload := encoding.EncodeToString(raw)
+
+	flipped := []byte(sig)
+	flipped[0] ^= 1
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"changed claims", forgedPayload + "." + sig},
+		{"changed signature", payload + "." + string(flipped)},
+		{"signature of another token", payload + "." + strings.SplitN(Sign(forged), ".", 2)[1]},
+	}
+	for _, tt := range tests {
+		if _, err := Verify(tt.token); !errors.Is(err, ErrBadSignature) {
+			t.Errorf("%s: Verify = %v, want ErrBadSignature", tt.name, err)
+		}
+	}
+}
+
+func TestVerifyOtherKey(t *testing.T) {
+	t.Setenv("LINK_SIGNING_KEY", "old-key")
+	token := Sign(testClaims())
+	t.Setenv("LINK_SIGNING_KEY", "new-key")
+	if _, err := Verify(token); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Verify after a key change = %v, want ErrBadSignature", err)
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	t.Setenv("LINK_SIGNING_KEY", "test-key")
+	badPayload := "not base64!"
+	tests := []string{
+		"",
+		"5f0c6b9e-8a4e-4c1b-9d55-0d6a1f2f3b7c", // Unsigned legacy token
+		"payload-only.",
+		".signature-only",
+		badPayload + "." + sign(badPayload),
+		encoding.EncodeToString([]byte("not json")) + "." + sign(encoding.EncodeToString([]byte("not json"))),
+	}
+	for _, token := range tests {
+		if _, err := Verify(token); !errors.Is(err, ErrMalformed) {
+			t.Errorf("Verify(%q) = %v, want ErrMalformed", token, err)
+		}
+	}
+}
+
+func TestKeyFallback(t *testing.T) {
+	t.Setenv("LINK_SIGNING_KEY", "")
+	t.Setenv("JWT_SECRET", "jwt-secret")
+	token := Sign(testClaims())
+	if _, err := Verify(token); err != nil {
+		t.Fatalf("Verify with JWT_SECRET: %v", err)
+	}
+	if err := CheckKey(); err != nil {
+		t.Errorf("CheckKey with JWT_SECRET = %v, want nil", err)
+	}
+
+	t.Setenv("JWT_SECRET", "")
+	if err := CheckKey(); !errors.Is(err, ErrNoKey) {
+		t.Errorf("CheckKey with no key = %v, want ErrNoKey", err)
+	}
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/JpUnique/petrodata-leave-project/pkg/models"
+	"gorm.io/gorm"
+)
+
+// Database stores files as rows of the archived_files table, for hosts
+// without a persistent disk.
+type Database struct {
+	db *gorm.DB
+}
+
+// NewDatabase returns a store backed by db.
+func NewDatabase(db *gorm.DB) *Database {
+	return &Database{db: db}
+}
+
+// Put saves data under key. Archived files are written once, so an existing
+// key is an error rather than being overwritten.
+func (d *Database) Put(key string, data []byte) error {
+	return d.db.Create(&models.ArchivedFile{Key: key, Data: data}).Error
+}
+
+// Get loads the file stored under key.
+func (d *Database) Get(key string) ([]byte, error) {
+	var file models.ArchivedFile
+	err := d.db.Where("key = ?", key).First(&file).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	return file.Data, err
+}
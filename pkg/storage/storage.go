@@ -0,0 +1,50 @@
+// Package storage keeps generated leave record PDFs. Backends implement
+// Store; ARCHIVE_BACKEND selects "local" (the default, files under
+// ARCHIVE_DIR) or "database" (rows in the archived_files table). Hosts with
+// an ephemeral disk, such as Render, must use "database".
+package storage
+
+import (
+	"errors"
+	"log"
+	"os"
+
+	"gorm.io/gorm"
+)
+
+// ErrNotFound is returned by Get when nothing is stored under a key.
+var ErrNotFound = errors.New("archived file not found")
+
+// Store saves and loads files by key. Keys are slash-separated relative paths.
+type Store interface {
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error)
+}
+
+// Archive is where final leave records are kept. It is set by Init.
+var Archive Store
+
+// defaultArchiveDir is used by the local backend when ARCHIVE_DIR is not set.
+const defaultArchiveDir = "./archive"
+
+// Init sets Archive from ARCHIVE_BACKEND. db is used by the database backend.
+func Init(db *gorm.DB) {
+	switch backend := os.Getenv("ARCHIVE_BACKEND"); backend {
+	case "", "local":
+		dir := os.Getenv("ARCHIVE_DIR")
+		if dir == "" {
+			dir = defaultArchiveDir
+		}
+		local, err := NewLocal(dir)
+		if err != nil {
+			log.Fatalf("failed to open archive directory: %v", err)
+		}
+		Archive = local
+		log.Printf("archive: storing leave records in %s", dir)
+	case "database":
+		Archive = NewDatabase(db)
+		log.Println("archive: storing leave records in the database")
+	default:
+		log.Fatalf("unknown ARCHIVE_BACKEND %q (want local or database)", backend)
+	}
+}
@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"os"
+	"strings"
+)
+
+// AdminEmails returns the normalized addresses listed in ADMIN_EMAILS
+// (comma separated). Existing accounts with these addresses that match an HR
+// staff record are given the admin role at startup, so that the first
+// administrators can be set up without database access.
+func AdminEmails() []string {
+	var emails []string
+	for _, e := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if e = NormalizeEmail(e); e != "" {
+			emails = append(emails, e)
+		}
+	}
+	return emails
+}
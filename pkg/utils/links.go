@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultLinkTTLDays is how long an emailed approval link stays valid when
+// APPROVAL_LINK_TTL_DAYS is not set.
+const defaultLinkTTLDays = 14
+
+// ApprovalLinkTTL returns how long an emailed approval link stays valid,
+// taken from APPROVAL_LINK_TTL_DAYS.
+func ApprovalLinkTTL() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("APPROVAL_LINK_TTL_DAYS"))
+	if err != nil || days <= 0 {
+		days = defaultLinkTTLDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// ApproverCodeRequired reports whether approvers must confirm their email
+// with a one-time code before a decision is accepted (REQUIRE_APPROVER_CODE).
+func ApproverCodeRequired() bool {
+	required, _ := strconv.ParseBool(os.Getenv("REQUIRE_APPROVER_CODE"))
+	return required
+}
+
+// TrustedProxyHops returns how many reverse proxies in front of the server
+// append to X-Forwarded-For (TRUSTED_PROXY_HOPS). Zero, the default, means the
+// header is ignored and the connection's address is the client's.
+func TrustedProxyHops() int {
+	hops, err := strconv.Atoi(os.Getenv("TRUSTED_PROXY_HOPS"))
+	if err != nil || hops < 0 {
+		return 0
+	}
+	return hops
+}
+
+// Defaults used when REMINDER_AFTER_HOURS or ESCALATE_AFTER_HOURS is not set.
+const (
+	defaultReminderAfterHours = 48
+	defaultEscalateAfterHours = 120
+)
+
+// ReminderAfter returns how long an approval may wait before the approver is
+// reminded, and again between reminders (REMINDER_AFTER_HOURS).
+func ReminderAfter() time.Duration {
+	return hoursFromEnv("REMINDER_AFTER_HOURS", defaultReminderAfterHours)
+}
+
+// EscalateAfter returns how long an approval may wait before it is passed to
+// the fallback approver of its step (ESCALATE_AFTER_HOURS).
+func EscalateAfter() time.Duration {
+	return hoursFromEnv("ESCALATE_AFTER_HOURS", defaultEscalateAfterHours)
+}
+
+// EscalationEmail returns the fallback approver for a workflow step ("manager",
+// "hr" or "md") from ESCALATION_<STEP>_EMAIL, or "" if none is configured.
+func EscalationEmail(step string) string {
+	return NormalizeEmail(os.Getenv("ESCALATION_" + strings.ToUpper(step) + "_EMAIL"))
+}
+
+func hoursFromEnv(key string, fallback int) time.Duration {
+	hours, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || hours <= 0 {
+		hours = fallback
+	}
+	return time.Duration(hours) * time.Hour
+}
@@ -0,0 +1,234 @@
+// Package workflow defines the leave request approval state machine.
+// Every status change made by an approver goes through Transition, which checks
+// the move against a fixed table of allowed transitions per actor.
+package workflow
+
+import (
+	"errors"
+	"fmt"
+)
+
+// State is the status of a leave request as stored in LeaveRequest.Status.
+type State string
+
+// Leave request states
+const (
+	StatePending           State = "Pending"
+	StatePendingHRReview   State = "Pending HR Review"
+	StatePendingMDApproval State = "Pending MD Final Approval"
+	StateRejectedByManager State = "Rejected by Manager - Pending HR Filing"
+	StateRejectedByHR      State = "Rejected by HR - Pending MD Review"
+	StateRejectedByMD      State = "Rejected by MD"
+	StateRejectionFiled    State = "Rejected by Manager - Filed by HR"
+	StateRejectionUpheld   State = "Rejected by HR - Upheld by MD"
+	StateFullyApproved     State = "Fully Approved"
+
+	// States used by requests routed through a configured approval chain.
+	// The stage awaiting action is tracked on the request itself.
+	StatePendingStage State = "Pending Stage Approval"
+	StateRejected     State = "Rejected"
+
+	// States reached when the staff member withdraws a request. Approved leave
+	// is only cancelled once HR confirms it.
+	StateCancelled             State = "Cancelled"
+	StateCancellationRequested State = "Cancellation Requested"
+
+	// States of a request sent back to the staff member for correction. Each
+	// remembers the step that returned it, where the amended request re-enters.
+	StateReturnedByManager State = "Returned by Manager for Correction"
+	StateReturnedByHR      State = "Returned by HR for Correction"
+	StateReturnedByMD      State = "Returned by MD for Correction"
+)
+
+// Actor identifies who is acting on a request.
+type Actor string
+
+// Workflow actors
+const (
+	ActorLineManager Actor = "Line Manager"
+	ActorHR          Actor = "HR"
+	ActorMD          Actor = "MD"
+
+	// ActorStageApprover is the approver of the current stage of a configured chain.
+	ActorStageApprover Actor = "Stage Approver"
+
+	// ActorStaff is the staff member who submitted the request.
+	ActorStaff Actor = "Staff"
+)
+
+// Decision is the outcome an actor submits for a request.
+type Decision string
+
+// Approver decisions
+const (
+	DecisionApproved Decision = "Approved"
+	DecisionRejected Decision = "Rejected"
+
+	// DecisionReturned sends the request back to the staff member to correct.
+	DecisionReturned Decision = "Returned for Correction"
+
+	// DecisionWithdrawn is recorded by the staff member cancelling their own request.
+	DecisionWithdrawn Decision = "Withdrawn"
+
+	// DecisionFiled is recorded by HR filing a request the line manager rejected.
+	DecisionFiled Decision = "Filed"
+
+	// DecisionOverturned and DecisionUpheld are the MD's review of an HR rejection.
+	DecisionOverturned Decision = "Overturned"
+	DecisionUpheld     Decision = "Upheld"
+
+	// DecisionResubmitted is recorded by the staff member amending a returned request.
+	DecisionResubmitted Decision = "Resubmitted"
+
+	// DecisionCancellationConfirmed and DecisionCancellationDeclined are HR's
+	// answer to the cancellation of approved leave. They are distinct from HR's
+	// review decisions so a link for one cannot decide the other.
+	DecisionCancellationConfirmed Decision = "Cancellation Confirmed"
+	DecisionCancellationDeclined  Decision = "Cancellation Declined"
+)
+
+// ErrIllegalTransition is returned when an actor attempts a move that is not
+// allowed from the request's current state.
+var ErrIllegalTransition = errors.New("illegal workflow transition")
+
+// ErrUnknownDecision is returned by ParseDecision for unrecognised input.
+var ErrUnknownDecision = errors.New("unknown decision")
+
+// TransitionError describes a rejected transition. It matches
+// ErrIllegalTransition with errors.Is.
+type TransitionError struct {
+	From     State
+	Actor    Actor
+	Decision Decision
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("%s cannot record %q on a request that is %q", e.Actor, e.Decision, e.From)
+}
+
+// Is reports whether target is ErrIllegalTransition.
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrIllegalTransition
+}
+
+type transitionKey struct {
+	from     State
+	actor    Actor
+	decision Decision
+}
+
+// transitions is the complete table of allowed moves.
+var transitions = map[transitionKey]State{
+	{StatePending, ActorLineManager, DecisionApproved}: StatePendingHRReview,
+	{StatePending, ActorLineManager, DecisionRejected}: StateRejectedByManager,
+	{StatePending, ActorLineManager, DecisionReturned}: StateReturnedByManager,
+
+	{StateRejectedByManager, ActorHR, DecisionFiled}: StateRejectionFiled,
+
+	{StatePendingHRReview, ActorHR, DecisionApproved}: StatePendingMDApproval,
+	{StatePendingHRReview, ActorHR, DecisionRejected}: StateRejectedByHR,
+	{StatePendingHRReview, ActorHR, DecisionReturned}: StateReturnedByHR,
+
+	{StateRejectedByHR, ActorMD, DecisionOverturned}: StateFullyApproved,
+	{StateRejectedByHR, ActorMD, DecisionUpheld}:     StateRejectionUpheld,
+
+	{StatePendingMDApproval, ActorMD, DecisionApproved}: StateFullyApproved,
+	{StatePendingMDApproval, ActorMD, DecisionRejected}: StateRejectedByMD,
+	{StatePendingMDApproval, ActorMD, DecisionReturned}: StateReturnedByMD,
+
+	{StatePendingStage, ActorStageApprover, DecisionApproved}: StatePendingStage,
+	{StatePendingStage, ActorStageApprover, DecisionRejected}: StateRejected,
+
+	{StatePending, ActorStaff, DecisionWithdrawn}:           StateCancelled,
+	{StatePendingHRReview, ActorStaff, DecisionWithdrawn}:   StateCancelled,
+	{StatePendingMDApproval, ActorStaff, DecisionWithdrawn}: StateCancelled,
+	{StatePendingStage, ActorStaff, DecisionWithdrawn}:      StateCancelled,
+	{StateFullyApproved, ActorStaff, DecisionWithdrawn}:     StateCancellationRequested,
+	{StateReturnedByManager, ActorStaff, DecisionWithdrawn}: StateCancelled,
+	{StateReturnedByHR, ActorStaff, DecisionWithdrawn}:      StateCancelled,
+	{StateReturnedByMD, ActorStaff, DecisionWithdrawn}:      StateCancelled,
+
+	{StateReturnedByManager, ActorStaff, DecisionResubmitted}: StatePending,
+	{StateReturnedByHR, ActorStaff, DecisionResubmitted}:      StatePendingHRReview,
+	{StateReturnedByMD, ActorStaff, DecisionResubmitted}:      StatePendingMDApproval,
+
+	{StateCancellationRequested, ActorHR, DecisionCancellationConfirmed}: StateCancelled,
+	{StateCancellationRequested, ActorHR, DecisionCancellationDeclined}:  StateFullyApproved,
+}
+
+// Transition returns the state reached when actor records decision on a
+// request currently in from. It returns a *TransitionError if the move is not
+// in the transition table.
+func Transition(from State, actor Actor, decision Decision) (State, error) {
+	to, ok := transitions[transitionKey{from, actor, decision}]
+	if !ok {
+		return from, &TransitionError{From: from, Actor: actor, Decision: decision}
+	}
+	return to, nil
+}
+
+// TransitionStage is Transition for a request on a configured approval chain.
+// Approving the last stage completes the request.
+func TransitionStage(from State, decision Decision, last bool) (State, error) {
+	next, err := Transition(from, ActorStageApprover, decision)
+	if err == nil && last && next == StatePendingStage {
+		next = StateFullyApproved
+	}
+	return next, err
+}
+
+// IsPending reports whether the request is still awaiting an approver.
+func (s State) IsPending() bool {
+	switch s {
+	case StatePending, StatePendingHRReview, StatePendingMDApproval, StatePendingStage:
+		return true
+	}
+	return false
+}
+
+// IsReturned reports whether the request is with the staff member for correction.
+func (s State) IsReturned() bool {
+	switch s {
+	case StateReturnedByManager, StateReturnedByHR, StateReturnedByMD:
+		return true
+	}
+	return false
+}
+
+// IsRejected reports whether the request was turned down at any stage.
+func (s State) IsRejected() bool {
+	switch s {
+	case StateRejectedByManager, StateRejectedByHR, StateRejectedByMD, StateRejected,
+		StateRejectionFiled, StateRejectionUpheld:
+		return true
+	}
+	return false
+}
+
+// InactiveStates returns the states in which a request no longer holds its
+// dates, e.g. for overlap and coverage checks.
+func InactiveStates() []State {
+	return []State{
+		StateRejectedByManager, StateRejectedByHR, StateRejectedByMD, StateRejected,
+		StateRejectionFiled, StateRejectionUpheld, StateCancelled,
+	}
+}
+
+// CanAct reports whether actor has any allowed decision from state.
+func CanAct(from State, actor Actor) bool {
+	for key := range transitions {
+		if key.from == from && key.actor == actor {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseDecision converts the status string posted by an approval page into a Decision.
+func ParseDecision(s string) (Decision, error) {
+	switch d := Decision(s); d {
+	case DecisionApproved, DecisionRejected, DecisionReturned:
+		return d, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownDecision, s)
+}
@@ -0,0 +1,231 @@
+package workflow
+
+import (
+	"errors"
+	"testing"
+)
+
+var (
+	allStates = []State{
+		StatePending, StatePendingHRReview, StatePendingMDApproval,
+		StateRejectedByManager, StateRejectedByHR, StateRejectedByMD,
+		StateRejectionFiled, StateRejectionUpheld, StateFullyApproved,
+		StatePendingStage, StateRejected, StateCancelled, StateCancellationRequested,
+		StateReturnedByManager, StateReturnedByHR, StateReturnedByMD,
+	}
+	allActors = []Actor{
+		ActorLineManager, ActorHR, ActorMD, ActorStageApprover, ActorStaff,
+	}
+	allDecisions = []Decision{
+		DecisionApproved, DecisionRejected, DecisionReturned, DecisionWithdrawn,
+		DecisionFiled, DecisionOverturned, DecisionUpheld, DecisionResubmitted,
+		DecisionCancellationConfirmed, DecisionCancellationDeclined,
+	}
+)
+
+// legalEdges lists every move the workflow allows, written out independently
+// of the transitions table so a change to either shows up here.
+var legalEdges = []struct {
+	from     State
+	actor    Actor
+	decision Decision
+	to       State
+}{
+	{StatePending, ActorLineManager, DecisionApproved, StatePendingHRReview},
+	{StatePending, ActorLineManager, DecisionRejected, StateRejectedByManager},
+	{StatePending, ActorLineManager, DecisionReturned, StateReturnedByManager},
+
+	{StateRejectedByManager, ActorHR, DecisionFiled, StateRejectionFiled},
+
+	{StatePendingHRReview, ActorHR, DecisionApproved, StatePendingMDApproval},
+	{StatePendingHRReview, ActorHR, DecisionRejected, StateRejectedByHR},
+	{StatePendingHRReview, ActorHR, DecisionReturned, StateReturnedByHR},
+
+	{StateRejectedByHR, ActorMD, DecisionOverturned, StateFullyApproved},
+	{StateRejectedByHR, ActorMD, DecisionUpheld, StateRejectionUpheld},
+
+	{StatePendingMDApproval, ActorMD, DecisionApproved, StateFullyApproved},
+	{StatePendingMDApproval, ActorMD, DecisionRejected, StateRejectedByMD},
+	{StatePendingMDApproval, ActorMD, DecisionReturned, StateReturnedByMD},
+
+	{StatePendingStage, ActorStageApprover, DecisionApproved, StatePendingStage},
+	{StatePendingStage, ActorStageApprover, DecisionRejected, StateRejected},
+
+	{StatePending, ActorStaff, DecisionWithdrawn, StateCancelled},
+	{StatePendingHRReview, ActorStaff, DecisionWithdrawn, StateCancelled},
+	{StatePendingMDApproval, ActorStaff, DecisionWithdrawn, StateCancelled},
+	{StatePendingStage, ActorStaff, DecisionWithdrawn, StateCancelled},
+	{StateFullyApproved, ActorStaff, DecisionWithdrawn, StateCancellationRequested},
+	{StateReturnedByManager, ActorStaff, DecisionWithdrawn, StateCancelled},
+	{StateReturnedByHR, ActorStaff, DecisionWithdrawn, StateCancelled},
+	{StateReturnedByMD, ActorStaff, DecisionWithdrawn, StateCancelled},
+
+	{StateReturnedByManager, ActorStaff, DecisionResubmitted, StatePending},
+	{StateReturnedByHR, ActorStaff, DecisionResubmitted, StatePendingHRReview},
+	{StateReturnedByMD, ActorStaff, DecisionResubmitted, StatePendingMDApproval},
+
+	{StateCancellationRequested, ActorHR, DecisionCancellationConfirmed, StateCancelled},
+	{StateCancellationRequested, ActorHR, DecisionCancellationDeclined, StateFullyApproved},
+}
+
+func TestTransitionLegalEdges(t *testing.T) {
+	for _, e := range legalEdges {
+		got, err := Transition(e.from, e.actor, e.decision)
+		if err != nil {
+			t.Errorf("Transition(%q, %q, %q) returned error: %v", e.from, e.actor, e.decision, err)
+			continue
+		}
+		if got != e.to {
+			t.Errorf("Transition(%q, %q, %q) = %q, want %q", e.from, e.actor, e.decision, got, e.to)
+		}
+	}
+}
+
+// TestTransitionIllegalCombinations tries every (state, actor, decision)
+// combination not listed as legal and expects each to be refused.
+func TestTransitionIllegalCombinations(t *testing.T) {
+	legal := make(map[transitionKey]bool, len(legalEdges))
+	for _, e := range legalEdges {
+		legal[transitionKey{e.from, e.actor, e.decision}] = true
+	}
+
+	for _, from := range allStates {
+		for _, actor := range allActors {
+			for _, decision := range allDecisions {
+				if legal[transitionKey{from, actor, decision}] {
+					continue
+				}
+				got, err := Transition(from, actor, decision)
+				if err == nil {
+					t.Errorf("Transition(%q, %q, %q) = %q, want an illegal transition", from, actor, decision, got)
+					continue
+				}
+				if !errors.Is(err, ErrIllegalTransition) {
+					t.Errorf("Transition(%q, %q, %q) error %v does not match ErrIllegalTransition", from, actor, decision, err)
+				}
+				var te *TransitionError
+				if !errors.As(err, &te) || te.From != from || te.Actor != actor || te.Decision != decision {
+					t.Errorf("Transition(%q, %q, %q) error %#v does not describe the move", from, actor, decision, err)
+				}
+				if got != from {
+					t.Errorf("Transition(%q, %q, %q) = %q on error, want the unchanged state", from, actor, decision, got)
+				}
+			}
+		}
+	}
+}
+
+func TestTransitionTableMatchesLegalEdges(t *testing.T) {
+	if len(transitions) != len(legalEdges) {
+		t.Errorf("transitions has %d entries, legalEdges lists %d", len(transitions), len(legalEdges))
+	}
+}
+
+// TestHRReviewAndCancellationDoNotOverlap guards against an HR review link
+// deciding a cancellation and the reverse, which share the HR actor.
+func TestHRReviewAndCancellationDoNotOverlap(t *testing.T) {
+	tests := []struct {
+		from     State
+		decision Decision
+	}{
+		{StateCancellationRequested, DecisionApproved},
+		{StateCancellationRequested, DecisionRejected},
+		{StateCancellationRequested, DecisionReturned},
+		{StatePendingHRReview, DecisionCancellationConfirmed},
+		{StatePendingHRReview, DecisionCancellationDeclined},
+		{StateRejectedByManager, DecisionApproved},
+		{StateRejectedByManager, DecisionRejected},
+	}
+	for _, tt := range tests {
+		if got, err := Transition(tt.from, ActorHR, tt.decision); err == nil {
+			t.Errorf("HR %q on %q moved the request to %q", tt.decision, tt.from, got)
+		}
+	}
+}
+
+func TestTransitionStage(t *testing.T) {
+	tests := []struct {
+		name     string
+		decision Decision
+		last     bool
+		want     State
+		wantErr  bool
+	}{
+		{"approve middle stage", DecisionApproved, false, StatePendingStage, false},
+		{"approve last stage", DecisionApproved, true, StateFullyApproved, false},
+		{"reject middle stage", DecisionRejected, false, StateRejected, false},
+		{"reject last stage", DecisionRejected, true, StateRejected, false},
+		{"return is not a stage decision", DecisionReturned, false, StatePendingStage, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TransitionStage(StatePendingStage, tt.decision, tt.last)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TransitionStage error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("TransitionStage = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDecision(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Decision
+		wantErr bool
+	}{
+		{"Approved", DecisionApproved, false},
+		{"Rejected", DecisionRejected, false},
+		{"Returned for Correction", DecisionReturned, false},
+		{"approved", "", true},
+		{"", "", true},
+		{"Withdrawn", "", true},
+		{"Filed", "", true},
+		{"Overturned", "", true},
+		{"Cancellation Confirmed", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDecision(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDecision(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err != nil && !errors.Is(err, ErrUnknownDecision) {
+			t.Errorf("ParseDecision(%q) error %v does not match ErrUnknownDecision", tt.in, err)
+		}
+		if got != tt.want {
+			t.Errorf("ParseDecision(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestStatePredicates(t *testing.T) {
+	inactive := make(map[State]bool)
+	for _, s := range InactiveStates() {
+		inactive[s] = true
+	}
+	for _, s := range allStates {
+		if s.IsPending() && (s.IsRejected() || s.IsReturned() || inactive[s]) {
+			t.Errorf("%q is pending and also rejected, returned or inactive", s)
+		}
+		if s.IsRejected() && !inactive[s] {
+			t.Errorf("rejected state %q still holds its dates", s)
+		}
+	}
+	if !inactive[StateCancelled] {
+		t.Errorf("%q should not hold its dates", StateCancelled)
+	}
+}
+
+func TestCanAct(t *testing.T) {
+	for _, e := range legalEdges {
+		if !CanAct(e.from, e.actor) {
+			t.Errorf("CanAct(%q, %q) = false, want true", e.from, e.actor)
+		}
+	}
+	if CanAct(StateFullyApproved, ActorMD) {
+		t.Errorf("CanAct(%q, %q) = true, want false", StateFullyApproved, ActorMD)
+	}
+}
@@ -0,0 +1,167 @@
+/**
+ * amend-handler.js - PetroData Leave Portal
+ * Lists the staff member's requests returned for correction and resubmits them
+ */
+
+document.addEventListener("DOMContentLoaded", () => {
+  const section = document.getElementById("returnedRequests");
+  const list = document.getElementById("returnedList");
+  const token = localStorage.getItem(CONFIG.STORAGE.AUTH_TOKEN);
+  if (!section || !list || !token) return;
+
+  const RETURNED_PREFIX = "Returned by ";
+
+  let holidays = new Set();
+  const thisYear = new Date().getFullYear();
+  Utils.loadHolidays([thisYear, thisYear + 1]).then((set) => {
+    holidays = set;
+  });
+
+  const authHeaders = () => ({
+    "Content-Type": "application/json",
+    Authorization: `Bearer ${token}`,
+  });
+
+  // The approver who returned the request and their comment, when recorded
+  const returnReason = (request) => {
+    const stage = (request.stages || []).find((s) => s.reason);
+    return stage ? stage.reason : "";
+  };
+
+  const renderItem = (request) => {
+    const item = document.createElement("li");
+    item.className = "returned-item";
+
+    const details = document.createElement("div");
+    const title = document.createElement("strong");
+    title.textContent = `${request.reference} · ${request.leave_type} Leave`;
+    const status = document.createElement("small");
+    status.textContent = `${request.status} · ${request.start_date} to ${request.resumption_date}`;
+    details.append(title, status);
+
+    const reason = returnReason(request);
+    if (reason) {
+      const comment = document.createElement("small");
+      comment.textContent = `"${reason}"`;
+      details.append(comment);
+    }
+
+    const button = document.createElement("button");
+    button.type = "button";
+    button.className = "btn-amend";
+    button.innerHTML = '<i class="fas fa-edit" aria-hidden="true"></i> Amend';
+    button.addEventListener("click", () => openAmendForm(request));
+
+    item.append(details, button);
+    return item;
+  };
+
+  const loadReturnedRequests = async () => {
+    try {
+      const response = await fetch("/api/leave/my-requests", {
+        headers: authHeaders(),
+      });
+      if (!response.ok) throw new Error(`status ${response.status}`);
+      const requests = await response.json();
+      const returned = requests.filter((r) =>
+        (r.status || "").startsWith(RETURNED_PREFIX),
+      );
+
+      list.replaceChildren(...returned.map(renderItem));
+      section.hidden = returned.length === 0;
+    } catch (error) {
+      console.warn("Could not load returned requests:", error);
+    }
+  };
+
+  const openAmendForm = async (request) => {
+    const { value: changes } = await Swal.fire({
+      title: `Amend ${request.reference}`,
+      html: `
+        <label for="amendStart">Commencement Date</label>
+        <input type="date" id="amendStart" class="swal2-input">
+        <label for="amendResumption">Resumption Date</label>
+        <input type="date" id="amendResumption" class="swal2-input">
+        <input type="text" id="amendRelief" class="swal2-input" placeholder="Relief Staff Name">
+        <input type="text" id="amendContact" class="swal2-input" placeholder="Contact Address">
+        <textarea id="amendNote" class="swal2-textarea" placeholder="What did you change?"></textarea>`,
+      showCancelButton: true,
+      confirmButtonText: "Resubmit",
+      confirmButtonColor: "#004d40",
+      focusConfirm: false,
+      didOpen: () => {
+        document.getElementById("amendStart").value = request.start_date || "";
+        document.getElementById("amendResumption").value =
+          request.resumption_date || "";
+        document.getElementById("amendRelief").value =
+          request.relief_staff || "";
+        document.getElementById("amendContact").value =
+          request.contact_address || "";
+      },
+      preConfirm: () => {
+        const start = document.getElementById("amendStart").value;
+        const resumption = document.getElementById("amendResumption").value;
+        const note = document.getElementById("amendNote").value.trim();
+        const days = Utils.calculateLeaveDays(start, resumption, holidays);
+
+        if (days <= 0) {
+          Swal.showValidationMessage(
+            "Resumption date must be after commencement date.",
+          );
+          return false;
+        }
+        if (!note) {
+          Swal.showValidationMessage(
+            "Please describe what you changed for the approver.",
+          );
+          return false;
+        }
+        return {
+          start_date: start,
+          resumption_date: resumption,
+          total_days: days,
+          relief_staff: document.getElementById("amendRelief").value.trim(),
+          contact_address: document.getElementById("amendContact").value.trim(),
+          note,
+        };
+      },
+    });
+    if (!changes) return;
+
+    try {
+      const response = await fetch("/api/leave/amend", {
+        method: "POST",
+        headers: authHeaders(),
+        body: JSON.stringify({ id: request.id, ...changes }),
+      });
+      const result = await response.json().catch(() => ({}));
+
+      if (response.status === 401) {
+        localStorage.removeItem(CONFIG.STORAGE.AUTH_TOKEN);
+        window.location.href = "login.html";
+        return;
+      }
+      if (!response.ok) {
+        throw new Error(result.error || "Resubmission failed.");
+      }
+
+      Swal.fire({
+        title: "Request Resubmitted!",
+        text: result.message || "Your amended request has been sent back for review.",
+        icon: "success",
+        confirmButtonColor: "#004d40",
+      });
+      loadReturnedRequests();
+    } catch (error) {
+      console.error("Amendment Error:", error);
+      Swal.fire({
+        title: "Resubmission Blocked",
+        text: error.message,
+        icon: "warning",
+        confirmButtonColor: "#b71c1c",
+      });
+    }
+  };
+
+  loadReturnedRequests();
+});
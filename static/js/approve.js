@@ -15,6 +15,7 @@ const CONFIG = {
     PENDING: "Pending",
     APPROVED: "Approved",
     REJECTED: "Rejected",
+    RETURNED: "Returned for Correction",
   },
   COLORS: {
     SUCCESS: "#00c853",
@@ -29,6 +30,9 @@ const CONFIG = {
       "Please provide a valid HR Manager email to forward this request.",
     EMAIL_INVALID: "Email must be valid (contain @).",
     ACTION_FAILED: "Failed to update the request status on the server.",
+    SIGNATURE_REQUIRED: "Please draw or type your signature before approving.",
+    REASON_REQUIRED: "Please provide a reason for the rejection.",
+    CORRECTION_REQUIRED: "Please say what the staff member needs to correct.",
   },
 };
 
@@ -163,6 +167,7 @@ function populateUI(data) {
     if (hrEmailContainer) {
       hrEmailContainer.classList.add("hidden");
     }
+    hideSignaturePad();
 
     if (statusMessage) {
       statusMessage.classList.remove("hidden");
@@ -177,15 +182,16 @@ function populateUI(data) {
 // ============================================================================
 
 /**
- * Setup approve/reject button listeners
+ * Setup approve/reject/return button listeners
  * @param {string} token - Request token
  * @param {string} staffName - Staff member name
  */
 function setupActionButtons(token, staffName) {
   const approveBtn = getElement("approveBtn");
   const rejectBtn = getElement("rejectBtn");
+  const returnBtn = getElement("returnBtn");
 
-  if (!approveBtn || !rejectBtn) {
+  if (!approveBtn || !rejectBtn || !returnBtn) {
     console.error("Action buttons not found in DOM");
     return;
   }
@@ -197,6 +203,10 @@ function setupActionButtons(token, staffName) {
   rejectBtn.addEventListener("click", () =>
     processDecision(token, CONFIG.STATUS.REJECTED, staffName),
   );
+
+  returnBtn.addEventListener("click", () =>
+    processDecision(token, CONFIG.STATUS.RETURNED, staffName),
+  );
 }
 
 /**
@@ -214,11 +224,17 @@ document.addEventListener("DOMContentLoaded", async () => {
     const response = await fetch(`${CONFIG.API.FETCH_DETAILS}?token=${token}`);
 
     if (!response.ok) {
-      throw new Error(CONFIG.MESSAGES.FETCH_ERROR);
+      // 410: the link was already used, replaced by a newer one or has expired
+      const body = await response.json().catch(() => ({}));
+      throw new Error(
+        response.status === 410 ? body.error : CONFIG.MESSAGES.FETCH_ERROR,
+      );
     }
 
     const data = await response.json();
     populateUI(data);
+    showReviewWarnings(data);
+    setupApproverCode(data);
     setupActionButtons(token, data.staff_name);
   } catch (error) {
     console.error("Fetch Error:", error);
@@ -231,9 +247,9 @@ document.addEventListener("DOMContentLoaded", async () => {
 // ============================================================================
 
 /**
- * Process approval/rejection decision
+ * Process approval/rejection/return decision
  * @param {string} token - Request token
- * @param {string} decision - 'Approved' or 'Rejected'
+ * @param {string} decision - 'Approved', 'Rejected' or 'Returned for Correction'
  * @param {string} staffName - Staff member name
  */
 async function processDecision(token, decision, staffName) {
@@ -253,8 +269,10 @@ async function processDecision(token, decision, staffName) {
   }
 
   const hrEmail = hrEmailInput.value.trim();
+  const isReturn = decision === CONFIG.STATUS.RETURNED;
 
-  if (!hrEmail) {
+  // A returned request goes back to the staff, not on to HR
+  if (!isReturn && !hrEmail) {
     Swal.fire({
       title: "Required",
       text: CONFIG.MESSAGES.EMAIL_REQUIRED,
@@ -264,7 +282,7 @@ async function processDecision(token, decision, staffName) {
     return;
   }
 
-  if (!isValidEmail(hrEmail)) {
+  if (!isReturn && !isValidEmail(hrEmail)) {
     Swal.fire({
       title: "Invalid Email",
       text: CONFIG.MESSAGES.EMAIL_INVALID,
@@ -274,30 +292,63 @@ async function processDecision(token, decision, staffName) {
     return;
   }
 
-  // Confirm decision
+  const signature = getSignature();
+  if (decision === CONFIG.STATUS.APPROVED && !signature) {
+    Swal.fire({
+      title: "Signature Required",
+      text: CONFIG.MESSAGES.SIGNATURE_REQUIRED,
+      icon: "warning",
+      confirmButtonColor: CONFIG.COLORS.PRIMARY,
+    });
+    return;
+  }
+
+  // Confirm decision; rejections and returns need a comment for the staff
+  const isApprove = decision === CONFIG.STATUS.APPROVED;
   const confirmResult = await Swal.fire({
     title: `Confirm ${decision}?`,
-    text: `Are you sure you want to ${decision.toLowerCase()} the request for ${staffName} and forward it to HR?`,
+    text: isReturn
+      ? `The request will go back to ${staffName} to correct and resubmit.`
+      : `Are you sure you want to ${decision.toLowerCase()} the request for ${staffName} and forward it to HR?`,
     icon: "question",
+    input: isApprove ? undefined : "textarea",
+    inputPlaceholder: isReturn
+      ? "What needs to be corrected"
+      : "Reason for rejection",
+    inputValidator: (value) => {
+      if (isApprove || value.trim()) return undefined;
+      return isReturn
+        ? CONFIG.MESSAGES.CORRECTION_REQUIRED
+        : CONFIG.MESSAGES.REASON_REQUIRED;
+    },
     showCancelButton: true,
-    confirmButtonColor:
-      decision === CONFIG.STATUS.APPROVED
-        ? CONFIG.COLORS.SUCCESS
-        : CONFIG.COLORS.ERROR,
+    confirmButtonColor: isApprove
+      ? CONFIG.COLORS.SUCCESS
+      : CONFIG.COLORS.ERROR,
     cancelButtonColor: CONFIG.COLORS.NEUTRAL,
-    confirmButtonText: `Yes, ${decision}!`,
+    confirmButtonText: isReturn ? "Yes, Return" : `Yes, ${decision}!`,
   });
 
   if (!confirmResult.isConfirmed) {
     return;
   }
+  const reason = isApprove ? "" : confirmResult.value.trim();
+
+  const code = await confirmApproverCode(token).catch((error) => {
+    showError(error.message);
+    return null;
+  });
+  if (code === null) return;
 
   // Submit decision to backend
   try {
     const payload = {
       token,
       status: decision,
-      resource_email: hrEmail,
+      resource_email: isReturn ? "" : hrEmail,
+      reason,
+      code,
+      signature,
     };
 
     const response = await fetch(CONFIG.API.SUBMIT_ACTION, {
@@ -307,12 +358,15 @@ async function processDecision(token, decision, staffName) {
     });
 
     if (!response.ok) {
-      throw new Error(CONFIG.MESSAGES.ACTION_FAILED);
+      const result = await response.json().catch(() => ({}));
+      throw new Error(result.error || CONFIG.MESSAGES.ACTION_FAILED);
     }
 
     await showSuccess(
       "Action Recorded",
-      `The request has been ${decision.toLowerCase()} and forwarded to HR (${hrEmail}).`,
+      isReturn
+        ? `The request has been returned to ${staffName} for correction.`
+        : `The request has been ${decision.toLowerCase()} and forwarded to HR (${hrEmail}).`,
     );
 
     // Reload to refresh data
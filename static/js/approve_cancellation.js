@@ -0,0 +1,206 @@
+/**
+ * approve_cancellation.js - HR Cancellation Confirmation Handler
+ * Confirms or declines a staff member's cancellation of approved leave
+ */
+
+const CONFIG = {
+  API: {
+    FETCH_DETAILS: "/api/leave/cancellation-details",
+    SUBMIT_ACTION: "/api/leave/cancellation-action",
+  },
+  STATUS: {
+    CANCELLATION_REQUESTED: "Cancellation Requested",
+    APPROVED: "Approved",
+    REJECTED: "Rejected",
+  },
+  COLORS: {
+    SUCCESS: "#00c853",
+    ERROR: "#ff5252",
+    NEUTRAL: "#888",
+    PRIMARY: "#004d40",
+  },
+  MESSAGES: {
+    INVALID_TOKEN: "Invalid access link. No security token provided.",
+    FETCH_ERROR: "Cancellation request not found or already processed.",
+    REASON_REQUIRED: "Please provide a reason for keeping the leave.",
+    ACTION_FAILED: "Failed to process action on the server.",
+  },
+};
+
+// ============================================================================
+// UTILITY FUNCTIONS
+// ============================================================================
+
+function getElement(id) {
+  const element = document.getElementById(id);
+  if (!element) console.warn(`Element with ID '${id}' not found`);
+  return element;
+}
+
+function showError(message) {
+  Swal.fire({
+    icon: "error",
+    title: "Access Denied",
+    text: message || "An unexpected error occurred.",
+    confirmButtonColor: CONFIG.COLORS.PRIMARY,
+  });
+}
+
+function getUrlParameter(param) {
+  return new URLSearchParams(window.location.search).get(param);
+}
+
+// ============================================================================
+// DOM POPULATION
+// ============================================================================
+
+function populateUI(data) {
+  if (!data) return;
+
+  const fieldMapping = {
+    displayStaffName: "staff_name",
+    displayStaffNo: "staff_no",
+    displayDesignation: "designation",
+    displayDept: "department",
+    displayPhone: "phone_number",
+    displayDateEmployed: "date_employed",
+    displayType: "leave_type",
+    displayStart: "start_date",
+    displayEnd: "resumption_date",
+    displayRelief: "relief_staff",
+    displayCancelReason: "cancellation_reason",
+  };
+
+  Object.entries(fieldMapping).forEach(([id, key]) => {
+    const el = getElement(id);
+    if (el) el.textContent = data[key] || "N/A";
+  });
+
+  const allowanceEl = getElement("displayAllowance");
+  if (allowanceEl) {
+    allowanceEl.textContent = data.leave_allowance_request
+      ? "YES (Requested)"
+      : "NO";
+    allowanceEl.style.color = data.leave_allowance_request
+      ? CONFIG.COLORS.SUCCESS
+      : CONFIG.COLORS.NEUTRAL;
+  }
+
+  const totalDaysEl = getElement("displayTotalDays");
+  if (totalDaysEl) {
+    totalDaysEl.textContent = `${data.total_days || 0} Working Days`;
+  }
+
+  if (data.status !== CONFIG.STATUS.CANCELLATION_REQUESTED) {
+    const actions = getElement("actionButtons");
+    if (actions) actions.style.display = "none";
+    const banner = getElement("statusMessage");
+    if (banner) {
+      banner.classList.remove("hidden");
+      banner.textContent = `This request has already been processed (${data.status}).`;
+    }
+  }
+}
+
+// ============================================================================
+// ACTION HANDLERS
+// ============================================================================
+
+async function processDecision(token, decision, data) {
+  const isConfirm = decision === CONFIG.STATUS.APPROVED;
+
+  const confirmResult = await Swal.fire({
+    title: isConfirm ? "Confirm cancellation?" : "Keep the leave?",
+    text: isConfirm
+      ? `${data.staff_name}'s leave will be cancelled and ${data.total_days} day(s) restored.`
+      : `${data.staff_name}'s leave will remain approved.`,
+    icon: "question",
+    input: isConfirm ? undefined : "textarea",
+    inputPlaceholder: "Reason for keeping the leave",
+    inputValidator: (value) =>
+      !isConfirm && !value ? CONFIG.MESSAGES.REASON_REQUIRED : undefined,
+    showCancelButton: true,
+    confirmButtonColor: isConfirm ? CONFIG.COLORS.SUCCESS : CONFIG.COLORS.ERROR,
+    cancelButtonColor: CONFIG.COLORS.NEUTRAL,
+    confirmButtonText: "Yes, Proceed",
+  });
+
+  if (!confirmResult.isConfirmed) return;
+
+  const code = await confirmApproverCode(token).catch((error) => {
+    showError(error.message);
+    return null;
+  });
+  if (code === null) return;
+
+  try {
+    const response = await fetch(CONFIG.API.SUBMIT_ACTION, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({
+        token,
+        status: decision,
+        reason: isConfirm ? "" : confirmResult.value,
+        code,
+      }),
+    });
+
+    const result = await response.json();
+    if (!response.ok) {
+      throw new Error(result.error || CONFIG.MESSAGES.ACTION_FAILED);
+    }
+
+    await Swal.fire({
+      icon: "success",
+      title: "Decision Recorded",
+      text: result.message,
+      confirmButtonColor: CONFIG.COLORS.PRIMARY,
+    });
+    const actions = getElement("actionButtons");
+    if (actions) actions.style.display = "none";
+  } catch (error) {
+    showError(error.message);
+  }
+}
+
+// ============================================================================
+// INITIALIZATION
+// ============================================================================
+
+document.addEventListener("DOMContentLoaded", async () => {
+  const token = getUrlParameter("resource_token");
+
+  if (!token) {
+    showError(CONFIG.MESSAGES.INVALID_TOKEN);
+    return;
+  }
+
+  try {
+    const response = await fetch(`${CONFIG.API.FETCH_DETAILS}?token=${token}`);
+    if (!response.ok) {
+      // 410: the link was already used, replaced by a newer one or has expired
+      const body = await response.json().catch(() => ({}));
+      throw new Error(
+        response.status === 410 ? body.error : CONFIG.MESSAGES.FETCH_ERROR,
+      );
+    }
+
+    const data = await response.json();
+    populateUI(data);
+    setupApproverCode(data);
+
+    const approveBtn = getElement("approveBtn");
+    const rejectBtn = getElement("rejectBtn");
+    if (approveBtn) {
+      approveBtn.onclick = () =>
+        processDecision(token, CONFIG.STATUS.APPROVED, data);
+    }
+    if (rejectBtn) {
+      rejectBtn.onclick = () =>
+        processDecision(token, CONFIG.STATUS.REJECTED, data);
+    }
+  } catch (error) {
+    console.error("Initialization Error:", error);
+    showError(error.message || CONFIG.MESSAGES.FETCH_ERROR);
+  }
+});
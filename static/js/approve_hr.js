@@ -7,6 +7,7 @@ const CONFIG = {
     PENDING_HR_REVIEW: "Pending HR Review",
     APPROVED: "Approved",
     REJECTED: "Rejected",
+    RETURNED: "Returned for Correction",
   },
   COLORS: {
     SUCCESS: "#00c853",
@@ -22,6 +23,9 @@ const CONFIG = {
     MD_EMAIL_INVALID: "Please enter a valid @petrodata.net email address.",
     ACTION_FAILED: "Failed to process action on the server.",
     SYSTEM_ERROR: "System configuration error.",
+    SIGNATURE_REQUIRED: "Please draw or type your signature before approving.",
+    REASON_REQUIRED: "Please provide a reason for the rejection.",
+    CORRECTION_REQUIRED: "Please say what the staff member needs to correct.",
   },
 };
 
@@ -145,6 +149,7 @@ function handleProcessedRequests(data) {
 
     const forwarding = getElement("mdEmailContainer");
     if (forwarding) forwarding.style.display = "none";
+    hideSignaturePad();
 
     const banner = getElement("statusMessage");
     if (banner) {
@@ -159,10 +164,14 @@ function handleProcessedRequests(data) {
 // ============================================================================
 
 function toggleLoading(decision, isLoading) {
-  const isApprove = decision === CONFIG.STATUS.APPROVED;
-  const btn = getElement(isApprove ? "approveBtn" : "rejectBtn");
-  const icon = getElement(isApprove ? "approveIcon" : "rejectIcon");
-  const spinner = getElement(isApprove ? "approveSpinner" : "rejectSpinner");
+  const prefix = {
+    [CONFIG.STATUS.APPROVED]: "approve",
+    [CONFIG.STATUS.REJECTED]: "reject",
+    [CONFIG.STATUS.RETURNED]: "return",
+  }[decision];
+  const btn = getElement(`${prefix}Btn`);
+  const icon = getElement(`${prefix}Icon`);
+  const spinner = getElement(`${prefix}Spinner`);
 
   if (!btn) return;
 
@@ -180,30 +189,52 @@ function toggleLoading(decision, isLoading) {
 
 async function processDecision(token, decision, staffName) {
   const isApprove = decision === CONFIG.STATUS.APPROVED;
+  const isReturn = decision === CONFIG.STATUS.RETURNED;
   const mdEmailInput = getElement("mdEmail");
   let mdEmail = "";
 
-  // Validation: MD Email is ONLY required for approval
-  if (isApprove) {
-    if (!mdEmailInput) return;
-    mdEmail = mdEmailInput.value.trim();
+  // Validation: the MD approves the request or reviews the rejection; a
+  // returned request goes back to the staff instead
+  if (!mdEmailInput) return;
+  mdEmail = isReturn ? "" : mdEmailInput.value.trim();
 
-    if (!mdEmail) {
-      showWarning("MD Email Required", CONFIG.MESSAGES.MD_EMAIL_REQUIRED);
-      return;
-    }
-    if (!isValidEmail(mdEmail)) {
-      showWarning("Invalid Email", CONFIG.MESSAGES.MD_EMAIL_INVALID);
-      return;
-    }
+  if (!isReturn && !mdEmail) {
+    showWarning("MD Email Required", CONFIG.MESSAGES.MD_EMAIL_REQUIRED);
+    return;
+  }
+  if (!isReturn && !isValidEmail(mdEmail)) {
+    showWarning("Invalid Email", CONFIG.MESSAGES.MD_EMAIL_INVALID);
+    return;
+  }
+
+  const signature = getSignature();
+  if (isApprove && !signature) {
+    showWarning("Signature Required", CONFIG.MESSAGES.SIGNATURE_REQUIRED);
+    return;
   }
 
+  let text = `Rejecting ${staffName}'s request. The Managing Director will review the rejection.`;
+  if (isApprove) {
+    text = `Approving ${staffName}'s request and forwarding to the Managing Director.`;
+  } else if (isReturn) {
+    text = `Returning ${staffName}'s request to them to correct and resubmit.`;
+  }
+
+  // Rejections and returns need a comment for the staff
   const confirmResult = await Swal.fire({
     title: `Confirm ${decision}?`,
-    text: isApprove
-      ? `Approving ${staffName}'s request and forwarding to the Managing Director.`
-      : `Rejecting ${staffName}'s request. This will terminate the workflow.`,
+    text,
     icon: "question",
+    input: isApprove ? undefined : "textarea",
+    inputPlaceholder: isReturn
+      ? "What needs to be corrected"
+      : "Reason for rejection",
+    inputValidator: (value) => {
+      if (isApprove || value.trim()) return undefined;
+      return isReturn
+        ? CONFIG.MESSAGES.CORRECTION_REQUIRED
+        : CONFIG.MESSAGES.REASON_REQUIRED;
+    },
     showCancelButton: true,
     confirmButtonColor: getDecisionColor(decision),
     cancelButtonColor: CONFIG.COLORS.NEUTRAL,
@@ -211,6 +242,13 @@ async function processDecision(token, decision, staffName) {
   });
 
   if (!confirmResult.isConfirmed) return;
+  const reason = isApprove ? "" : confirmResult.value.trim();
+
+  const code = await confirmApproverCode(token).catch((error) => {
+    showError(error.message);
+    return null;
+  });
+  if (code === null) return;
 
   toggleLoading(decision, true);
 
@@ -222,6 +260,9 @@ async function processDecision(token, decision, staffName) {
         token: token,
         status: decision,
         director_email: mdEmail,
+        reason,
+        code,
+        signature,
       }),
     });
 
@@ -231,12 +272,13 @@ async function processDecision(token, decision, staffName) {
       throw new Error(result.error || CONFIG.MESSAGES.ACTION_FAILED);
     }
 
-    await showSuccess(
-      "Decision Recorded",
-      isApprove
-        ? `Request forwarded successfully to ${mdEmail}.`
-        : "The request has been rejected and the staff notified.",
-    );
+    let message = `The request has been rejected, the staff notified and the rejection sent to ${mdEmail} for review.`;
+    if (isApprove) {
+      message = `Request forwarded successfully to ${mdEmail}.`;
+    } else if (isReturn) {
+      message = `The request has been returned to ${staffName} for correction.`;
+    }
+    await showSuccess("Decision Recorded", message);
 
     window.location.reload();
   } catch (error) {
@@ -262,11 +304,17 @@ document.addEventListener("DOMContentLoaded", async () => {
     const response = await fetch(`${CONFIG.API.FETCH_DETAILS}?token=${token}`);
 
     if (!response.ok) {
-      throw new Error(CONFIG.MESSAGES.FETCH_ERROR);
+      // 410: the link was already used, replaced by a newer one or has expired
+      const body = await response.json().catch(() => ({}));
+      throw new Error(
+        response.status === 410 ? body.error : CONFIG.MESSAGES.FETCH_ERROR,
+      );
     }
 
     const data = await response.json();
     populateUI(data);
+    showReviewWarnings(data);
+    setupApproverCode(data);
 
     // Setup Event Listeners
     const approveBtn = getElement("approveBtn");
@@ -280,6 +328,11 @@ document.addEventListener("DOMContentLoaded", async () => {
       rejectBtn.onclick = () =>
         processDecision(token, CONFIG.STATUS.REJECTED, data.staff_name);
     }
+    const returnBtn = getElement("returnBtn");
+    if (returnBtn) {
+      returnBtn.onclick = () =>
+        processDecision(token, CONFIG.STATUS.RETURNED, data.staff_name);
+    }
   } catch (error) {
     console.error("Initialization Error:", error);
     showError(error.message || CONFIG.MESSAGES.FETCH_ERROR);
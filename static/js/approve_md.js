@@ -7,6 +7,7 @@ const CONFIG = {
     PENDING_MD_REVIEW: "Pending MD Review",
     APPROVED: "Approved",
     REJECTED: "Rejected",
+    RETURNED: "Returned for Correction",
   },
   COLORS: {
     SUCCESS: "#00c853",
@@ -19,6 +20,9 @@ const CONFIG = {
     FETCH_ERROR: "Leave request not found or the MD link has expired.",
     ACTION_FAILED: "Failed to finalize request on the server.",
     SYSTEM_ERROR: "System configuration error.",
+    SIGNATURE_REQUIRED: "Please draw or type your signature before approving.",
+    REASON_REQUIRED: "Please provide a reason for declining.",
+    CORRECTION_REQUIRED: "Please say what the staff member needs to correct.",
   },
 };
 
@@ -128,10 +132,14 @@ function displayAuditTrail(data) {
 // ============================================================================
 
 function toggleLoading(decision, isLoading) {
-  const isApprove = decision === CONFIG.STATUS.APPROVED;
-  const btn = getElement(isApprove ? "approveBtn" : "rejectBtn");
-  const icon = getElement(isApprove ? "approveIcon" : "rejectIcon");
-  const spinner = getElement(isApprove ? "approveSpinner" : "rejectSpinner");
+  const prefix = {
+    [CONFIG.STATUS.APPROVED]: "approve",
+    [CONFIG.STATUS.REJECTED]: "reject",
+    [CONFIG.STATUS.RETURNED]: "return",
+  }[decision];
+  const btn = getElement(`${prefix}Btn`);
+  const icon = getElement(`${prefix}Icon`);
+  const spinner = getElement(`${prefix}Spinner`);
 
   if (!btn) return;
   btn.disabled = isLoading;
@@ -148,18 +156,50 @@ function toggleLoading(decision, isLoading) {
 }
 
 async function processFinalDecision(token, decision, staffName) {
-  // Simple confirmation for both Approve and Reject
+  const signature = getSignature();
+  if (decision === CONFIG.STATUS.APPROVED && !signature) {
+    Swal.fire({
+      title: "Signature Required",
+      text: CONFIG.MESSAGES.SIGNATURE_REQUIRED,
+      icon: "warning",
+      confirmButtonColor: CONFIG.COLORS.PRIMARY,
+    });
+    return;
+  }
+
+  // Declining or returning needs a comment for the staff
+  const isApprove = decision === CONFIG.STATUS.APPROVED;
+  const isReturn = decision === CONFIG.STATUS.RETURNED;
   const confirmResult = await Swal.fire({
     title: `Confirm ${decision}?`,
-    text: `Are you sure you want to ${decision.toLowerCase()} the request for ${staffName}?`,
+    text: isReturn
+      ? `The request will go back to ${staffName} to correct and resubmit.`
+      : `Are you sure you want to ${decision.toLowerCase()} the request for ${staffName}?`,
     icon: "warning",
+    input: isApprove ? undefined : "textarea",
+    inputPlaceholder: isReturn
+      ? "What needs to be corrected"
+      : "Reason for declining",
+    inputValidator: (value) => {
+      if (isApprove || value.trim()) return undefined;
+      return isReturn
+        ? CONFIG.MESSAGES.CORRECTION_REQUIRED
+        : CONFIG.MESSAGES.REASON_REQUIRED;
+    },
     showCancelButton: true,
     confirmButtonColor: getDecisionColor(decision),
     cancelButtonColor: CONFIG.COLORS.NEUTRAL,
-    confirmButtonText: "Yes, Finalize",
+    confirmButtonText: isReturn ? "Yes, Return" : "Yes, Finalize",
   });
 
   if (!confirmResult.isConfirmed) return;
+  const reason = isApprove ? "" : confirmResult.value.trim();
+
+  const code = await confirmApproverCode(token).catch((error) => {
+    showError(error.message);
+    return null;
+  });
+  if (code === null) return;
 
   toggleLoading(decision, true);
 
@@ -170,7 +210,9 @@ async function processFinalDecision(token, decision, staffName) {
       body: JSON.stringify({
         token: token,
         status: decision,
-        reason: "", // Sending empty string to satisfy the struct
+        reason,
+        code,
+        signature,
       }),
     });
 
@@ -179,7 +221,12 @@ async function processFinalDecision(token, decision, staffName) {
     if (!response.ok)
       throw new Error(result.error || CONFIG.MESSAGES.ACTION_FAILED);
 
-    await showSuccess("Success", `Request has been ${decision.toLowerCase()}.`);
+    await showSuccess(
+      "Success",
+      isReturn
+        ? `The request has been returned to ${staffName} for correction.`
+        : `Request has been ${decision.toLowerCase()}.`,
+    );
     window.location.reload();
   } catch (error) {
     showError(error.message);
@@ -200,10 +247,18 @@ document.addEventListener("DOMContentLoaded", async () => {
 
   try {
     const response = await fetch(`${CONFIG.API.FETCH_DETAILS}?token=${token}`);
-    if (!response.ok) throw new Error(CONFIG.MESSAGES.FETCH_ERROR);
+    if (!response.ok) {
+      // 410: the link was already used, replaced by a newer one or has expired
+      const body = await response.json().catch(() => ({}));
+      throw new Error(
+        response.status === 410 ? body.error : CONFIG.MESSAGES.FETCH_ERROR,
+      );
+    }
 
     const data = await response.json();
     populateUI(data);
+    showReviewWarnings(data);
+    setupApproverCode(data);
 
     // Bind Event Listeners
     const approveBtn = getElement("approveBtn");
@@ -217,6 +272,11 @@ document.addEventListener("DOMContentLoaded", async () => {
       rejectBtn.onclick = () =>
         processFinalDecision(token, CONFIG.STATUS.REJECTED, data.staff_name);
     }
+    const returnBtn = getElement("returnBtn");
+    if (returnBtn) {
+      returnBtn.onclick = () =>
+        processFinalDecision(token, CONFIG.STATUS.RETURNED, data.staff_name);
+    }
   } catch (error) {
     showError(error.message);
   }
@@ -0,0 +1,261 @@
+/**
+ * approve_stage.js - Generic Approval Stage Handler
+ * Handles any stage of an approval chain configured by HR
+ */
+
+const CONFIG = {
+  API: {
+    FETCH_DETAILS: "/api/leave/stage-details",
+    SUBMIT_ACTION: "/api/leave/stage-action",
+  },
+  STATUS: {
+    PENDING_STAGE: "Pending Stage Approval",
+    APPROVED: "Approved",
+    REJECTED: "Rejected",
+  },
+  COLORS: {
+    SUCCESS: "#00c853",
+    ERROR: "#ff5252",
+    NEUTRAL: "#888",
+    PRIMARY: "#004d40",
+  },
+  MESSAGES: {
+    INVALID_TOKEN: "Invalid access link. No security token provided.",
+    FETCH_ERROR: "Leave request not found or the link has expired.",
+    EMAIL_REQUIRED: "Please provide the email of the next approver.",
+    EMAIL_INVALID: "Email must be valid (contain @).",
+    REASON_REQUIRED: "Please provide a reason for the rejection.",
+    ACTION_FAILED: "Failed to process action on the server.",
+  },
+};
+
+// ============================================================================
+// UTILITY FUNCTIONS
+// ============================================================================
+
+function getElement(id) {
+  const element = document.getElementById(id);
+  if (!element) console.warn(`Element with ID '${id}' not found`);
+  return element;
+}
+
+function showError(message) {
+  Swal.fire({
+    icon: "error",
+    title: "Access Denied",
+    text: message || "An unexpected error occurred.",
+    confirmButtonColor: CONFIG.COLORS.PRIMARY,
+  });
+}
+
+function showWarning(title, message) {
+  return Swal.fire({
+    icon: "warning",
+    title,
+    text: message,
+    confirmButtonColor: CONFIG.COLORS.PRIMARY,
+  });
+}
+
+function isValidEmail(email) {
+  return email && email.includes("@");
+}
+
+function getUrlParameter(param) {
+  return new URLSearchParams(window.location.search).get(param);
+}
+
+// ============================================================================
+// DOM POPULATION
+// ============================================================================
+
+function populateUI(data) {
+  if (!data) return;
+
+  const fieldMapping = {
+    displayStaffName: "staff_name",
+    displayStaffNo: "staff_no",
+    displayDesignation: "designation",
+    displayDept: "department",
+    displayPhone: "phone_number",
+    displayDateEmployed: "date_employed",
+    displayType: "leave_type",
+    displayStart: "start_date",
+    displayEnd: "resumption_date",
+    displayRelief: "relief_staff",
+  };
+
+  Object.entries(fieldMapping).forEach(([id, key]) => {
+    const el = getElement(id);
+    if (el) el.textContent = data[key] || "N/A";
+  });
+
+  const allowanceEl = getElement("displayAllowance");
+  if (allowanceEl) {
+    allowanceEl.textContent = data.leave_allowance_request
+      ? "YES (Requested)"
+      : "NO";
+    allowanceEl.style.color = data.leave_allowance_request
+      ? CONFIG.COLORS.SUCCESS
+      : CONFIG.COLORS.NEUTRAL;
+  }
+
+  const totalDaysEl = getElement("displayTotalDays");
+  if (totalDaysEl) {
+    totalDaysEl.textContent = `${data.total_days || 0} Working Days`;
+  }
+
+  const titleEl = getElement("stageTitle");
+  if (titleEl && data.stage) titleEl.textContent = `${data.stage.name} Review`;
+
+  const stagesEl = getElement("displayStages");
+  if (stagesEl) {
+    stagesEl.textContent = (data.stages || [])
+      .map((s) => `${s.name}: ${s.decision || "Awaiting"}`)
+      .join("  →  ");
+  }
+
+  if (data.needs_next_approver) {
+    const container = getElement("nextEmailContainer");
+    if (container) container.classList.remove("hidden");
+    const nameEl = getElement("nextStageName");
+    if (nameEl) nameEl.textContent = data.next_stage_name;
+  }
+
+  const isCurrent =
+    data.status === CONFIG.STATUS.PENDING_STAGE &&
+    data.stage &&
+    data.stage.position === data.current_stage &&
+    !data.stage.decision;
+
+  if (!isCurrent) {
+    const actions = getElement("actionButtons");
+    if (actions) actions.style.display = "none";
+    const forwarding = getElement("nextEmailContainer");
+    if (forwarding) forwarding.classList.add("hidden");
+    const banner = getElement("statusMessage");
+    if (banner) {
+      banner.classList.remove("hidden");
+      banner.textContent = `This request has already been processed (${data.status}).`;
+    }
+  }
+}
+
+// ============================================================================
+// ACTION HANDLERS
+// ============================================================================
+
+async function processDecision(token, decision, data) {
+  const isApprove = decision === CONFIG.STATUS.APPROVED;
+  let nextEmail = "";
+  let reason = "";
+
+  if (isApprove && data.needs_next_approver) {
+    nextEmail = getElement("nextEmail").value.trim();
+    if (!nextEmail) {
+      showWarning("Email Required", CONFIG.MESSAGES.EMAIL_REQUIRED);
+      return;
+    }
+    if (!isValidEmail(nextEmail)) {
+      showWarning("Invalid Email", CONFIG.MESSAGES.EMAIL_INVALID);
+      return;
+    }
+  }
+
+  const confirmResult = await Swal.fire({
+    title: `Confirm ${decision}?`,
+    text: isApprove
+      ? `Approving ${data.staff_name}'s request.`
+      : `Rejecting ${data.staff_name}'s request. This will end the workflow.`,
+    icon: "question",
+    input: isApprove ? undefined : "textarea",
+    inputPlaceholder: "Reason for rejection",
+    inputValidator: (value) =>
+      !isApprove && !value ? CONFIG.MESSAGES.REASON_REQUIRED : undefined,
+    showCancelButton: true,
+    confirmButtonColor: isApprove ? CONFIG.COLORS.SUCCESS : CONFIG.COLORS.ERROR,
+    cancelButtonColor: CONFIG.COLORS.NEUTRAL,
+    confirmButtonText: "Yes, Proceed",
+  });
+
+  if (!confirmResult.isConfirmed) return;
+  if (!isApprove) reason = confirmResult.value;
+
+  const code = await confirmApproverCode(token).catch((error) => {
+    showError(error.message);
+    return null;
+  });
+  if (code === null) return;
+
+  try {
+    const response = await fetch(CONFIG.API.SUBMIT_ACTION, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({
+        token,
+        status: decision,
+        next_approver_email: nextEmail,
+        reason,
+        code,
+      }),
+    });
+
+    const result = await response.json();
+    if (!response.ok) {
+      throw new Error(result.error || CONFIG.MESSAGES.ACTION_FAILED);
+    }
+
+    await Swal.fire({
+      icon: "success",
+      title: "Decision Recorded",
+      text: result.message,
+      confirmButtonColor: CONFIG.COLORS.PRIMARY,
+    });
+    window.location.reload();
+  } catch (error) {
+    showError(error.message);
+  }
+}
+
+// ============================================================================
+// INITIALIZATION
+// ============================================================================
+
+document.addEventListener("DOMContentLoaded", async () => {
+  const token = getUrlParameter("stage_token");
+
+  if (!token) {
+    showError(CONFIG.MESSAGES.INVALID_TOKEN);
+    return;
+  }
+
+  try {
+    const response = await fetch(`${CONFIG.API.FETCH_DETAILS}?token=${token}`);
+    if (!response.ok) {
+      // 410: the link was already used, replaced by a newer one or has expired
+      const body = await response.json().catch(() => ({}));
+      throw new Error(
+        response.status === 410 ? body.error : CONFIG.MESSAGES.FETCH_ERROR,
+      );
+    }
+
+    const data = await response.json();
+    populateUI(data);
+    showReviewWarnings(data);
+    setupApproverCode(data);
+
+    const approveBtn = getElement("approveBtn");
+    const rejectBtn = getElement("rejectBtn");
+    if (approveBtn) {
+      approveBtn.onclick = () =>
+        processDecision(token, CONFIG.STATUS.APPROVED, data);
+    }
+    if (rejectBtn) {
+      rejectBtn.onclick = () =>
+        processDecision(token, CONFIG.STATUS.REJECTED, data);
+    }
+  } catch (error) {
+    console.error("Initialization Error:", error);
+    showError(error.message || CONFIG.MESSAGES.FETCH_ERROR);
+  }
+});
@@ -0,0 +1,190 @@
+/**
+ * file_rejection.js - HR Rejection Filing Handler
+ * Files a leave request the line manager rejected
+ */
+
+const CONFIG = {
+  API: {
+    FETCH_DETAILS: "/api/leave/filing-details",
+    SUBMIT_ACTION: "/api/leave/filing-action",
+  },
+  STATUS: {
+    REJECTED_BY_MANAGER: "Rejected by Manager - Pending HR Filing",
+  },
+  COLORS: {
+    SUCCESS: "#00c853",
+    ERROR: "#ff5252",
+    NEUTRAL: "#888",
+    PRIMARY: "#004d40",
+  },
+  MESSAGES: {
+    INVALID_TOKEN: "Invalid access link. No security token provided.",
+    FETCH_ERROR: "Rejected request not found or already filed.",
+    ACTION_FAILED: "Failed to process action on the server.",
+  },
+};
+
+// ============================================================================
+// UTILITY FUNCTIONS
+// ============================================================================
+
+function getElement(id) {
+  const element = document.getElementById(id);
+  if (!element) console.warn(`Element with ID '${id}' not found`);
+  return element;
+}
+
+function showError(message) {
+  Swal.fire({
+    icon: "error",
+    title: "Access Denied",
+    text: message || "An unexpected error occurred.",
+    confirmButtonColor: CONFIG.COLORS.PRIMARY,
+  });
+}
+
+function getUrlParameter(param) {
+  return new URLSearchParams(window.location.search).get(param);
+}
+
+// ============================================================================
+// DOM POPULATION
+// ============================================================================
+
+function populateUI(data) {
+  if (!data) return;
+
+  const fieldMapping = {
+    displayStaffName: "staff_name",
+    displayStaffNo: "staff_no",
+    displayDesignation: "designation",
+    displayDept: "department",
+    displayPhone: "phone_number",
+    displayDateEmployed: "date_employed",
+    displayType: "leave_type",
+    displayStart: "start_date",
+    displayEnd: "resumption_date",
+    displayRelief: "relief_staff",
+    displayRejectionReason: "rejection_reason",
+  };
+
+  Object.entries(fieldMapping).forEach(([id, key]) => {
+    const el = getElement(id);
+    if (el) el.textContent = data[key] || "N/A";
+  });
+
+  const allowanceEl = getElement("displayAllowance");
+  if (allowanceEl) {
+    allowanceEl.textContent = data.leave_allowance_request
+      ? "YES (Requested)"
+      : "NO";
+    allowanceEl.style.color = data.leave_allowance_request
+      ? CONFIG.COLORS.SUCCESS
+      : CONFIG.COLORS.NEUTRAL;
+  }
+
+  const totalDaysEl = getElement("displayTotalDays");
+  if (totalDaysEl) {
+    totalDaysEl.textContent = `${data.total_days || 0} Working Days`;
+  }
+
+  if (data.status !== CONFIG.STATUS.REJECTED_BY_MANAGER) {
+    const actions = getElement("actionButtons");
+    if (actions) actions.style.display = "none";
+    const banner = getElement("statusMessage");
+    if (banner) {
+      banner.classList.remove("hidden");
+      banner.textContent = `This request has already been processed (${data.status}).`;
+    }
+  }
+}
+
+// ============================================================================
+// ACTION HANDLERS
+// ============================================================================
+
+async function fileRejection(token, data) {
+  const confirmResult = await Swal.fire({
+    title: "File this rejection?",
+    text: `${data.staff_name}'s rejected request will be closed and filed.`,
+    icon: "question",
+    input: "textarea",
+    inputPlaceholder: "Filing note (optional)",
+    showCancelButton: true,
+    confirmButtonColor: CONFIG.COLORS.PRIMARY,
+    cancelButtonColor: CONFIG.COLORS.NEUTRAL,
+    confirmButtonText: "Yes, File It",
+  });
+
+  if (!confirmResult.isConfirmed) return;
+
+  const code = await confirmApproverCode(token).catch((error) => {
+    showError(error.message);
+    return null;
+  });
+  if (code === null) return;
+
+  try {
+    const response = await fetch(CONFIG.API.SUBMIT_ACTION, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({
+        token,
+        reason: confirmResult.value || "",
+        code,
+      }),
+    });
+
+    const result = await response.json();
+    if (!response.ok) {
+      throw new Error(result.error || CONFIG.MESSAGES.ACTION_FAILED);
+    }
+
+    await Swal.fire({
+      icon: "success",
+      title: "Filed",
+      text: result.message,
+      confirmButtonColor: CONFIG.COLORS.PRIMARY,
+    });
+    const actions = getElement("actionButtons");
+    if (actions) actions.style.display = "none";
+  } catch (error) {
+    showError(error.message);
+  }
+}
+
+// ============================================================================
+// INITIALIZATION
+// ============================================================================
+
+document.addEventListener("DOMContentLoaded", async () => {
+  const token = getUrlParameter("resource_token");
+
+  if (!token) {
+    showError(CONFIG.MESSAGES.INVALID_TOKEN);
+    return;
+  }
+
+  try {
+    const response = await fetch(`${CONFIG.API.FETCH_DETAILS}?token=${token}`);
+    if (!response.ok) {
+      // 410: the link was already used, replaced by a newer one or has expired
+      const body = await response.json().catch(() => ({}));
+      throw new Error(
+        response.status === 410 ? body.error : CONFIG.MESSAGES.FETCH_ERROR,
+      );
+    }
+
+    const data = await response.json();
+    populateUI(data);
+    setupApproverCode(data);
+
+    const fileBtn = getElement("fileBtn");
+    if (fileBtn) {
+      fileBtn.onclick = () => fileRejection(token, data);
+    }
+  } catch (error) {
+    console.error("Initialization Error:", error);
+    showError(error.message || CONFIG.MESSAGES.FETCH_ERROR);
+  }
+});
@@ -303,7 +303,11 @@ document.addEventListener("DOMContentLoaded", async () => {
     const response = await fetch(`${CONFIG.API.FETCH_DETAILS}?token=${token}`);
 
     if (!response.ok) {
-      throw new Error(CONFIG.MESSAGES.FETCH_ERROR);
+      // 410: the link was already used, replaced by a newer one or has expired
+      const body = await response.json().catch(() => ({}));
+      throw new Error(
+        response.status === 410 ? body.error : CONFIG.MESSAGES.FETCH_ERROR,
+      );
     }
 
     const data = await response.json();
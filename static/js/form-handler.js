@@ -35,6 +35,66 @@ document.addEventListener("DOMContentLoaded", () => {
     noInput.readOnly = true; // Make it read-only for security
   }
 
+  // Public holidays (this year and next) so the preview matches the server count
+  let holidays = new Set();
+  const thisYear = new Date().getFullYear();
+  Utils.loadHolidays([thisYear, thisYear + 1]).then((set) => {
+    holidays = set;
+    handleDateChange();
+  });
+
+  // Leave types and their rules come from the HR-managed catalogue
+  const leaveTypeSelect = document.getElementById("leaveType");
+  const leaveTypeRules = document.getElementById("leaveTypeRules");
+  const documentGroup = document.getElementById("supportingDocumentGroup");
+  const documentInput = document.getElementById("supportingDocument");
+  let leaveTypes = [];
+
+  const describeRules = (type) => {
+    const rules = [];
+    if (!type.paid) rules.push("Unpaid");
+    if (type.counts_against_annual && type.name !== "Annual")
+      rules.push("Counts against annual leave");
+    else if (type.entitlement > 0)
+      rules.push(`${type.entitlement} days a year`);
+    if (type.max_consecutive_days > 0)
+      rules.push(`Up to ${type.max_consecutive_days} working days at a time`);
+    if (type.min_notice_days > 0)
+      rules.push(`${type.min_notice_days} days notice`);
+    if (type.min_service_months > 0)
+      rules.push(`After ${type.min_service_months} months of service`);
+    if (type.allowed_genders) rules.push(`${type.allowed_genders} staff only`);
+    if (type.document_required) rules.push("Supporting document required");
+    return rules.join(" · ");
+  };
+
+  const handleLeaveTypeChange = () => {
+    const type = leaveTypes.find((t) => t.name === leaveTypeSelect.value);
+    if (leaveTypeRules) leaveTypeRules.textContent = type ? describeRules(type) : "";
+    const needsDocument = Boolean(type && type.document_required);
+    documentGroup.style.display = needsDocument ? "" : "none";
+    documentInput.required = needsDocument;
+  };
+
+  fetch("/api/leave-types")
+    .then((response) => (response.ok ? response.json() : []))
+    .then((types) => {
+      leaveTypes = types;
+      types.forEach((type) => {
+        leaveTypeSelect.add(new Option(type.label || `${type.name} Leave`, type.name));
+      });
+    })
+    .catch((error) => console.warn("Could not load leave types:", error));
+  leaveTypeSelect.addEventListener("change", handleLeaveTypeChange);
+
+  const readDocument = (file) =>
+    new Promise((resolve, reject) => {
+      const reader = new FileReader();
+      reader.onload = () => resolve(reader.result);
+      reader.onerror = () => reject(reader.error);
+      reader.readAsDataURL(file);
+    });
+
   // 2. Real-time Calculation Trigger
   const handleDateChange = () => {
     const startVal = startDateInput.value;
@@ -42,7 +102,7 @@ document.addEventListener("DOMContentLoaded", () => {
 
     if (startVal && resumptionVal) {
       // Uses utility.js to calculate working days
-      const days = Utils.calculateLeaveDays(startVal, resumptionVal);
+      const days = Utils.calculateLeaveDays(startVal, resumptionVal, holidays);
       totalDaysInput.value = Utils.formatDaysText(days);
 
       // Visual feedback
@@ -75,6 +135,7 @@ document.addEventListener("DOMContentLoaded", () => {
     const numericDays = Utils.calculateLeaveDays(
       startDateInput.value,
       resumptionDateInput.value,
+      holidays,
     );
 
     if (numericDays <= 0) {
@@ -102,6 +163,10 @@ document.addEventListener("DOMContentLoaded", () => {
       relief_staff: document.getElementById("reliefStaff").value,
       contact_address: document.getElementById("contactAddress").value,
       manager_email: document.getElementById("managerEmail").value,
+      supporting_document:
+        documentInput.files.length > 0
+          ? await readDocument(documentInput.files[0])
+          : "",
     };
 
     // --- START LOADING STATE ---
@@ -156,6 +221,7 @@ document.addEventListener("DOMContentLoaded", () => {
         leaveForm.reset();
         totalDaysInput.value = "";
         totalDaysInput.classList.remove("has-value");
+        handleLeaveTypeChange();
         if (nameInput) nameInput.value = savedName || "";
         if (noInput) noInput.value = savedStaffNo || "";
       });
@@ -0,0 +1,52 @@
+/**
+ * link-code.js - Approver Email Confirmation
+ * When the server requires it, emails a one-time code to the address the
+ * approval link was issued to and asks for it before a decision is sent
+ */
+
+let approverCodeRequired = false;
+
+/**
+ * Remember whether decisions on this page need a confirmation code
+ * @param {Object} data - Leave request data from a detail endpoint
+ */
+function setupApproverCode(data) {
+  approverCodeRequired = Boolean(data && data.code_required);
+}
+
+/**
+ * Request a code for the link and prompt the approver to enter it
+ * @param {string} token - Signed link token
+ * @returns {Promise<string|null>} The code, "" if none is needed, null if cancelled
+ */
+async function confirmApproverCode(token) {
+  if (!approverCodeRequired) return "";
+
+  const response = await fetch("/api/leave/link-code", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ token }),
+  });
+  const result = await response.json();
+  if (!response.ok) {
+    throw new Error(result.error || "Could not send a confirmation code.");
+  }
+
+  const entry = await Swal.fire({
+    title: "Confirm your email",
+    text: `${result.message} Enter it below to record your decision.`,
+    icon: "info",
+    input: "text",
+    inputAttributes: {
+      maxlength: 6,
+      inputmode: "numeric",
+      autocomplete: "one-time-code",
+    },
+    inputValidator: (value) =>
+      /^\d{6}$/.test((value || "").trim()) ? undefined : "Enter the 6-digit code",
+    showCancelButton: true,
+    confirmButtonText: "Confirm",
+  });
+
+  return entry.isConfirmed ? entry.value.trim() : null;
+}
@@ -0,0 +1,54 @@
+/**
+ * review-warnings.js - Shared Approver Warnings
+ * Surfaces conflicts returned by the detail endpoints before a decision is made
+ */
+
+function escapeHTML(value) {
+  const div = document.createElement("div");
+  div.textContent = value == null ? "" : String(value);
+  return div.innerHTML;
+}
+
+/**
+ * Collect warning lines for a leave request
+ * @param {Object} data - Leave request data from a detail endpoint
+ * @returns {string[]} Warning lines (plain text)
+ */
+function collectReviewWarnings(data) {
+  const warnings = [];
+
+  (data.overlaps || []).forEach((o) => {
+    warnings.push(
+      `Overlaps ${o.reference}: ${o.start_date} to ${o.resumption_date} (${o.status})`,
+    );
+  });
+
+  const coverage = data.coverage || {};
+  (coverage.warnings || []).forEach((w) => warnings.push(w));
+  (coverage.others_on_leave || []).forEach((o) => {
+    warnings.push(
+      `${o.staff_name} (${o.reference}): ${o.start_date} to ${o.resumption_date} (${o.status})`,
+    );
+  });
+
+  return warnings;
+}
+
+/**
+ * Show a warning dialog if the request has conflicts
+ * @param {Object} data - Leave request data from a detail endpoint
+ */
+function showReviewWarnings(data) {
+  const warnings = collectReviewWarnings(data);
+  if (!warnings.length) return;
+
+  const hard = data.coverage && data.coverage.hard_warning;
+  Swal.fire({
+    icon: hard ? "error" : "warning",
+    title: hard
+      ? "Minimum staffing would be breached"
+      : "Please review before deciding",
+    html: warnings.map(escapeHTML).join("<br>"),
+    confirmButtonColor: "#004d40",
+  });
+}
@@ -0,0 +1,221 @@
+/**
+ * review_md.js - MD Rejection Review Handler
+ * Upholds or overturns a leave request HR rejected
+ */
+
+const CONFIG = {
+  API: {
+    FETCH_DETAILS: "/api/leave/md-review-details",
+    SUBMIT_ACTION: "/api/leave/md-review-action",
+  },
+  STATUS: {
+    REJECTED_BY_HR: "Rejected by HR - Pending MD Review",
+    OVERTURNED: "Overturned",
+    UPHELD: "Upheld",
+  },
+  COLORS: {
+    SUCCESS: "#00c853",
+    ERROR: "#ff5252",
+    NEUTRAL: "#888",
+    PRIMARY: "#004d40",
+  },
+  MESSAGES: {
+    INVALID_TOKEN: "Invalid access link. No security token provided.",
+    FETCH_ERROR: "Rejected request not found or already reviewed.",
+    SIGNATURE_REQUIRED: "Please draw or type your signature before approving.",
+    ACTION_FAILED: "Failed to process action on the server.",
+  },
+};
+
+// ============================================================================
+// UTILITY FUNCTIONS
+// ============================================================================
+
+function getElement(id) {
+  const element = document.getElementById(id);
+  if (!element) console.warn(`Element with ID '${id}' not found`);
+  return element;
+}
+
+function showError(message) {
+  Swal.fire({
+    icon: "error",
+    title: "Access Denied",
+    text: message || "An unexpected error occurred.",
+    confirmButtonColor: CONFIG.COLORS.PRIMARY,
+  });
+}
+
+function getUrlParameter(param) {
+  return new URLSearchParams(window.location.search).get(param);
+}
+
+// ============================================================================
+// DOM POPULATION
+// ============================================================================
+
+function populateUI(data) {
+  if (!data) return;
+
+  const fieldMapping = {
+    displayStaffName: "staff_name",
+    displayStaffNo: "staff_no",
+    displayDesignation: "designation",
+    displayDept: "department",
+    displayPhone: "phone_number",
+    displayDateEmployed: "date_employed",
+    displayType: "leave_type",
+    displayStart: "start_date",
+    displayEnd: "resumption_date",
+    displayRelief: "relief_staff",
+    displayRejectionReason: "rejection_reason",
+  };
+
+  Object.entries(fieldMapping).forEach(([id, key]) => {
+    const el = getElement(id);
+    if (el) el.textContent = data[key] || "N/A";
+  });
+
+  const allowanceEl = getElement("displayAllowance");
+  if (allowanceEl) {
+    allowanceEl.textContent = data.leave_allowance_request
+      ? "YES (Requested)"
+      : "NO";
+    allowanceEl.style.color = data.leave_allowance_request
+      ? CONFIG.COLORS.SUCCESS
+      : CONFIG.COLORS.NEUTRAL;
+  }
+
+  const totalDaysEl = getElement("displayTotalDays");
+  if (totalDaysEl) {
+    totalDaysEl.textContent = `${data.total_days || 0} Working Days`;
+  }
+
+  if (data.status !== CONFIG.STATUS.REJECTED_BY_HR) {
+    const actions = getElement("actionButtons");
+    if (actions) actions.style.display = "none";
+    hideSignaturePad();
+    const banner = getElement("statusMessage");
+    if (banner) {
+      banner.classList.remove("hidden");
+      banner.textContent = `This request has already been processed (${data.status}).`;
+    }
+  }
+}
+
+// ============================================================================
+// ACTION HANDLERS
+// ============================================================================
+
+async function processReview(token, decision, data) {
+  const isOverturn = decision === CONFIG.STATUS.OVERTURNED;
+
+  const signature = getSignature();
+  if (isOverturn && !signature) {
+    Swal.fire({
+      title: "Signature Required",
+      text: CONFIG.MESSAGES.SIGNATURE_REQUIRED,
+      icon: "warning",
+      confirmButtonColor: CONFIG.COLORS.PRIMARY,
+    });
+    return;
+  }
+
+  const confirmResult = await Swal.fire({
+    title: isOverturn ? "Overturn the rejection?" : "Uphold the rejection?",
+    text: isOverturn
+      ? `${data.staff_name}'s leave will be approved and ${data.total_days} day(s) charged to their balance.`
+      : `${data.staff_name}'s request will remain rejected.`,
+    icon: "question",
+    input: "textarea",
+    inputPlaceholder: isOverturn
+      ? "Reason for overturning (optional)"
+      : "Comment for the staff (optional)",
+    showCancelButton: true,
+    confirmButtonColor: isOverturn ? CONFIG.COLORS.SUCCESS : CONFIG.COLORS.ERROR,
+    cancelButtonColor: CONFIG.COLORS.NEUTRAL,
+    confirmButtonText: "Yes, Proceed",
+  });
+
+  if (!confirmResult.isConfirmed) return;
+
+  const code = await confirmApproverCode(token).catch((error) => {
+    showError(error.message);
+    return null;
+  });
+  if (code === null) return;
+
+  try {
+    const response = await fetch(CONFIG.API.SUBMIT_ACTION, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({
+        token,
+        status: decision,
+        reason: confirmResult.value || "",
+        code,
+        signature,
+      }),
+    });
+
+    const result = await response.json();
+    if (!response.ok) {
+      throw new Error(result.error || CONFIG.MESSAGES.ACTION_FAILED);
+    }
+
+    await Swal.fire({
+      icon: "success",
+      title: "Decision Recorded",
+      text: result.message,
+      confirmButtonColor: CONFIG.COLORS.PRIMARY,
+    });
+    const actions = getElement("actionButtons");
+    if (actions) actions.style.display = "none";
+    hideSignaturePad();
+  } catch (error) {
+    showError(error.message);
+  }
+}
+
+// ============================================================================
+// INITIALIZATION
+// ============================================================================
+
+document.addEventListener("DOMContentLoaded", async () => {
+  const token = getUrlParameter("director_token");
+
+  if (!token) {
+    showError(CONFIG.MESSAGES.INVALID_TOKEN);
+    return;
+  }
+
+  try {
+    const response = await fetch(`${CONFIG.API.FETCH_DETAILS}?token=${token}`);
+    if (!response.ok) {
+      // 410: the link was already used, replaced by a newer one or has expired
+      const body = await response.json().catch(() => ({}));
+      throw new Error(
+        response.status === 410 ? body.error : CONFIG.MESSAGES.FETCH_ERROR,
+      );
+    }
+
+    const data = await response.json();
+    populateUI(data);
+    showReviewWarnings(data);
+    setupApproverCode(data);
+
+    const overturnBtn = getElement("overturnBtn");
+    const upholdBtn = getElement("upholdBtn");
+    if (overturnBtn) {
+      overturnBtn.onclick = () =>
+        processReview(token, CONFIG.STATUS.OVERTURNED, data);
+    }
+    if (upholdBtn) {
+      upholdBtn.onclick = () =>
+        processReview(token, CONFIG.STATUS.UPHELD, data);
+    }
+  } catch (error) {
+    console.error("Initialization Error:", error);
+    showError(error.message || CONFIG.MESSAGES.FETCH_ERROR);
+  }
+});
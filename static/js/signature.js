@@ -0,0 +1,127 @@
+/**
+ * signature.js - Approver Signature Capture
+ * Lets the approver draw a signature on #signaturePad or type their name into
+ * #signatureTyped, and turns either into a PNG data URL sent with the decision
+ */
+
+let signatureDrawn = false;
+
+/**
+ * Wire up the signature canvas, typed-name input and clear button
+ */
+function setupSignaturePad() {
+  const canvas = document.getElementById("signaturePad");
+  if (!canvas) return;
+
+  const typed = document.getElementById("signatureTyped");
+  const ctx = canvas.getContext("2d");
+  ctx.lineWidth = 2;
+  ctx.lineCap = "round";
+  ctx.strokeStyle = "#0b1f3a";
+
+  let drawing = false;
+
+  const point = (event) => {
+    const rect = canvas.getBoundingClientRect();
+    return {
+      x: ((event.clientX - rect.left) * canvas.width) / rect.width,
+      y: ((event.clientY - rect.top) * canvas.height) / rect.height,
+    };
+  };
+
+  canvas.addEventListener("pointerdown", (event) => {
+    // Drawing replaces a typed signature
+    if (!signatureDrawn) {
+      if (typed) typed.value = "";
+      clearSignature();
+    }
+    drawing = true;
+    signatureDrawn = true;
+    canvas.setPointerCapture(event.pointerId);
+    const { x, y } = point(event);
+    ctx.beginPath();
+    ctx.moveTo(x, y);
+  });
+
+  canvas.addEventListener("pointermove", (event) => {
+    if (!drawing) return;
+    const { x, y } = point(event);
+    ctx.lineTo(x, y);
+    ctx.stroke();
+  });
+
+  const stop = () => {
+    drawing = false;
+  };
+  canvas.addEventListener("pointerup", stop);
+  canvas.addEventListener("pointercancel", stop);
+
+  if (typed) {
+    typed.addEventListener("input", () => {
+      signatureDrawn = false;
+      renderTypedSignature(typed.value.trim());
+    });
+  }
+
+  const clearBtn = document.getElementById("clearSignatureBtn");
+  if (clearBtn) {
+    clearBtn.addEventListener("click", () => {
+      signatureDrawn = false;
+      if (typed) typed.value = "";
+      clearSignature();
+    });
+  }
+}
+
+/**
+ * Blank the signature canvas
+ */
+function clearSignature() {
+  const canvas = document.getElementById("signaturePad");
+  if (!canvas) return;
+  canvas.getContext("2d").clearRect(0, 0, canvas.width, canvas.height);
+}
+
+/**
+ * Draw a typed name onto the canvas in a handwriting style
+ * @param {string} name - Name typed by the approver
+ */
+function renderTypedSignature(name) {
+  const canvas = document.getElementById("signaturePad");
+  if (!canvas) return;
+
+  clearSignature();
+  if (!name) return;
+
+  const ctx = canvas.getContext("2d");
+  ctx.save();
+  ctx.fillStyle = "#0b1f3a";
+  ctx.font = "italic 36px 'Brush Script MT', 'Segoe Script', cursive";
+  ctx.textAlign = "center";
+  ctx.textBaseline = "middle";
+  ctx.fillText(name, canvas.width / 2, canvas.height / 2, canvas.width - 20);
+  ctx.restore();
+}
+
+/**
+ * Current signature as a PNG data URL
+ * @returns {string} The data URL, or "" if nothing was drawn or typed
+ */
+function getSignature() {
+  const canvas = document.getElementById("signaturePad");
+  const typed = document.getElementById("signatureTyped");
+  const hasTyped = typed && typed.value.trim() !== "";
+
+  if (!canvas || (!signatureDrawn && !hasTyped)) return "";
+  return canvas.toDataURL("image/png");
+}
+
+/**
+ * Hide the signature section once the request no longer needs a decision
+ */
+function hideSignaturePad() {
+  const container = document.getElementById("signatureContainer");
+  if (container) container.classList.add("hidden");
+}
+
+document.addEventListener("DOMContentLoaded", setupSignaturePad);
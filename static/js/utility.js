@@ -1,15 +1,39 @@
 const Utils = {
-  calculateLeaveDays: function (start, resumption) {
+  // holidays: Set of "YYYY-MM-DD" strings from /api/holidays (server counts the same way)
+  calculateLeaveDays: function (start, resumption, holidays = new Set()) {
     if (!start || !resumption) return 0;
     let d = new Date(start + "T00:00:00");
     let end = new Date(resumption + "T00:00:00");
     let count = 0;
     while (d < end) {
-      if (d.getDay() !== 0 && d.getDay() !== 6) count++;
+      if (
+        d.getDay() !== 0 &&
+        d.getDay() !== 6 &&
+        !holidays.has(Utils.toDateKey(d))
+      )
+        count++;
       d.setDate(d.getDate() + 1);
     }
     return count;
   },
+  toDateKey: function (d) {
+    const month = String(d.getMonth() + 1).padStart(2, "0");
+    const day = String(d.getDate()).padStart(2, "0");
+    return `${d.getFullYear()}-${month}-${day}`;
+  },
+  loadHolidays: async function (years) {
+    const holidays = new Set();
+    for (const year of years) {
+      try {
+        const response = await fetch(`/api/holidays?year=${year}`);
+        if (!response.ok) continue;
+        (await response.json()).forEach((h) => holidays.add(h.date));
+      } catch (error) {
+        console.warn("Could not load public holidays:", error);
+      }
+    }
+    return holidays;
+  },
   formatDaysText: function (days) {
     return days > 0 ? `${days} Working Day${days > 1 ? "s" : ""}` : "";
   },
@@ -0,0 +1,170 @@
+/**
+ * verify.js - Leave Record Verification
+ * Public page behind the QR code on leave record PDFs: shows the current
+ * status of the record and checks a PDF copy against the issued hash
+ */
+
+const CONFIG = {
+  API: {
+    VERIFY: "/api/leave/verify",
+  },
+  COLORS: {
+    VALID: "#1b5e20",
+    INVALID: "#b71c1c",
+  },
+  MESSAGES: {
+    NO_DOCUMENT: "No document ID was provided. Scan the QR code on the PDF.",
+    FETCH_ERROR: "This document could not be verified.",
+  },
+};
+
+let issuedHash = "";
+
+// ============================================================================
+// UTILITY FUNCTIONS
+// ============================================================================
+
+function getElement(id) {
+  return document.getElementById(id);
+}
+
+function setText(id, value) {
+  const el = getElement(id);
+  if (el) el.textContent = value || "N/A";
+}
+
+/**
+ * Show a verdict in a status banner
+ * @param {string} id - Banner element ID
+ * @param {boolean} ok - Whether the verdict is favourable
+ * @param {string} html - Banner content
+ */
+function showBanner(id, ok, html) {
+  const banner = getElement(id);
+  if (!banner) return;
+  banner.classList.remove("hidden");
+  banner.style.color = ok ? CONFIG.COLORS.VALID : CONFIG.COLORS.INVALID;
+  banner.style.borderColor = ok ? CONFIG.COLORS.VALID : CONFIG.COLORS.INVALID;
+  banner.innerHTML = html;
+}
+
+// ============================================================================
+// VERIFICATION
+// ============================================================================
+
+function populateUI(data) {
+  setText("displayDocumentId", data.document_id);
+  setText("displayReference", data.reference);
+  setText("displayStaffNo", data.staff_no);
+  setText("displayType", data.leave_type);
+  setText("displayTotalDays", `${data.total_days || 0} Working Days`);
+  setText("displayStart", data.start_date);
+  setText("displayEnd", data.resumption_date);
+  setText("displayStatus", data.status);
+  let issued = `${new Date(data.generated_at).toLocaleString()} (${data.status_at_issue})`;
+  if (data.reissue_of) {
+    issued += `, re-issue of document ${data.reissue_of}`;
+  }
+  if (data.replaced_by) {
+    issued += `, re-issued as document ${data.replaced_by} after the stored copy was lost`;
+  }
+  setText("displayIssued", issued);
+
+  if (data.cancelled) {
+    const when = data.cancelled_at
+      ? ` on ${new Date(data.cancelled_at).toLocaleDateString()}`
+      : "";
+    showBanner(
+      "statusMessage",
+      false,
+      `<i class="fas fa-ban"></i> This leave was cancelled${when}. The PDF is no longer valid.`,
+    );
+  } else if (data.cancellation_pending) {
+    showBanner(
+      "statusMessage",
+      false,
+      `<i class="fas fa-hourglass-half"></i> Cancellation of this leave has been requested and is awaiting HR. Do not rely on the PDF until it is resolved.`,
+    );
+  } else if (data.valid) {
+    showBanner(
+      "statusMessage",
+      true,
+      `<i class="fas fa-check-circle"></i> Genuine record: this leave is fully approved.`,
+    );
+  } else {
+    showBanner(
+      "statusMessage",
+      false,
+      `<i class="fas fa-exclamation-triangle"></i> This leave is not approved. Current status: <strong></strong>`,
+    );
+    getElement("statusMessage").querySelector("strong").textContent =
+      data.status;
+  }
+}
+
+/**
+ * Compare the SHA-256 of a chosen PDF with the hash recorded when it was issued
+ * @param {File} file - PDF selected by the user
+ */
+async function checkFile(file) {
+  const digest = await crypto.subtle.digest(
+    "SHA-256",
+    await file.arrayBuffer(),
+  );
+  const hash = Array.from(new Uint8Array(digest))
+    .map((b) => b.toString(16).padStart(2, "0"))
+    .join("");
+
+  if (hash === issuedHash) {
+    showBanner(
+      "hashResult",
+      true,
+      `<i class="fas fa-check-circle"></i> This file is identical to the document issued.`,
+    );
+  } else {
+    showBanner(
+      "hashResult",
+      false,
+      `<i class="fas fa-times-circle"></i> This file does not match the document issued. It may have been altered.`,
+    );
+  }
+}
+
+// ============================================================================
+// INITIALIZATION
+// ============================================================================
+
+document.addEventListener("DOMContentLoaded", async () => {
+  const docId = new URLSearchParams(window.location.search).get("doc");
+  if (!docId) {
+    showBanner("statusMessage", false, CONFIG.MESSAGES.NO_DOCUMENT);
+    return;
+  }
+
+  try {
+    const response = await fetch(
+      `${CONFIG.API.VERIFY}?doc=${encodeURIComponent(docId)}`,
+    );
+    const data = await response.json().catch(() => ({}));
+    if (!response.ok) {
+      throw new Error(data.error || CONFIG.MESSAGES.FETCH_ERROR);
+    }
+
+    issuedHash = data.sha256;
+    populateUI(data);
+  } catch (error) {
+    showBanner(
+      "statusMessage",
+      false,
+      `<i class="fas fa-times-circle"></i> ${error.message}`,
+    );
+    return;
+  }
+
+  const fileInput = getElement("pdfFile");
+  if (fileInput) {
+    fileInput.addEventListener("change", () => {
+      if (fileInput.files.length > 0) checkFile(fileInput.files[0]);
+    });
+  }
+});